@@ -0,0 +1,307 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// MaxBatchSize is the largest number of intervals that can be quoted in a single batch request.
+const MaxBatchSize = 10000
+
+// Interval is a single start and end pair to quote in a batch, both in RFC3339 format.
+type Interval struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// BatchResult is the outcome of quoting a single Interval. The Status is 200 with a Price
+// when a rate is available, 404 when it is not, and 400 when the interval could not be
+// parsed. The Reason explains why a Price is missing. As for a Rate, the Price is in the
+// minor unit of the Currency, and the FormattedPrice is the same price for display.
+type BatchResult struct {
+	Status         uint   `json:"status"`
+	Start          string `json:"start"`
+	End            string `json:"end"`
+	Price          *uint  `json:"price,omitempty"`
+	Currency       string `json:"currency,omitempty"`
+	FormattedPrice string `json:"formatted_price,omitempty"`
+	Reason         string `json:"reason,omitempty"`
+}
+
+// BatchQuote is the response for a batch of intervals, with one result for each interval in
+// the order they were requested.
+type BatchQuote struct {
+	Status  uint          `json:"status"`
+	Results []BatchResult `json:"results" xml:"Result"`
+}
+
+// JSON implementation for WebFormatter interface.
+func (b BatchQuote) JSON() ([]byte, error) {
+	return json.Marshal(b)
+}
+
+// XML implementation for WebFormatter interface.
+func (b BatchQuote) XML() ([]byte, error) {
+	return xml.Marshal(b)
+}
+
+// CSV implementation for CSVFormatter interface. Each row is a single result.
+func (b BatchQuote) CSV() ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+
+	writer.Write([]string{"start", "end", "status", "price", "currency", "reason"})
+	for _, result := range b.Results {
+		price := ""
+		if result.Price != nil {
+			price = strconv.FormatUint(uint64(*result.Price), 10)
+		}
+		writer.Write([]string{result.Start, result.End, strconv.FormatUint(uint64(result.Status), 10), price, result.Currency, result.Reason})
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Text implementation for TextFormatter interface. Each line is a single result, with its price or
+// the reason it has none.
+func (b BatchQuote) Text() ([]byte, error) {
+	var buf bytes.Buffer
+	tw := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	for _, result := range b.Results {
+		outcome := result.Reason
+		if result.Price != nil {
+			outcome = result.FormattedPrice
+		}
+		fmt.Fprintf(tw, "%v\t%v\t%v\n", result.Start, result.End, outcome)
+	}
+	tw.Flush()
+	return buf.Bytes(), nil
+}
+
+// StatusCode implementation for WebFormatter interface.
+func (b BatchQuote) StatusCode() uint {
+	return b.Status
+}
+
+// QuoteBatch quotes each interval against the weekly rates, without occupancy bands, since the
+// intervals of a batch are often past or far off, when the occupancy is not the current one. A failure
+// to quote one interval is reported in its result, and does not affect the others.
+func (weekRates *WeeklyRates) QuoteBatch(intervals []Interval) BatchQuote {
+	batch := BatchQuote{Status: http.StatusOK, Results: make([]BatchResult, 0, len(intervals))}
+
+	for _, interval := range intervals {
+		result := BatchResult{Start: interval.Start, End: interval.End}
+
+		duration, err := ParseDuration(interval.Start, interval.End)
+		if err != nil {
+			result.Status = http.StatusBadRequest
+			result.Reason = err.Error()
+		} else if quote, err := weekRates.QuoteWithOptions(duration, QuoteOptions{}); err != nil {
+			result.Status = http.StatusNotFound
+			result.Reason = err.Error()
+		} else {
+			result.Status = http.StatusOK
+			result.Price = &quote.Total
+			result.Currency = quote.Currency
+			result.FormattedPrice = quote.Price().String()
+		}
+
+		batch.Results = append(batch.Results, result)
+	}
+
+	return batch
+}
+
+// IntervalsFromRequestBody parses the intervals in the body of a batch request. The body may be
+// a JSON array ("Content-Type:application/json"), newline delimited JSON with one interval per
+// line ("Content-Type:application/x-ndjson"), or CSV with "start" and "end" columns
+// ("Content-Type:text/csv").
+func IntervalsFromRequestBody(r *http.Request) ([]Interval, error) {
+	defer r.Body.Close()
+
+	var intervals []Interval
+	var err error
+
+	contentType := r.Header.Get("Content-Type")
+	switch {
+	case strings.Contains(contentType, "ndjson"):
+		intervals, err = intervalsFromNDJSON(r.Body)
+	case strings.Contains(contentType, "json"):
+		intervals, err = intervalsFromJSON(r.Body)
+	case strings.Contains(contentType, "csv"):
+		intervals, err = intervalsFromCSV(r.Body)
+	default:
+		err = newError(CodeUnsupportedContentType, "", "invalid content type \"%v\" in request, \"Content-Type:application/json\", \"Content-Type:application/x-ndjson\" or \"Content-Type:text/csv\" is required", contentType)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(intervals) > MaxBatchSize {
+		return nil, newError(CodeBatchTooLarge, "", "batch of more than %d intervals exceeds the maximum of %d", MaxBatchSize, MaxBatchSize)
+	}
+	return intervals, nil
+}
+
+// intervalsFromJSON decodes a JSON array of intervals one at a time, and stops after the first
+// interval over MaxBatchSize, so that a batch that is too large is not decoded in full.
+func intervalsFromJSON(r io.Reader) ([]Interval, error) {
+	var intervals []Interval
+
+	decoder := json.NewDecoder(r)
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, newError(CodeInvalidBody, "", "could not parse JSON array of intervals: %w", err)
+	} else if token != json.Delim('[') {
+		return nil, newError(CodeInvalidBody, "", "could not parse JSON array of intervals: found %v instead of an array", token)
+	}
+	for decoder.More() {
+		interval := Interval{}
+		if err := decoder.Decode(&interval); err != nil {
+			return nil, newError(CodeInvalidBody, "", "could not parse interval %d of JSON array: %w", len(intervals)+1, err)
+		}
+		intervals = append(intervals, interval)
+
+		if len(intervals) > MaxBatchSize {
+			return intervals, nil
+		}
+	}
+	if _, err := decoder.Token(); err != nil {
+		return nil, newError(CodeInvalidBody, "", "could not parse JSON array of intervals: %w", err)
+	}
+
+	return intervals, nil
+}
+
+func intervalsFromNDJSON(r io.Reader) ([]Interval, error) {
+	var intervals []Interval
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		interval := Interval{}
+		if err := json.Unmarshal([]byte(text), &interval); err != nil {
+			return nil, newError(CodeInvalidBody, "", "could not parse interval on line %d: %w", line, err)
+		}
+		intervals = append(intervals, interval)
+
+		if len(intervals) > MaxBatchSize {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return intervals, nil
+}
+
+func intervalsFromCSV(r io.Reader) ([]Interval, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	// Read the header and at most one row over MaxBatchSize, so that a batch that is too large
+	// is not read in full.
+	var records [][]string
+	for len(records) <= MaxBatchSize+1 {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			if parseErr, ok := err.(*csv.ParseError); ok {
+				return nil, &CSVError{Row: parseErr.Line, Column: "", Err: newError(CodeInvalidBody, "", "%w", parseErr.Err)}
+			}
+			return nil, newError(CodeInvalidBody, "", "%w", err)
+		}
+		records = append(records, record)
+	}
+	if len(records) == 0 {
+		return nil, &CSVError{Row: 1, Column: "", Err: newError(CodeInvalidBody, "", "missing header row")}
+	}
+
+	// Find the start and end columns, ignoring any others so that exported
+	// reports can be quoted without removing columns first.
+	startColumn, endColumn := -1, -1
+	for i, name := range records[0] {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "start":
+			startColumn = i
+		case "end":
+			endColumn = i
+		}
+	}
+	if startColumn < 0 {
+		return nil, &CSVError{Row: 1, Column: "start", Err: newError(CodeInvalidBody, "start", "missing column")}
+	}
+	if endColumn < 0 {
+		return nil, &CSVError{Row: 1, Column: "end", Err: newError(CodeInvalidBody, "end", "missing column")}
+	}
+
+	var intervals []Interval
+	for i, record := range records[1:] {
+		if startColumn >= len(record) || endColumn >= len(record) {
+			return nil, &CSVError{Row: i + 2, Column: "", Err: newError(CodeInvalidBody, "", "expected %d columns, found %d", len(records[0]), len(record))}
+		}
+		intervals = append(intervals, Interval{
+			Start: strings.TrimSpace(record[startColumn]),
+			End:   strings.TrimSpace(record[endColumn]),
+		})
+	}
+
+	return intervals, nil
+}
+
+// BatchHandleFunc is the top-level handler for requests to the /api/rate/batch endpoint, which
+// quotes many intervals in a single request.
+func BatchHandleFunc(w http.ResponseWriter, r *http.Request) {
+	r, ok := InitializeResponse(&w, r) // Required before WriteResponse
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		BatchPostHandleFunc(w, r)
+	default:
+		err := methodNotSupported(r.Method)
+		WriteError(http.StatusBadRequest, err, &w, r)
+	}
+}
+
+// BatchPostHandleFunc quotes each interval in the Post body and returns a result for each. All
+// intervals are quoted against the same rates, even if the rates are replaced or updated while
+// the batch is in progress.
+//
+// Example:
+//
+//	curl -X POST -H "Content-Type: application/json" -d '[{"start":"2015-07-01T07:00:00Z","end":"2015-07-01T12:00:00Z"}]' "http://localhost:8080/api/rate/batch"
+func BatchPostHandleFunc(w http.ResponseWriter, r *http.Request) {
+	intervals, err := IntervalsFromRequestBody(r)
+	if err != nil {
+		WriteError(http.StatusBadRequest, err, &w, r)
+		return
+	}
+
+	// Take a snapshot of the rates, since replacing or updating the rates
+	// swaps the global pointer rather than modifying the rates in place.
+	rates := currentWeeklyRates
+	WriteResponse(rates.QuoteBatch(intervals), &w, r)
+}
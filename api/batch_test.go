@@ -0,0 +1,91 @@
+package api_test
+
+import (
+	"github.com/jtide/gopark/api"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWeeklyRates_QuoteBatch(t *testing.T) {
+	rates := api.NewWeeklyRates()
+	err := rates.Update(jsonStandardConfig)
+	assert.NoError(t, err)
+
+	batch := rates.QuoteBatch([]api.Interval{
+		{Start: "2015-07-01T07:00:00Z", End: "2015-07-01T12:00:00Z"},
+		{Start: "2015-07-02T07:00:00Z", End: "2015-07-02T12:00:00Z"},
+		{Start: "2015-07-01T07:00:00Z", End: "yesterday"},
+	})
+	assert.Len(t, batch.Results, 3)
+
+	assert.Equal(t, uint(http.StatusOK), batch.Results[0].Status)
+	assert.Equal(t, uint(1750), *batch.Results[0].Price)
+	assert.Empty(t, batch.Results[0].Reason)
+
+	assert.Equal(t, uint(http.StatusNotFound), batch.Results[1].Status)
+	assert.Nil(t, batch.Results[1].Price)
+	assert.Equal(t, "rate unavailable: no rate exists for minute: 420", batch.Results[1].Reason)
+
+	assert.Equal(t, uint(http.StatusBadRequest), batch.Results[2].Status)
+	assert.Nil(t, batch.Results[2].Price)
+	assert.Contains(t, batch.Results[2].Reason, "could not parse 'end' parameter [yesterday]")
+}
+
+func TestIntervalsFromRequestBody(t *testing.T) {
+	expected := []api.Interval{
+		{Start: "2015-07-01T07:00:00Z", End: "2015-07-01T12:00:00Z"},
+		{Start: "2015-07-04T07:00:00Z", End: "2015-07-04T20:00:00Z"},
+	}
+	bodies := map[string]string{
+		"application/json": `[
+			{"start": "2015-07-01T07:00:00Z", "end": "2015-07-01T12:00:00Z"},
+			{"start": "2015-07-04T07:00:00Z", "end": "2015-07-04T20:00:00Z"}
+		]`,
+		"application/x-ndjson": `{"start": "2015-07-01T07:00:00Z", "end": "2015-07-01T12:00:00Z"}
+
+{"start": "2015-07-04T07:00:00Z", "end": "2015-07-04T20:00:00Z"}
+`,
+		"text/csv": "session,start,end\n1,2015-07-01T07:00:00Z,2015-07-01T12:00:00Z\n2,2015-07-04T07:00:00Z,2015-07-04T20:00:00Z\n",
+	}
+
+	for contentType, body := range bodies {
+		r := httptest.NewRequest(http.MethodPost, "/api/rate/batch", strings.NewReader(body))
+		r.Header.Set("Content-Type", contentType)
+
+		intervals, err := api.IntervalsFromRequestBody(r)
+		assert.NoError(t, err, contentType)
+		assert.Equal(t, expected, intervals, contentType)
+	}
+}
+
+func TestIntervalsFromRequestBodyWithInvalidNDJSON(t *testing.T) {
+	body := "{\"start\": \"2015-07-01T07:00:00Z\", \"end\": \"2015-07-01T12:00:00Z\"}\n{\"start\": \n"
+	r := httptest.NewRequest(http.MethodPost, "/api/rate/batch", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-ndjson")
+
+	_, err := api.IntervalsFromRequestBody(r)
+	assert.EqualError(t, err, "could not parse interval on line 2: unexpected end of JSON input")
+}
+
+func TestIntervalsFromRequestBodyOverMaxBatchSize(t *testing.T) {
+	interval := `{"start": "2015-07-01T07:00:00Z", "end": "2015-07-01T12:00:00Z"}`
+	row := "2015-07-01T07:00:00Z,2015-07-01T12:00:00Z\n"
+	bodies := map[string]string{
+		"application/json":     "[" + strings.Repeat(interval+",", api.MaxBatchSize) + interval + "]",
+		"application/x-ndjson": strings.Repeat(interval+"\n", api.MaxBatchSize+1),
+		"text/csv":             "start,end\n" + strings.Repeat(row, api.MaxBatchSize+1),
+	}
+
+	for contentType, body := range bodies {
+		// The rest of the body is not read once the batch is too large, so it is never parsed
+		r := httptest.NewRequest(http.MethodPost, "/api/rate/batch", strings.NewReader(body+"not an interval"))
+		r.Header.Set("Content-Type", contentType)
+
+		_, err := api.IntervalsFromRequestBody(r)
+		code, _ := api.ErrorCode(err, http.StatusBadRequest)
+		assert.Equal(t, api.CodeBatchTooLarge, code, contentType)
+	}
+}
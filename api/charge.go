@@ -0,0 +1,84 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Types of Charge.
+const (
+	ChargeTax = "tax"
+	ChargeFee = "fee"
+)
+
+// Charge is a tax or fee added to quotes. A tax is a Percent of the price, which is either added to
+// the price, or is Inclusive, when the price already includes it. A fee is a fixed Amount in the minor
+// unit of the currency of the rates, added once to each quote.
+//
+// Charges of a ConfigRates apply to every quote for the facility, and charges of a ConfigRate only to
+// the part of a quote priced by that rule.
+type Charge struct {
+	Name      string  `json:"name"`
+	Type      string  `json:"type"`
+	Percent   float64 `json:"percent,omitempty"`
+	Inclusive bool    `json:"inclusive,omitempty"`
+	Amount    uint    `json:"amount,omitempty"`
+}
+
+// Validate returns an error if the charge is not a tax with a percentage, or a fee with an amount.
+func (c Charge) Validate() error {
+	switch c.Type {
+	case ChargeTax:
+		if c.Percent <= 0 || c.Percent > 100 {
+			return newError(CodeInvalidCharge, "charges", "invalid percent %v for tax '%s', must be greater than 0 and at most 100", c.Percent, c.Name)
+		}
+		if c.Amount != 0 {
+			return newError(CodeInvalidCharge, "charges", "tax '%s' cannot have an amount, use a fee instead", c.Name)
+		}
+	case ChargeFee:
+		if c.Amount == 0 {
+			return newError(CodeInvalidCharge, "charges", "fee '%s' must have an amount greater than 0", c.Name)
+		}
+		if c.Percent != 0 || c.Inclusive {
+			return newError(CodeInvalidCharge, "charges", "fee '%s' cannot have a percent, use a tax instead", c.Name)
+		}
+	default:
+		return newError(CodeInvalidCharge, "charges", "invalid type '%s' for charge '%s', must be \"%s\" or \"%s\"", c.Type, c.Name, ChargeTax, ChargeFee)
+	}
+	return nil
+}
+
+// validateCharges returns an error for the first invalid charge.
+func validateCharges(charges []Charge) error {
+	for _, charge := range charges {
+		if err := charge.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// adjustment returns the line of a quote for the charge on a price. The amount of an inclusive tax is
+// the part of the price that is tax, and is not added to the total. Amounts are rounded half up to
+// the minor unit.
+func (c Charge) adjustment(price uint) Adjustment {
+	switch {
+	case c.Type == ChargeFee:
+		return Adjustment{Type: ChargeFee, Description: c.Name, Amount: int(c.Amount)}
+	case c.Inclusive:
+		untaxed := math.Round(float64(price) / (1 + c.Percent/100))
+		return Adjustment{
+			Type:        ChargeTax,
+			Description: fmt.Sprintf("%s (%s%%, included)", c.Name, strconv.FormatFloat(c.Percent, 'f', -1, 64)),
+			Amount:      int(price) - int(untaxed),
+			Included:    true,
+		}
+	default:
+		return Adjustment{
+			Type:        ChargeTax,
+			Description: fmt.Sprintf("%s (%s%%)", c.Name, strconv.FormatFloat(c.Percent, 'f', -1, 64)),
+			Amount:      int(math.Round(float64(price) * c.Percent / 100)),
+		}
+	}
+}
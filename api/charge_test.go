@@ -0,0 +1,141 @@
+package api_test
+
+import (
+	"github.com/jtide/gopark/api"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var jsonChargesConfig = []byte(`{
+	"charges": [
+		{"name": "City parking tax", "type": "tax", "percent": 10},
+		{"name": "Transaction surcharge", "type": "fee", "amount": 35}
+	],
+	"rates": [
+		{"days": "wed", "times": "0600-1800", "price": 1750,
+		 "charges": [{"name": "Event levy", "type": "fee", "amount": 200}]},
+		{"days": "thurs", "times": "0600-1800", "price": 1200}
+	]
+}`)
+
+func quoteCharges(t *testing.T, rates api.WeeklyRates, start string, end string) api.Quote {
+	duration, err := api.ParseDuration(start, end)
+	assert.NoError(t, err)
+	quote, err := rates.QuoteByDuration(duration)
+	assert.NoError(t, err)
+	return quote
+}
+
+func TestQuoteByDurationWithCharges(t *testing.T) {
+	rates := api.NewWeeklyRates()
+	err := rates.Update(jsonChargesConfig)
+	assert.NoError(t, err)
+
+	// The rule's fee, then the facility's tax and fee
+	quote := quoteCharges(t, rates, "2015-07-01T07:00:00Z", "2015-07-01T12:00:00Z")
+	assert.Equal(t, uint(1750), quote.Subtotal)
+	assert.Equal(t, []api.Adjustment{
+		{Type: "fee", Description: "Event levy", Amount: 200},
+		{Type: "tax", Description: "City parking tax (10%)", Amount: 175},
+		{Type: "fee", Description: "Transaction surcharge", Amount: 35},
+	}, quote.Adjustments)
+	assert.Equal(t, uint(2160), quote.Total)
+
+	// Only the facility's charges
+	quote = quoteCharges(t, rates, "2015-07-02T07:00:00Z", "2015-07-02T12:00:00Z")
+	assert.Equal(t, uint(1200), quote.Subtotal)
+	assert.Len(t, quote.Adjustments, 2)
+	assert.Equal(t, uint(1355), quote.Total)
+
+	price, err := rates.Lookup("2015-07-02T07:00:00Z", "2015-07-02T12:00:00Z")
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1355), price)
+}
+
+func TestQuoteByDurationWithInclusiveTax(t *testing.T) {
+	rates := api.NewWeeklyRates()
+	err := rates.Update([]byte(`{
+		"charges": [{"name": "VAT", "type": "tax", "percent": 20, "inclusive": true}],
+		"rates": [{"days": "wed", "times": "0600-1800", "price": 1750}]
+	}`))
+	assert.NoError(t, err)
+
+	quote := quoteCharges(t, rates, "2015-07-01T07:00:00Z", "2015-07-01T12:00:00Z")
+	assert.Equal(t, []api.Adjustment{
+		{Type: "tax", Description: "VAT (20%, included)", Amount: 292, Included: true},
+	}, quote.Adjustments)
+	assert.Equal(t, uint(1750), quote.Subtotal)
+	assert.Equal(t, uint(1750), quote.Total)
+}
+
+func TestWeeklyRates_UpdateKeepsFacilityCharges(t *testing.T) {
+	rates := api.NewWeeklyRates()
+	err := rates.Update(jsonChargesConfig)
+	assert.NoError(t, err)
+
+	// New rates have the charges of the facility
+	err = rates.Update([]byte(`{"rates": [{"days": "fri", "times": "0600-1800", "price": 1000}]}`))
+	assert.NoError(t, err)
+	quote := quoteCharges(t, rates, "2015-07-03T07:00:00Z", "2015-07-03T12:00:00Z")
+	assert.Equal(t, uint(1135), quote.Total)
+
+	// Facility charges replace those of every rate
+	err = rates.Update([]byte(`{"charges": [], "rates": []}`))
+	assert.NoError(t, err)
+	quote = quoteCharges(t, rates, "2015-07-02T07:00:00Z", "2015-07-02T12:00:00Z")
+	assert.Empty(t, quote.Adjustments)
+	assert.Equal(t, uint(1200), quote.Total)
+}
+
+func TestWeeklyRates_UpdateWithInvalidCharges(t *testing.T) {
+	configs := []string{
+		`{"charges": [{"name": "tax", "type": "tax"}], "rates": []}`,
+		`{"charges": [{"name": "tax", "type": "tax", "percent": 150}], "rates": []}`,
+		`{"charges": [{"name": "fee", "type": "fee"}], "rates": []}`,
+		`{"charges": [{"name": "fee", "type": "fee", "amount": 10, "percent": 5}], "rates": []}`,
+		`{"charges": [{"name": "tip", "type": "gratuity", "amount": 10}], "rates": []}`,
+		`{"charges": [{"name": "fee", "type": "fee", "amount": -10}], "rates": []}`,
+		`{"rates": [{"days": "wed", "times": "0600-1800", "price": 1750, "charges": [{"name": "fee", "type": "fee"}]}]}`,
+	}
+
+	for _, config := range configs {
+		rates := api.NewWeeklyRates()
+		err := rates.Update([]byte(config))
+		code, field := api.ErrorCode(err, 400)
+		assert.Equal(t, api.CodeInvalidCharge, code, config)
+		assert.Equal(t, "charges", field, config)
+	}
+}
+
+func TestWeeklyRates_ConfigWithCharges(t *testing.T) {
+	rates := api.NewWeeklyRates()
+	err := rates.Update(jsonChargesConfig)
+	assert.NoError(t, err)
+
+	config := rates.Config()
+	assert.Len(t, config.Charges, 2)
+	assert.Len(t, config.Rates, 2)
+	assert.Equal(t, "Event levy", config.Rates[0].Charges[0].Name)
+	assert.Empty(t, config.Rates[1].Charges)
+
+	// Charges cannot be exported as CSV
+	_, err = config.CSV()
+	assert.ErrorIs(t, err, api.ErrNoEncoding)
+}
+
+func TestRatesHandleFuncWithChargesFallsBackFromCSV(t *testing.T) {
+	err := api.ReplaceRates(jsonChargesConfig)
+	assert.NoError(t, err)
+	defer api.ReplaceRates(api.JSONDefaultRateConfig)
+
+	r := httptest.NewRequest(http.MethodGet, "/api/rates", nil)
+	r.Header.Set("Accept", "text/csv")
+	w := httptest.NewRecorder()
+	api.RatesHandleFunc(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "application/json")
+	assert.Contains(t, w.Body.String(), `"charges":[{"name":"City parking tax","type":"tax","percent":10}`)
+}
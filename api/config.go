@@ -1,15 +1,85 @@
 package api
 
-// ConfigRates are used to update or replace existing rates.
+import (
+	"encoding/json"
+	"strings"
+)
+
+// ConfigRates are used to update or replace existing rates. The Currency is the ISO 4217 code of
+// the prices of all of the rates, such as "USD". If it is empty, rates that replace existing rates
+// are in the DefaultCurrency, and rates that update existing rates are in their currency. Charges
+// are the taxes and fees of the facility, which apply to every quote, the DefaultVehicle is the
+// class of vehicle of quotes that do not give one, Specials are flat rates for stays that meet their
+// conditions, Grace is the grace period and free minutes of every stay, Capacity is the number of
+// spots that can be reserved at once, and Refunds are the refund rules of cancelled reservations. If
+// they are missing, rates that update existing rates keep those of the existing rates.
 type ConfigRates struct {
-	Rates []ConfigRate `json:"rates"`
+	Currency       string        `json:"currency,omitempty"`
+	DefaultVehicle string        `json:"default_vehicle,omitempty" xml:",omitempty"`
+	Charges        []Charge      `json:"charges,omitempty" xml:"Charge"`
+	Specials       []SpecialRate `json:"specials,omitempty" xml:"Special"`
+	Grace          *Grace        `json:"grace,omitempty"`
+	Capacity       uint          `json:"capacity,omitempty" xml:",omitempty"`
+	Refunds        []RefundRule  `json:"refunds,omitempty" xml:"Refund"`
+	Rates          []ConfigRate  `json:"rates"`
 }
 
-// ConfigRate is an individual rate for a specific time range on a list of days.
+// ConfigRate is an individual rate for a specific time range on a list of days. The Price is in
+// the minor unit of the currency of the configuration, such as cents for USD, and Vehicles are the
+// prices for classes of vehicle that differ from it. A Ladder prices stays by their length instead
+// of the Price. Charges are the taxes and fees that apply only to the part of a quote priced by this
+// rate, and Grace replaces the grace of the configuration for stays that start in this rate. Occupancy
+// bands change the price by how full the facility is, if the configuration has a capacity.
 type ConfigRate struct {
-	Days  string `json:"days"`
-	Times string `json:"times"`
-	Price uint   `json:"price"`
+	Days      string          `json:"days"`
+	Times     string          `json:"times"`
+	Price     uint            `json:"price"`
+	Vehicles  []VehiclePrice  `json:"vehicles,omitempty" xml:"Vehicle"`
+	Ladder    *Ladder         `json:"ladder,omitempty"`
+	Charges   []Charge        `json:"charges,omitempty" xml:"Charge"`
+	Grace     *Grace          `json:"grace,omitempty"`
+	Occupancy []OccupancyBand `json:"occupancy,omitempty" xml:"Occupancy"`
+}
+
+// ConfigRatesFromJSON parses a rate configuration specified in JSON format.
+func ConfigRatesFromJSON(jsonConfig []byte) (ConfigRates, error) {
+	config := ConfigRates{}
+	err := json.Unmarshal(jsonConfig, &config)
+	if err != nil {
+		// A value of the wrong type, such as a negative price, is reported for
+		// its field, and any other problem with the JSON for the whole body.
+		code, field := CodeInvalidBody, ""
+		if typeErr, ok := err.(*json.UnmarshalTypeError); ok {
+			switch {
+			case strings.HasPrefix(typeErr.Field, "specials"):
+				code, field = CodeInvalidSpecial, "specials"
+			case strings.Contains(typeErr.Field, "occupancy"):
+				code, field = CodeInvalidOccupancyBand, "occupancy"
+			case strings.HasPrefix(typeErr.Field, "refunds"):
+				code, field = CodeInvalidRefund, "refunds"
+			case typeErr.Field == "capacity":
+				code, field = CodeInvalidCapacity, "capacity"
+			case strings.Contains(typeErr.Field, "grace"):
+				code, field = CodeInvalidGrace, "grace"
+			case strings.Contains(typeErr.Field, "ladder"):
+				code, field = CodeInvalidLadder, "ladder"
+			case strings.HasSuffix(typeErr.Field, "days"):
+				code, field = CodeInvalidDays, "days"
+			case strings.HasSuffix(typeErr.Field, "times"):
+				code, field = CodeInvalidTimes, "times"
+			case strings.HasSuffix(typeErr.Field, "price"):
+				code, field = CodeInvalidPrice, "price"
+			case strings.HasSuffix(typeErr.Field, "currency"):
+				code, field = CodeInvalidCurrency, "currency"
+			case strings.Contains(typeErr.Field, "charges"):
+				code, field = CodeInvalidCharge, "charges"
+			case strings.Contains(typeErr.Field, "vehicle"):
+				code, field = CodeInvalidVehicle, "vehicle"
+			}
+		}
+		return config, newError(code, field, "could not parse JSON to update rates : %w", err)
+	}
+	return config, nil
 }
 
 var JSONDefaultRateConfig = []byte(
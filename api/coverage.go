@@ -0,0 +1,226 @@
+package api
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// minutesPerDay is the number of minutes covered by a DailyRates table.
+const minutesPerDay = 24 * 60
+
+// Gap is a window of time on a single day for which no rate exists.
+type Gap struct {
+	StartMinute uint64 `json:"start"`
+	EndMinute   uint64 `json:"end"`
+	Times       string `json:"times"`
+}
+
+// DayCoverage reports the share of a single day that is covered by rates, and every gap in the day.
+type DayCoverage struct {
+	Day     string  `json:"day"`
+	Percent float64 `json:"percent"`
+	Gaps    []Gap   `json:"gaps"`
+}
+
+// Coverage reports the share of the week that is covered by rates, and the gaps for each day.
+// If a Minimum percentage was requested and the week is not covered enough, the Status is
+// 422 (Unprocessable Entity) and the Description explains why.
+type Coverage struct {
+	Status      uint          `json:"status"`
+	Description string        `json:"desc,omitempty"`
+	Percent     float64       `json:"percent"`
+	Minimum     float64       `json:"minimum,omitempty"`
+	Days        []DayCoverage `json:"days"`
+}
+
+// JSON implementation for WebFormatter interface.
+func (c Coverage) JSON() ([]byte, error) {
+	return json.Marshal(c)
+}
+
+// XML implementation for WebFormatter interface.
+func (c Coverage) XML() ([]byte, error) {
+	return xml.Marshal(c)
+}
+
+// CSV implementation for CSVFormatter interface. Each row is a single gap.
+func (c Coverage) CSV() ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+
+	writer.Write([]string{"day", "times"})
+	for _, day := range c.Days {
+		for _, gap := range day.Gaps {
+			writer.Write([]string{day.Day, gap.Times})
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Text implementation for TextFormatter interface.
+func (c Coverage) Text() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// StatusCode implementation for WebFormatter interface.
+func (c Coverage) StatusCode() uint {
+	return c.Status
+}
+
+// String returns a human-readable report listing the gaps for each day.
+func (c Coverage) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Coverage: %v%% of the week\n", c.Percent)
+	for _, day := range c.Days {
+		var times []string
+		for _, gap := range day.Gaps {
+			times = append(times, gap.Times)
+		}
+		if len(times) == 0 {
+			times = append(times, "none")
+		}
+		fmt.Fprintf(&b, "%-6s %6v%%  gaps: %s\n", day.Day, day.Percent, strings.Join(times, ", "))
+	}
+	return b.String()
+}
+
+// Validate returns an error if less than the minimum percentage of the week is covered by rates.
+func (c Coverage) Validate(minimum float64) error {
+	if c.Percent < minimum {
+		return newError(CodeInsufficientCoverage, "", "rates cover %v%% of the week, below the minimum of %v%%", c.Percent, minimum)
+	}
+	return nil
+}
+
+// Coverage walks the weekly rates from Monday to Sunday and reports every window of time
+// without a rate, along with the percentage of each day and of the whole week that is covered.
+func (weekRates *WeeklyRates) Coverage() Coverage {
+	coverage := Coverage{Status: http.StatusOK, Days: []DayCoverage{}}
+
+	var weekCovered uint64
+	for _, weekday := range Weekdays {
+		dayRates := weekRates.Days[weekday]
+		gaps, covered := dayRates.gaps()
+		weekCovered += covered
+
+		coverage.Days = append(coverage.Days, DayCoverage{
+			Day:     StringFromWeekday(weekday),
+			Percent: percentOf(covered, minutesPerDay),
+			Gaps:    gaps,
+		})
+	}
+	coverage.Percent = percentOf(weekCovered, minutesPerDay*uint64(len(Weekdays)))
+
+	return coverage
+}
+
+// gaps returns the windows of the day without a rate, and the number of minutes with a rate.
+func (d *DailyRates) gaps() ([]Gap, uint64) {
+	// Rates are normally disjoint, but tracking the end of the covered range so far
+	// also handles rates that overlap or extend past midnight.
+	gaps := []Gap{}
+	var covered, position uint64
+	for _, key := range d.Keys() {
+		rate := (*d)[key]
+		start := minUint64(rate.StartMinute, minutesPerDay)
+		end := minUint64(rate.EndMinute, minutesPerDay)
+		if end <= position {
+			continue
+		}
+		if start > position {
+			gaps = append(gaps, newGap(position, start))
+		} else {
+			start = position
+		}
+		covered += end - start
+		position = end
+	}
+	if position < minutesPerDay {
+		gaps = append(gaps, newGap(position, minutesPerDay))
+	}
+
+	return gaps, covered
+}
+
+func newGap(start uint64, end uint64) Gap {
+	return Gap{StartMinute: start, EndMinute: end, Times: TimeRangeToConfigString(start, end)}
+}
+
+func minUint64(a uint64, b uint64) uint64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// percentOf returns part as a percentage of total, rounded to two decimal places.
+func percentOf(part uint64, total uint64) float64 {
+	return math.Round(float64(part)/float64(total)*10000) / 100
+}
+
+// CoverageHandleFunc is the top-level handler for requests to the /api/rates/coverage endpoint,
+// which reports the gaps in the current rate configuration.
+func CoverageHandleFunc(w http.ResponseWriter, r *http.Request) {
+	r, ok := InitializeResponse(&w, r) // Required before WriteResponse
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		CoverageGetHandleFunc(w, r)
+	default:
+		err := methodNotSupported(r.Method)
+		WriteError(http.StatusBadRequest, err, &w, r)
+	}
+}
+
+// CoverageGetHandleFunc returns the coverage of the current rates. If the optional "minimum"
+// parameter is given, a 422 status is returned when the rates cover less of the week.
+//
+// Example:
+//
+//	curl "http://localhost:8080/api/rates/coverage?minimum=75"
+func CoverageGetHandleFunc(w http.ResponseWriter, r *http.Request) {
+	minimum, err := MinimumFromHTTPRequest(r)
+	if err != nil {
+		WriteError(http.StatusBadRequest, err, &w, r)
+		return
+	}
+
+	coverage := currentWeeklyRates.Coverage()
+	coverage.Minimum = minimum
+	if err = coverage.Validate(minimum); err != nil {
+		coverage.Status = http.StatusUnprocessableEntity
+		coverage.Description = err.Error()
+	}
+
+	WriteResponse(coverage, &w, r)
+}
+
+// MinimumFromHTTPRequest returns the optional "minimum" coverage parameter of the request as a
+// percentage, or 0 if the parameter is not set.
+func MinimumFromHTTPRequest(r *http.Request) (float64, error) {
+	param := r.URL.Query().Get("minimum")
+	if param == "" {
+		return 0, nil
+	}
+
+	minimum, err := strconv.ParseFloat(param, 64)
+	if err != nil || minimum < 0 || minimum > 100 {
+		return 0, newError(CodeInvalidParameter, "minimum", "could not parse 'minimum' parameter [%s]: must be a percentage from 0 to 100", param)
+	}
+	return minimum, nil
+}
@@ -0,0 +1,62 @@
+package api_test
+
+import (
+	"github.com/jtide/gopark/api"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestWeeklyRates_CoverageWithStandardConfig(t *testing.T) {
+	rates := api.NewWeeklyRates()
+	err := rates.Update(jsonStandardConfig)
+	assert.NoError(t, err)
+
+	coverage := rates.Coverage()
+	assert.Len(t, coverage.Days, 7)
+
+	// Thursday only has a rate from 0900 to 2100
+	thursday := coverage.Days[3]
+	assert.Equal(t, "thurs", thursday.Day)
+	assert.Equal(t, 50.0, thursday.Percent)
+	assert.Equal(t, []api.Gap{
+		{StartMinute: 0, EndMinute: 540, Times: "0000-0900"},
+		{StartMinute: 1260, EndMinute: 1440, Times: "2100-2400"},
+	}, thursday.Gaps)
+
+	// Monday has rates from 0100 to 0500 and from 0900 to 2100
+	monday := coverage.Days[0]
+	assert.Equal(t, "mon", monday.Day)
+	assert.Equal(t, []string{"0000-0100", "0500-0900", "2100-2400"}, gapTimes(monday.Gaps))
+
+	// 12 hours for every day, plus 4 hours on mon, wed and sat and 6 hours on tues and sun
+	assert.Equal(t, 64.29, coverage.Percent)
+}
+
+func TestWeeklyRates_CoverageWithFullDay(t *testing.T) {
+	rates := api.NewWeeklyRates()
+	err := rates.Update([]byte(`{"rates": [{"days": "mon", "times": "0000-2400", "price": 100}]}`))
+	assert.NoError(t, err)
+
+	coverage := rates.Coverage()
+	assert.Equal(t, 100.0, coverage.Days[0].Percent)
+	assert.Empty(t, coverage.Days[0].Gaps)
+	assert.Equal(t, 14.29, coverage.Percent)
+}
+
+func TestCoverage_Validate(t *testing.T) {
+	rates := api.NewWeeklyRates()
+	err := rates.Update(jsonStandardConfig)
+	assert.NoError(t, err)
+
+	coverage := rates.Coverage()
+	assert.NoError(t, coverage.Validate(50))
+	assert.EqualError(t, coverage.Validate(75), "rates cover 64.29% of the week, below the minimum of 75%")
+}
+
+func gapTimes(gaps []api.Gap) []string {
+	var times []string
+	for _, gap := range gaps {
+		times = append(times, gap.Times)
+	}
+	return times
+}
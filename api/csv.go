@@ -0,0 +1,240 @@
+package api
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// CSVHeader is the header row of a rate configuration in CSV format.
+var CSVHeader = []string{"days", "times", "price"}
+
+// csvCurrencyColumn is an optional column of a rate configuration in CSV format, with the ISO 4217
+// code of the currency of each price. Every row must have the same currency.
+const csvCurrencyColumn = "currency"
+
+// CSVError reports a problem with a single cell of a rate configuration in CSV format.
+// Rows are numbered from 1, starting with the header row, as in a spreadsheet.
+type CSVError struct {
+	Row    int
+	Column string
+	Err    error
+}
+
+func (e *CSVError) Unwrap() error {
+	return e.Err
+}
+
+func (e *CSVError) Error() string {
+	if e.Column == "" {
+		return fmt.Sprintf("row %d: %v", e.Row, e.Err)
+	}
+	return fmt.Sprintf("row %d, column %q: %v", e.Row, e.Column, e.Err)
+}
+
+// ConfigRatesFromCSV parses a rate configuration in CSV format. The first row must be a header
+// naming the "days", "times" and "price" columns, and optionally a "currency" column, in any order.
+// Each following row is one rate, for example:
+//
+//	days,times,price
+//	"mon,tues,thurs",0900-2100,1500
+//
+// Values are checked as they are read, so that an error names the row and column it came from.
+func ConfigRatesFromCSV(r io.Reader) (ConfigRates, error) {
+	config := ConfigRates{}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		if parseErr, ok := err.(*csv.ParseError); ok {
+			return config, &CSVError{Row: parseErr.Line, Column: "", Err: newError(CodeInvalidBody, "", "%w", parseErr.Err)}
+		}
+		return config, newError(CodeInvalidBody, "", "could not read CSV to update rates: %w", err)
+	}
+	if len(records) == 0 {
+		return config, &CSVError{Row: 1, Column: "", Err: newError(CodeInvalidBody, "", "missing header row")}
+	}
+
+	columns, err := csvColumns(records[0])
+	if err != nil {
+		return config, err
+	}
+
+	for i, record := range records[1:] {
+		row := i + 2
+		if len(record) != len(columns) {
+			return config, &CSVError{Row: row, Column: "", Err: newError(CodeInvalidBody, "", "expected %d columns, found %d", len(columns), len(record))}
+		}
+
+		rate := ConfigRate{}
+		for j, column := range columns {
+			var err error
+			if column == csvCurrencyColumn {
+				err = setCSVCurrency(&config, record[j])
+			} else {
+				err = setCSVField(&rate, column, record[j])
+			}
+			if err != nil {
+				return config, &CSVError{Row: row, Column: column, Err: err}
+			}
+		}
+		config.Rates = append(config.Rates, rate)
+	}
+
+	return config, nil
+}
+
+// CSV returns the rate configuration in CSV format, with a header row. The currency column is
+// only included if the configuration has a currency. The output can be parsed again with
+// ConfigRatesFromCSV. Charges, vehicle classes, ladders, special rates, grace periods, reservation
+// settings and occupancy bands cannot be written as CSV, so ErrNoEncoding is returned for a configuration with any of them.
+func (c ConfigRates) CSV() ([]byte, error) {
+	if unsupported := c.csvUnsupported(); unsupported != "" {
+		return nil, fmt.Errorf("%s can only be exported as JSON: %w", unsupported, ErrNoEncoding)
+	}
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+
+	header := CSVHeader
+	if c.Currency != "" {
+		header = append(append([]string{}, CSVHeader...), csvCurrencyColumn)
+	}
+	if err := writer.Write(header); err != nil {
+		return nil, err
+	}
+	for _, rate := range c.Rates {
+		record := []string{rate.Days, rate.Times, strconv.FormatUint(uint64(rate.Price), 10)}
+		if c.Currency != "" {
+			record = append(record, c.Currency)
+		}
+		if err := writer.Write(record); err != nil {
+			return nil, err
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// csvUnsupported returns the name of the first part of the configuration that cannot be written as
+// CSV, or an empty string if it can be.
+func (c ConfigRates) csvUnsupported() string {
+	if len(c.Charges) > 0 {
+		return "charges"
+	} else if c.DefaultVehicle != "" {
+		return "vehicle classes"
+	} else if len(c.Specials) > 0 {
+		return "special rates"
+	} else if c.Grace != nil {
+		return "grace periods"
+	} else if c.Capacity != 0 || len(c.Refunds) > 0 {
+		return "reservation settings"
+	}
+	for _, rate := range c.Rates {
+		if len(rate.Charges) > 0 {
+			return "charges"
+		} else if len(rate.Vehicles) > 0 {
+			return "vehicle classes"
+		} else if rate.Ladder != nil {
+			return "ladders"
+		} else if rate.Grace != nil {
+			return "grace periods"
+		} else if len(rate.Occupancy) > 0 {
+			return "occupancy bands"
+		}
+	}
+	return ""
+}
+
+// csvColumns validates the header row and returns the normalized column names in order.
+func csvColumns(header []string) ([]string, error) {
+	var columns []string
+	seen := make(map[string]bool)
+
+	for i, name := range header {
+		column := strings.ToLower(strings.TrimSpace(name))
+		if !isCSVColumn(column) {
+			return nil, &CSVError{Row: 1, Column: name, Err: newError(CodeInvalidBody, "", "unknown column %d, expected one of %s or %s", i+1, strings.Join(CSVHeader, ", "), csvCurrencyColumn)}
+		}
+		if seen[column] {
+			return nil, &CSVError{Row: 1, Column: name, Err: newError(CodeInvalidBody, column, "duplicate column")}
+		}
+		seen[column] = true
+		columns = append(columns, column)
+	}
+
+	for _, column := range CSVHeader {
+		if !seen[column] {
+			return nil, &CSVError{Row: 1, Column: column, Err: newError(CodeInvalidBody, column, "missing column")}
+		}
+	}
+
+	return columns, nil
+}
+
+func isCSVColumn(column string) bool {
+	if column == csvCurrencyColumn {
+		return true
+	}
+	for _, name := range CSVHeader {
+		if column == name {
+			return true
+		}
+	}
+	return false
+}
+
+// setCSVCurrency checks the currency of a CSV row, which must be the same as any previous row, and
+// stores it in the configuration.
+func setCSVCurrency(config *ConfigRates, value string) error {
+	currency, err := CurrencyFromCode(value)
+	if err != nil {
+		return err
+	}
+	if config.Currency != "" && config.Currency != currency.Code {
+		return newError(CodeCurrencyMismatch, "currency", "currency %s differs from %s in previous rows", currency.Code, config.Currency)
+	}
+	config.Currency = currency.Code
+	return nil
+}
+
+// setCSVField parses and checks a single value from a CSV row and stores it in the rate.
+func setCSVField(rate *ConfigRate, column string, value string) error {
+	value = strings.TrimSpace(value)
+
+	switch column {
+	case "days":
+		var days []string
+		for _, day := range strings.Split(value, ",") {
+			day = strings.ToLower(strings.TrimSpace(day))
+			if _, err := WeekdayFromString(day); err != nil {
+				return err
+			}
+			days = append(days, day)
+		}
+		rate.Days = strings.Join(days, ",")
+	case "times":
+		if _, _, err := TimeRangeFromConfigString(value); err != nil {
+			return err
+		}
+		rate.Times = value
+	case "price":
+		price, err := strconv.ParseUint(value, 10, 0)
+		if err != nil {
+			return newError(CodeInvalidPrice, "price", "invalid price '%s', must be a non-negative whole number", value)
+		}
+		rate.Price = uint(price)
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package api_test
+
+import (
+	"github.com/jtide/gopark/api"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+var csvStandardConfig = `days,times,price
+"mon,tues,thurs",0900-2100,1500
+"fri,sat,sun",0900-2100,2000
+wed,0600-1800,1750
+"mon,wed,sat",0100-0500,1000
+"sun,tues",0100-0700,925
+`
+
+func TestConfigRatesFromCSV(t *testing.T) {
+	config, err := api.ConfigRatesFromCSV(strings.NewReader(csvStandardConfig))
+	assert.NoError(t, err)
+
+	expected, err := api.ConfigRatesFromJSON(jsonStandardConfig)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, config)
+}
+
+func TestConfigRatesFromCSVWithReorderedColumns(t *testing.T) {
+	csv := "Price, Times, Days\n1500, 0900-2100, \"mon, tues\"\n"
+	config, err := api.ConfigRatesFromCSV(strings.NewReader(csv))
+	assert.NoError(t, err)
+	assert.Equal(t, []api.ConfigRate{{Days: "mon,tues", Times: "0900-2100", Price: 1500}}, config.Rates)
+}
+
+func TestConfigRatesFromCSVWithInvalidPrice(t *testing.T) {
+	csv := "days,times,price\nmon,0900-2100,1500\ntues,0900-2100,15.00\n"
+	_, err := api.ConfigRatesFromCSV(strings.NewReader(csv))
+	assert.EqualError(t, err, `row 3, column "price": invalid price '15.00', must be a non-negative whole number`)
+}
+
+func TestConfigRatesFromCSVWithInvalidDay(t *testing.T) {
+	csv := "days,times,price\n\"mon,someday\",0900-2100,1500\n"
+	_, err := api.ConfigRatesFromCSV(strings.NewReader(csv))
+	assert.EqualError(t, err, `row 2, column "days": 'someday' is not a recognized weekday`)
+}
+
+func TestConfigRatesFromCSVWithInvalidTimes(t *testing.T) {
+	csv := "days,times,price\nmon,0900-2160,1500\n"
+	_, err := api.ConfigRatesFromCSV(strings.NewReader(csv))
+	assert.EqualError(t, err, `row 2, column "times": invalid end time: invalid minutes in time: 2160`)
+}
+
+func TestConfigRatesFromCSVWithMissingColumn(t *testing.T) {
+	csv := "days,times\nmon,0900-2100\n"
+	_, err := api.ConfigRatesFromCSV(strings.NewReader(csv))
+	assert.EqualError(t, err, `row 1, column "price": missing column`)
+}
+
+func TestConfigRatesFromCSVWithShortRow(t *testing.T) {
+	csv := "days,times,price\nmon,0900-2100\n"
+	_, err := api.ConfigRatesFromCSV(strings.NewReader(csv))
+	assert.EqualError(t, err, "row 2: expected 3 columns, found 2")
+}
+
+func TestWeeklyRates_ConfigRoundTrip(t *testing.T) {
+	rates := api.NewWeeklyRates()
+	err := rates.Update(jsonStandardConfig)
+	assert.NoError(t, err)
+
+	csv, err := rates.Config().CSV()
+	assert.NoError(t, err)
+
+	config, err := api.ConfigRatesFromCSV(strings.NewReader(string(csv)))
+	assert.NoError(t, err)
+
+	ratesCopy := api.NewWeeklyRates()
+	err = ratesCopy.UpdateWithConfig(config)
+	assert.NoError(t, err)
+	assert.Equal(t, rates, ratesCopy)
+}
+
+func TestWeeklyRates_ConfigCombinesDays(t *testing.T) {
+	rates := api.NewWeeklyRates()
+	err := rates.Update(jsonStandardConfig)
+	assert.NoError(t, err)
+
+	config := rates.Config()
+	assert.Len(t, config.Rates, 5)
+	assert.Equal(t, api.ConfigRate{Days: "mon,wed,sat", Times: "0100-0500", Price: 1000}, config.Rates[0])
+	assert.Equal(t, api.ConfigRate{Days: "mon,tues,thurs", Times: "0900-2100", Price: 1500}, config.Rates[1])
+}
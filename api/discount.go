@@ -0,0 +1,479 @@
+package api
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Types of Discount.
+const (
+	DiscountPercent     = "percent"
+	DiscountAmount      = "amount"
+	DiscountFreeMinutes = "free_minutes"
+	DiscountFixedPrice  = "fixed_price"
+)
+
+// Discount is a code that lowers the price of a quote, such as a promotion or a validation by a
+// local Merchant. A percent discount takes a Percent off the price, an amount discount takes an
+// Amount off, a free_minutes discount makes that many Minutes of the stay free, and a fixed_price
+// discount lowers the price to the Amount, which must be greater than 0. Amounts are in the minor unit
+// of the currency of the rates.
+//
+// A discount only applies to stays that start from ValidFrom and before ValidUntil, when they are
+// set, and can be redeemed at most MaxUses times, when it is not 0. A discount is redeemed when a
+// session it applies to is checked out, or a reservation it applies to is booked.
+type Discount struct {
+	Code       string     `json:"code"`
+	Type       string     `json:"type"`
+	Merchant   string     `json:"merchant,omitempty"`
+	Percent    float64    `json:"percent,omitempty"`
+	Amount     uint       `json:"amount,omitempty"`
+	Minutes    uint64     `json:"minutes,omitempty"`
+	ValidFrom  *time.Time `json:"valid_from,omitempty"`
+	ValidUntil *time.Time `json:"valid_until,omitempty"`
+	MaxUses    uint       `json:"max_uses,omitempty"`
+	Uses       uint       `json:"uses"`
+}
+
+// Validate returns an error if the discount has no code, or does not have the values its type needs.
+func (d Discount) Validate() error {
+	if d.Code == "" || strings.ContainsAny(d.Code, ", \t\n") {
+		return newError(CodeInvalidDiscount, "discounts", "invalid code '%s', must not be empty or contain spaces or commas", d.Code)
+	}
+
+	switch d.Type {
+	case DiscountPercent:
+		if d.Percent <= 0 || d.Percent > 100 {
+			return newError(CodeInvalidDiscount, "discounts", "invalid percent %v for discount '%s', must be greater than 0 and at most 100", d.Percent, d.Code)
+		}
+	case DiscountAmount, DiscountFixedPrice:
+		if d.Amount == 0 {
+			return newError(CodeInvalidDiscount, "discounts", "discount '%s' must have an amount greater than 0", d.Code)
+		}
+	case DiscountFreeMinutes:
+		if d.Minutes == 0 {
+			return newError(CodeInvalidDiscount, "discounts", "discount '%s' must have minutes greater than 0", d.Code)
+		}
+	default:
+		return newError(CodeInvalidDiscount, "discounts", "invalid type '%s' for discount '%s', must be one of \"%s\", \"%s\", \"%s\" or \"%s\"",
+			d.Type, d.Code, DiscountPercent, DiscountAmount, DiscountFreeMinutes, DiscountFixedPrice)
+	}
+
+	if d.ValidFrom != nil && d.ValidUntil != nil && !d.ValidFrom.Before(*d.ValidUntil) {
+		return newError(CodeInvalidDiscount, "discounts", "discount '%s' must be valid from before it is valid until", d.Code)
+	}
+	return nil
+}
+
+// unavailable returns the reason the discount cannot be used at a time, or an empty string if it can.
+func (d Discount) unavailable(at time.Time) string {
+	switch {
+	case d.ValidFrom != nil && at.Before(*d.ValidFrom):
+		return fmt.Sprintf("not valid until %v", d.ValidFrom.Format(time.RFC3339))
+	case d.ValidUntil != nil && !at.Before(*d.ValidUntil):
+		return fmt.Sprintf("expired at %v", d.ValidUntil.Format(time.RFC3339))
+	case d.MaxUses > 0 && d.Uses >= d.MaxUses:
+		return fmt.Sprintf("usage limit of %d reached", d.MaxUses)
+	}
+	return ""
+}
+
+// off returns the amount the discount takes off a price for a stay of a number of minutes. Free
+// minutes take the same share of the price as of the stay. Amounts are rounded half up to the minor
+// unit, and are never more than the price.
+func (d Discount) off(price uint, minutes uint64) uint {
+	var off uint
+	switch d.Type {
+	case DiscountPercent:
+		off = uint(math.Round(float64(price) * d.Percent / 100))
+	case DiscountAmount:
+		off = d.Amount
+	case DiscountFreeMinutes:
+		off = price
+		if minutes > d.Minutes {
+			off = uint(math.Round(float64(price) * float64(d.Minutes) / float64(minutes)))
+		}
+	case DiscountFixedPrice:
+		if d.Amount < price {
+			off = price - d.Amount
+		}
+	}
+	if off > price {
+		return price
+	}
+	return off
+}
+
+// describe returns the description of the discount for the adjustment line of a quote.
+func (d Discount) describe(q Quote) string {
+	var description string
+	switch d.Type {
+	case DiscountPercent:
+		description = fmt.Sprintf("%s (%s%% off)", d.Code, strconv.FormatFloat(d.Percent, 'f', -1, 64))
+	case DiscountAmount:
+		description = fmt.Sprintf("%s (%s off)", d.Code, q.format(int(d.Amount)))
+	case DiscountFreeMinutes:
+		description = fmt.Sprintf("%s (%d free minutes)", d.Code, d.Minutes)
+	case DiscountFixedPrice:
+		description = fmt.Sprintf("%s (fixed price %s)", d.Code, q.format(int(d.Amount)))
+	}
+	if d.Merchant != "" {
+		description += ", validated by " + d.Merchant
+	}
+	return description
+}
+
+// DiscountResult reports whether a code given for a quote was Applied, and the Amount it took off
+// the price. The Reason explains why a code was not applied.
+type DiscountResult struct {
+	Code    string `json:"code"`
+	Applied bool   `json:"applied"`
+	Amount  uint   `json:"amount,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// describe returns the result for display, such as "SUMMER10 applied" or "WINTER rejected: expired
+// at 2015-03-01T00:00:00Z".
+func (r DiscountResult) describe() string {
+	if r.Applied {
+		return r.Code + " applied"
+	}
+	return fmt.Sprintf("%s rejected: %s", r.Code, r.Reason)
+}
+
+// describeDiscounts returns the description of each result.
+func describeDiscounts(results []DiscountResult) []string {
+	var descriptions []string
+	for _, result := range results {
+		descriptions = append(descriptions, result.describe())
+	}
+	return descriptions
+}
+
+// Discounts are the discount codes of the facility. They are safe for concurrent use, since quotes
+// read the number of uses of a code while it may be redeemed.
+type Discounts struct {
+	mu        sync.Mutex
+	discounts map[string]Discount
+}
+
+// currentDiscounts are the discount codes used by quotes of the API.
+var currentDiscounts = NewDiscounts()
+
+// NewDiscounts returns an empty set of discount codes.
+func NewDiscounts() *Discounts {
+	return &Discounts{discounts: make(map[string]Discount)}
+}
+
+// normalizeCode returns a code in the form it is stored in, so that codes are not case sensitive.
+func normalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Replace removes all of the discount codes and adds new ones. No codes are changed if any of the
+// new discounts is invalid.
+func (ds *Discounts) Replace(discounts []Discount) error {
+	added, err := validateDiscounts(discounts, nil)
+	if err != nil {
+		return err
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	ds.discounts = added
+	return nil
+}
+
+// Add adds new discount codes. No codes are added if any of the discounts is invalid, or has the
+// code of an existing discount.
+func (ds *Discounts) Add(discounts []Discount) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	added, err := validateDiscounts(discounts, ds.discounts)
+	if err != nil {
+		return err
+	}
+	for code, discount := range added {
+		ds.discounts[code] = discount
+	}
+	return nil
+}
+
+// validateDiscounts returns the discounts by their normalized code, or an error for the first
+// discount that is invalid or has a code that is repeated or already exists.
+func validateDiscounts(discounts []Discount, existing map[string]Discount) (map[string]Discount, error) {
+	added := make(map[string]Discount)
+	for _, discount := range discounts {
+		discount.Code = normalizeCode(discount.Code)
+		if err := discount.Validate(); err != nil {
+			return nil, err
+		}
+		if _, ok := existing[discount.Code]; ok {
+			return nil, newError(CodeInvalidDiscount, "discounts", "discount '%s' already exists", discount.Code)
+		} else if _, ok := added[discount.Code]; ok {
+			return nil, newError(CodeInvalidDiscount, "discounts", "discount '%s' is repeated", discount.Code)
+		}
+		added[discount.Code] = discount
+	}
+	return added, nil
+}
+
+// List returns every discount, ordered by code.
+func (ds *Discounts) List() []Discount {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	list := []Discount{}
+	for _, discount := range ds.discounts {
+		list = append(list, discount)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Code < list[j].Code })
+	return list
+}
+
+// Redeem records a use of a discount code for a stay that starts at a time, and returns the discount.
+// It returns an error if the code does not exist, or cannot be used for that stay. The validity of
+// the code is checked against the start of the stay, as it is by quotes.
+func (ds *Discounts) Redeem(code string, at time.Time) (Discount, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	discount, ok := ds.discounts[normalizeCode(code)]
+	if !ok {
+		return Discount{}, newError(CodeDiscountNotFound, "code", "no discount exists for code '%s'", code)
+	}
+	if reason := discount.unavailable(at); reason != "" {
+		return Discount{}, newError(CodeDiscountUnavailable, "code", "discount '%s' cannot be redeemed: %s", discount.Code, reason)
+	}
+
+	discount.Uses++
+	ds.discounts[discount.Code] = discount
+	return discount, nil
+}
+
+// redeem records a use of the discount applied to a quote for a duration, if one was. It returns an
+// error if the code has since reached its usage limit.
+func (ds *Discounts) redeem(q Quote, d Duration) error {
+	if ds == nil {
+		return nil
+	}
+	for _, result := range q.Discounts {
+		if result.Applied {
+			_, err := ds.Redeem(result.Code, d.Start)
+			return err
+		}
+	}
+	return nil
+}
+
+// apply adds the largest discount of the codes to the price of a quote for a duration, after any
+// cap, and a result for each code. Only one discount applies to a quote, and the others are rejected.
+// Quotes do not use a code, which is only used when it is redeemed.
+func (ds *Discounts) apply(q *Quote, d Duration, codes []string) {
+	if len(codes) == 0 {
+		return
+	}
+
+	var found map[string]Discount
+	if ds != nil {
+		ds.mu.Lock()
+		defer ds.mu.Unlock()
+		found = ds.discounts
+	}
+
+	minutes := d.minutes()
+	best := -1
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		code = normalizeCode(code)
+		if seen[code] {
+			continue
+		}
+		seen[code] = true
+
+		result := DiscountResult{Code: code}
+		discount, ok := found[code]
+		switch {
+		case !ok:
+			result.Reason = "unknown code"
+		case discount.unavailable(d.Start) != "":
+			result.Reason = discount.unavailable(d.Start)
+		default:
+			result.Amount = discount.off(q.total(), minutes)
+			if result.Amount == 0 {
+				result.Reason = "does not lower the price"
+			} else if best < 0 || result.Amount > q.Discounts[best].Amount {
+				best = len(q.Discounts)
+			}
+		}
+		q.Discounts = append(q.Discounts, result)
+	}
+
+	if best < 0 {
+		return
+	}
+	for i := range q.Discounts {
+		if i == best {
+			q.Discounts[i].Applied = true
+		} else if q.Discounts[i].Reason == "" {
+			q.Discounts[i].Reason = fmt.Sprintf("code %s gives a larger discount", q.Discounts[best].Code)
+		}
+	}
+
+	applied := q.Discounts[best]
+	q.Adjustments = append(q.Adjustments, Adjustment{Type: "discount", Description: found[applied.Code].describe(*q), Amount: -int(applied.Amount)})
+}
+
+// CodesFromHTTPRequest returns the discount codes in the optional "code" parameters of a request,
+// which may be repeated or list several codes separated by commas.
+func CodesFromHTTPRequest(r *http.Request) []string {
+	var codes []string
+	for _, param := range r.URL.Query()["code"] {
+		for _, code := range strings.Split(param, ",") {
+			if code = strings.TrimSpace(code); code != "" {
+				codes = append(codes, code)
+			}
+		}
+	}
+	return codes
+}
+
+// ConfigDiscounts are used to add or replace discount codes.
+type ConfigDiscounts struct {
+	Discounts []Discount `json:"discounts" xml:"Discount"`
+}
+
+// ConfigDiscountsFromJSON parses a discount configuration specified in JSON format.
+func ConfigDiscountsFromJSON(jsonConfig []byte) (ConfigDiscounts, error) {
+	config := ConfigDiscounts{}
+	if err := json.Unmarshal(jsonConfig, &config); err != nil {
+		code, field := CodeInvalidBody, ""
+		if _, ok := err.(*json.UnmarshalTypeError); ok {
+			code, field = CodeInvalidDiscount, "discounts"
+		}
+		return config, newError(code, field, "could not parse JSON to update discounts : %w", err)
+	}
+	return config, nil
+}
+
+// DiscountList is the response for a list of discount codes.
+type DiscountList struct {
+	Status    uint       `json:"status"`
+	Discounts []Discount `json:"discounts" xml:"Discount"`
+}
+
+// JSON implementation for WebFormatter interface.
+func (l DiscountList) JSON() ([]byte, error) {
+	return json.Marshal(l)
+}
+
+// XML implementation for WebFormatter interface.
+func (l DiscountList) XML() ([]byte, error) {
+	return xml.Marshal(l)
+}
+
+// StatusCode implementation for WebFormatter interface.
+func (l DiscountList) StatusCode() uint {
+	return l.Status
+}
+
+// DiscountsHandleFunc is the top-level handler for requests to the /api/discounts endpoint, which
+// lists, replaces and adds discount codes.
+func DiscountsHandleFunc(w http.ResponseWriter, r *http.Request) {
+	r, ok := InitializeResponse(&w, r) // Required before WriteResponse
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		WriteResponse(DiscountList{Status: http.StatusOK, Discounts: currentDiscounts.List()}, &w, r)
+	case http.MethodPut, http.MethodPost:
+		DiscountsUpdateHandleFunc(w, r)
+	default:
+		err := methodNotSupported(r.Method)
+		WriteError(http.StatusBadRequest, err, &w, r)
+	}
+}
+
+// DiscountsUpdateHandleFunc replaces all discount codes with those in the body of a Put request, or
+// adds those in the body of a Post request. The body must be in JSON format.
+//
+// Example:
+//
+//	curl -X POST -H "Content-Type: application/json" -d '{"discounts":[{"code":"SUMMER10","type":"percent","percent":10}]}' "http://localhost:8080/api/discounts"
+func DiscountsUpdateHandleFunc(w http.ResponseWriter, r *http.Request) {
+	jsonConfig, err := JSONFromRequestBody(r)
+	if err != nil {
+		WriteError(http.StatusBadRequest, err, &w, r)
+		return
+	}
+	config, err := ConfigDiscountsFromJSON(jsonConfig)
+	if err != nil {
+		WriteError(http.StatusBadRequest, err, &w, r)
+		return
+	}
+
+	description := "added discounts"
+	if r.Method == http.MethodPut {
+		description = "replaced discounts"
+		err = currentDiscounts.Replace(config.Discounts)
+	} else {
+		err = currentDiscounts.Add(config.Discounts)
+	}
+	if err != nil {
+		WriteError(http.StatusBadRequest, fmt.Errorf("failed to update discounts: %w", err), &w, r)
+		return
+	}
+
+	WriteResponse(APIStandardResponse{Status: http.StatusOK, Description: description}, &w, r)
+}
+
+// RedeemHandleFunc records a use of the discount code in the "code" parameter of a Post request to
+// the /api/discounts/redeem endpoint, for a stay that starts at the optional "start" parameter or the
+// current time, and returns the discount. Codes are redeemed by check-outs and bookings, so this is
+// only needed for stays that are paid for elsewhere.
+//
+// Example:
+//
+//	curl -X POST "http://localhost:8080/api/discounts/redeem?code=SUMMER10"
+func RedeemHandleFunc(w http.ResponseWriter, r *http.Request) {
+	r, ok := InitializeResponse(&w, r) // Required before WriteResponse
+	if !ok {
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		WriteError(http.StatusBadRequest, methodNotSupported(r.Method), &w, r)
+		return
+	}
+
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		err := newError(CodeMissingParameter, "code", "the 'code' parameter is required to redeem a discount")
+		WriteError(http.StatusBadRequest, err, &w, r)
+		return
+	}
+
+	start, err := timeFromHTTPRequest(r, "start", CodeInvalidStart)
+	if err != nil {
+		WriteError(http.StatusBadRequest, err, &w, r)
+		return
+	}
+	discount, err := currentDiscounts.Redeem(code, start)
+	if err != nil {
+		WriteError(http.StatusBadRequest, err, &w, r)
+		return
+	}
+
+	WriteResponse(DiscountList{Status: http.StatusOK, Discounts: []Discount{discount}}, &w, r)
+}
@@ -0,0 +1,205 @@
+package api_test
+
+import (
+	"encoding/json"
+	"github.com/jtide/gopark/api"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var jsonDiscountsConfig = []byte(`{
+	"discounts": [
+		{"code": "summer10", "type": "percent", "percent": 10},
+		{"code": "SAVE5", "type": "amount", "amount": 500},
+		{"code": "DINER", "type": "free_minutes", "minutes": 60, "merchant": "Main St Diner"},
+		{"code": "EVENT", "type": "fixed_price", "amount": 1000,
+		 "valid_from": "2015-07-01T00:00:00Z", "valid_until": "2015-07-02T00:00:00Z"},
+		{"code": "ONCE", "type": "amount", "amount": 100, "max_uses": 1}
+	]
+}`)
+
+func newDiscounts(t *testing.T) *api.Discounts {
+	config, err := api.ConfigDiscountsFromJSON(jsonDiscountsConfig)
+	assert.NoError(t, err)
+	discounts := api.NewDiscounts()
+	assert.NoError(t, discounts.Replace(config.Discounts))
+	return discounts
+}
+
+func quoteDiscounts(t *testing.T, discounts *api.Discounts, start string, end string, codes ...string) api.Quote {
+	rates := api.NewWeeklyRates()
+	assert.NoError(t, rates.Update(api.JSONDefaultRateConfig))
+	duration, err := api.ParseDuration(start, end)
+	assert.NoError(t, err)
+	quote, err := rates.QuoteWithOptions(duration, api.QuoteOptions{Discounts: discounts, Codes: codes})
+	assert.NoError(t, err)
+	return quote
+}
+
+func TestQuoteWithOptionsDiscounts(t *testing.T) {
+	discounts := newDiscounts(t)
+
+	tests := []struct {
+		code        string
+		amount      uint
+		description string
+	}{
+		{"summer10", 175, "SUMMER10 (10% off)"},
+		{"SAVE5", 500, "SAVE5 ($5.00 off)"},
+		{"DINER", 350, "DINER (60 free minutes), validated by Main St Diner"},
+		{"EVENT", 750, "EVENT (fixed price $10.00)"},
+	}
+
+	// A stay of 300 minutes on Wednesday at $17.50
+	for _, test := range tests {
+		quote := quoteDiscounts(t, discounts, "2015-07-01T07:00:00Z", "2015-07-01T12:00:00Z", test.code)
+		assert.Equal(t, []api.DiscountResult{{Code: strings.ToUpper(test.code), Applied: true, Amount: test.amount}}, quote.Discounts)
+		assert.Equal(t, []api.Adjustment{{Type: "discount", Description: test.description, Amount: -int(test.amount)}}, quote.Adjustments)
+		assert.Equal(t, 1750-test.amount, quote.Total, test.code)
+	}
+
+	// Free minutes cover a short stay
+	quote := quoteDiscounts(t, discounts, "2015-07-01T07:00:00Z", "2015-07-01T07:45:00Z", "DINER")
+	assert.Equal(t, uint(0), quote.Total)
+}
+
+func TestQuoteWithOptionsDiscountsAppliesLargest(t *testing.T) {
+	discounts := newDiscounts(t)
+
+	quote := quoteDiscounts(t, discounts, "2015-07-01T07:00:00Z", "2015-07-01T12:00:00Z", "SUMMER10", "EVENT", "nope", "SAVE5")
+	assert.Equal(t, []api.DiscountResult{
+		{Code: "SUMMER10", Amount: 175, Reason: "code EVENT gives a larger discount"},
+		{Code: "EVENT", Applied: true, Amount: 750},
+		{Code: "NOPE", Reason: "unknown code"},
+		{Code: "SAVE5", Amount: 500, Reason: "code EVENT gives a larger discount"},
+	}, quote.Discounts)
+	assert.Equal(t, uint(1000), quote.Total)
+
+	// Outside of its validity window, the event code is rejected
+	quote = quoteDiscounts(t, discounts, "2015-07-08T07:00:00Z", "2015-07-08T12:00:00Z", "SUMMER10", "EVENT")
+	assert.Equal(t, []api.DiscountResult{
+		{Code: "SUMMER10", Applied: true, Amount: 175},
+		{Code: "EVENT", Reason: "expired at 2015-07-02T00:00:00Z"},
+	}, quote.Discounts)
+
+	// A fixed price above the price does not lower it
+	quote = quoteDiscounts(t, discounts, "2015-07-01T02:00:00Z", "2015-07-01T04:00:00Z", "EVENT")
+	assert.Equal(t, []api.DiscountResult{{Code: "EVENT", Reason: "does not lower the price"}}, quote.Discounts)
+	assert.Equal(t, uint(1000), quote.Total)
+}
+
+func TestQuoteWithOptionsDiscountsBeforeCharges(t *testing.T) {
+	rates := api.NewWeeklyRates()
+	err := rates.Update([]byte(`{
+		"charges": [{"name": "City parking tax", "type": "tax", "percent": 10}],
+		"rates": [{"days": "wed", "times": "0600-1800", "price": 2000}]
+	}`))
+	assert.NoError(t, err)
+
+	duration, err := api.ParseDuration("2015-07-01T07:00:00Z", "2015-07-01T12:00:00Z")
+	assert.NoError(t, err)
+	quote, err := rates.QuoteWithOptions(duration, api.QuoteOptions{Discounts: newDiscounts(t), Codes: []string{"SAVE5"}})
+	assert.NoError(t, err)
+
+	// The tax is on the discounted price
+	assert.Equal(t, -500, quote.Adjustments[0].Amount)
+	assert.Equal(t, 150, quote.Adjustments[1].Amount)
+	assert.Equal(t, uint(1650), quote.Total)
+}
+
+func TestDiscountsRedeem(t *testing.T) {
+	discounts := newDiscounts(t)
+	at := time.Date(2015, 7, 1, 7, 0, 0, 0, time.UTC)
+
+	discount, err := discounts.Redeem("once", at)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1), discount.Uses)
+
+	_, err = discounts.Redeem("ONCE", at)
+	code, field := api.ErrorCode(err, 400)
+	assert.Equal(t, api.CodeDiscountUnavailable, code)
+	assert.Equal(t, "code", field)
+
+	// A used up code is rejected by quotes
+	quote := quoteDiscounts(t, discounts, "2015-07-01T07:00:00Z", "2015-07-01T12:00:00Z", "ONCE")
+	assert.Equal(t, []api.DiscountResult{{Code: "ONCE", Reason: "usage limit of 1 reached"}}, quote.Discounts)
+
+	_, err = discounts.Redeem("EVENT", at.AddDate(0, 0, 7))
+	code, _ = api.ErrorCode(err, 400)
+	assert.Equal(t, api.CodeDiscountUnavailable, code)
+
+	_, err = discounts.Redeem("nope", at)
+	code, _ = api.ErrorCode(err, 400)
+	assert.Equal(t, api.CodeDiscountNotFound, code)
+}
+
+func TestDiscountsAddInvalid(t *testing.T) {
+	configs := []string{
+		`{"discounts": [{"code": "", "type": "percent", "percent": 10}]}`,
+		`{"discounts": [{"code": "TWO WORDS", "type": "percent", "percent": 10}]}`,
+		`{"discounts": [{"code": "HALF", "type": "percent", "percent": 150}]}`,
+		`{"discounts": [{"code": "SAVE", "type": "amount"}]}`,
+		`{"discounts": [{"code": "FREE", "type": "free_minutes"}]}`,
+		`{"discounts": [{"code": "BOGO", "type": "bogo"}]}`,
+		`{"discounts": [{"code": "LATE", "type": "percent", "percent": 10, "valid_from": "2015-07-02T00:00:00Z", "valid_until": "2015-07-01T00:00:00Z"}]}`,
+		`{"discounts": [{"code": "save5", "type": "amount", "amount": 100}]}`,
+		`{"discounts": [{"code": "NEW", "type": "amount", "amount": 100}, {"code": "new", "type": "amount", "amount": 100}]}`,
+		`{"discounts": [{"code": "NEG", "type": "amount", "amount": -100}]}`,
+		`{"discounts": [{"code": "FREE", "type": "fixed_price"}]}`,
+	}
+
+	for _, config := range configs {
+		discounts := newDiscounts(t)
+		parsed, err := api.ConfigDiscountsFromJSON([]byte(config))
+		if err == nil {
+			err = discounts.Add(parsed.Discounts)
+		}
+		code, field := api.ErrorCode(err, 400)
+		assert.Equal(t, api.CodeInvalidDiscount, code, config)
+		assert.Equal(t, "discounts", field, config)
+		assert.Len(t, discounts.List(), 5, config)
+	}
+}
+
+func TestDiscountsHandleFunc(t *testing.T) {
+	err := api.ReplaceRates(api.JSONDefaultRateConfig)
+	assert.NoError(t, err)
+
+	request := func(method string, target string, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		api.NewServeMux().ServeHTTP(w, r)
+		return w
+	}
+
+	w := request(http.MethodPut, "/api/discounts", string(jsonDiscountsConfig))
+	assert.Equal(t, http.StatusOK, w.Code)
+	defer request(http.MethodPut, "/api/discounts", `{"discounts": []}`)
+
+	w = request(http.MethodGet, "/api/rate?start=2015-07-01T07:00:00Z&end=2015-07-01T12:00:00Z&code=summer10,expired&code=SAVE5", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var rate api.Rate
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &rate))
+	assert.Equal(t, uint(1250), rate.Price)
+	assert.Len(t, rate.Discounts, 3)
+	assert.True(t, rate.Discounts[2].Applied)
+
+	w = request(http.MethodPost, "/api/discounts/redeem?code=once", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"uses":1`)
+	w = request(http.MethodPost, "/api/discounts/redeem?code=once", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"discount_unavailable"`)
+
+	w = request(http.MethodGet, "/api/discounts", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var list api.DiscountList
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Len(t, list.Discounts, 5)
+	assert.Equal(t, "DINER", list.Discounts[0].Code)
+}
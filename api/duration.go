@@ -3,6 +3,7 @@ package api
 import (
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 )
 
@@ -12,6 +13,11 @@ type Duration struct {
 	Value time.Duration `json:"duration"`
 }
 
+// minutes returns the number of whole minutes of the stay.
+func (d Duration) minutes() uint64 {
+	return uint64(d.End.Sub(d.Start).Minutes())
+}
+
 // Print a representation of Duration to stdout
 func (d Duration) Print() {
 	// For initial debug purposes...
@@ -32,17 +38,17 @@ func ParseDuration(startParam string, endParam string) (Duration, error) {
 
 	startTime, err := time.Parse(time.RFC3339, startParam)
 	if err != nil {
-		return duration, fmt.Errorf("could not parse 'start' parameter [%s]: %v", startParam, err)
+		return duration, newError(CodeInvalidStart, "start", "could not parse 'start' parameter [%s]: %w", startParam, err)
 	}
 
 	endTime, err := time.Parse(time.RFC3339, endParam)
 	if err != nil {
-		return duration, fmt.Errorf("could not parse 'end' parameter [%s]: %v", endParam, err)
+		return duration, newError(CodeInvalidEnd, "end", "could not parse 'end' parameter [%s]: %w", endParam, err)
 	}
 
 	// The end time must come after the start time.
 	if endTime.Before(startTime) {
-		return duration, fmt.Errorf("end time occurs before start time")
+		return duration, newError(CodeEndBeforeStart, "end", "end time occurs before start time")
 	}
 
 	// Calculate duration from start to end.
@@ -54,7 +60,22 @@ func ParseDuration(startParam string, endParam string) (Duration, error) {
 }
 
 func DurationFromHTTPRequest(r *http.Request) (Duration, error) {
-	startParam := r.URL.Query()["start"][0]
-	endParam := r.URL.Query()["end"][0]
+	startParam := r.URL.Query().Get("start")
+	endParam := r.URL.Query().Get("end")
 	return ParseDuration(startParam, endParam)
 }
+
+// DetailFromHTTPRequest returns true if the optional "detail" parameter of the request asks for an
+// itemized quote, for example "detail=true".
+func DetailFromHTTPRequest(r *http.Request) (bool, error) {
+	param := r.URL.Query().Get("detail")
+	if param == "" {
+		return false, nil
+	}
+
+	detailed, err := strconv.ParseBool(param)
+	if err != nil {
+		return false, newError(CodeInvalidParameter, "detail", "could not parse 'detail' parameter [%s]: must be true or false", param)
+	}
+	return detailed, nil
+}
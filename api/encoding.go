@@ -0,0 +1,166 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"strings"
+)
+
+// ErrNoEncoding is returned by an EncodeFunc for a response that has no representation in its media type.
+var ErrNoEncoding = errors.New("response has no representation in this media type")
+
+// EncodeFunc returns the representation of a response in a single media type, or ErrNoEncoding if the
+// response has none.
+type EncodeFunc func(f WebFormatter) ([]byte, error)
+
+// TextFormatter is implemented by WebFormatters that have a human-readable plain text representation.
+type TextFormatter interface {
+	Text() ([]byte, error)
+}
+
+// HTMLFormatter is implemented by WebFormatters that can be rendered as an HTML page.
+type HTMLFormatter interface {
+	HTML() ([]byte, error)
+}
+
+type encoding struct {
+	MediaType string
+	Encode    EncodeFunc
+}
+
+// encodings are the registered encodings, in order of preference when a client accepts more than one
+// equally. The problem types come first, so that a client that names one gets errors in that format,
+// but they are never chosen by a wildcard such as "*/*". See Negotiate.
+var encodings = []encoding{
+	{MediaTypeProblemJSON, encodeProblemJSON},
+	{MediaTypeProblemXML, encodeProblemXML},
+	{MediaTypeJSON, encodeJSON},
+	{MediaTypeXML, encodeXML},
+	{MediaTypeCSV, encodeCSV},
+	{MediaTypeYAML, encodeYAML},
+	{MediaTypeText, encodeText},
+	{MediaTypeHTML, encodeHTML},
+}
+
+// RegisterEncoding adds an encoding for a media type to those offered to clients, or replaces the
+// encoding already registered for it. RegisterEncoding is not safe to call while requests are being
+// served, and should be called while the program is initialized.
+func RegisterEncoding(mediaType string, encode EncodeFunc) {
+	for i, e := range encodings {
+		if e.MediaType == mediaType {
+			encodings[i].Encode = encode
+			return
+		}
+	}
+	encodings = append(encodings, encoding{mediaType, encode})
+}
+
+// UnregisterEncoding removes the encoding registered for a media type, so that it is no longer offered
+// to clients. Like RegisterEncoding, it is not safe to call while requests are being served.
+func UnregisterEncoding(mediaType string) {
+	for i, e := range encodings {
+		if e.MediaType == mediaType {
+			encodings = append(encodings[:i:i], encodings[i+1:]...)
+			return
+		}
+	}
+}
+
+// MediaTypes returns the media types of the registered encodings, in order of preference.
+func MediaTypes() []string {
+	mediaTypes := make([]string, 0, len(encodings))
+	for _, e := range encodings {
+		mediaTypes = append(mediaTypes, e.MediaType)
+	}
+	return mediaTypes
+}
+
+// Encode returns the representation of a response in a media type, or ErrNoEncoding if the response
+// has none.
+func Encode(mediaType string, f WebFormatter) ([]byte, error) {
+	for _, e := range encodings {
+		if e.MediaType == mediaType {
+			return e.Encode(f)
+		}
+	}
+	return nil, fmt.Errorf("no encoding is registered for %q: %w", mediaType, ErrNoEncoding)
+}
+
+// suffixMediaType returns the media type of the structured syntax suffix of a media type, such as
+// "application/json" for "application/problem+json", or "" if it has none.
+func suffixMediaType(mediaType string) string {
+	split := strings.SplitN(mediaType, "/", 2)
+	if i := strings.LastIndex(mediaType, "+"); len(split) == 2 && i > len(split[0]) {
+		return split[0] + "/" + mediaType[i+1:]
+	}
+	return ""
+}
+
+func encodeProblemJSON(f WebFormatter) ([]byte, error) {
+	if _, ok := f.(Problem); !ok {
+		return nil, ErrNoEncoding
+	}
+	return f.JSON()
+}
+
+func encodeProblemXML(f WebFormatter) ([]byte, error) {
+	if _, ok := f.(Problem); !ok {
+		return nil, ErrNoEncoding
+	}
+	return f.XML()
+}
+
+func encodeJSON(f WebFormatter) ([]byte, error) {
+	return f.JSON()
+}
+
+func encodeXML(f WebFormatter) ([]byte, error) {
+	return f.XML()
+}
+
+func encodeCSV(f WebFormatter) ([]byte, error) {
+	if c, ok := f.(CSVFormatter); ok {
+		return c.CSV()
+	}
+	return nil, ErrNoEncoding
+}
+
+// encodeYAML converts the JSON representation of a response to YAML, so that the YAML has the same
+// field names, in the same order.
+func encodeYAML(f WebFormatter) ([]byte, error) {
+	response, err := f.JSON()
+	if err != nil {
+		return nil, err
+	}
+
+	// JSON is a subset of YAML, so it can be decoded as a YAML document in flow style, which
+	// is then written back out in block style, with quotes only where they are needed.
+	var document yaml.Node
+	if err = yaml.Unmarshal(response, &document); err != nil {
+		return nil, err
+	}
+	setPlainStyle(&document)
+	return yaml.Marshal(&document)
+}
+
+func setPlainStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		setPlainStyle(child)
+	}
+}
+
+func encodeText(f WebFormatter) ([]byte, error) {
+	if t, ok := f.(TextFormatter); ok {
+		return t.Text()
+	}
+	return nil, ErrNoEncoding
+}
+
+func encodeHTML(f WebFormatter) ([]byte, error) {
+	if h, ok := f.(HTMLFormatter); ok {
+		return h.HTML()
+	}
+	return nil, ErrNoEncoding
+}
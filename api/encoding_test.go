@@ -0,0 +1,130 @@
+package api_test
+
+import (
+	"github.com/jtide/gopark/api"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func getRate(t *testing.T, target string, accept string) *httptest.ResponseRecorder {
+	err := api.ReplaceRates(api.JSONDefaultRateConfig)
+	assert.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	r.Header.Set("Accept", accept)
+	w := httptest.NewRecorder()
+	api.RateHandleFunc(w, r)
+	return w
+}
+
+func TestRateHandleFuncYAML(t *testing.T) {
+	w := getRate(t, "/api/rate?start=2015-07-01T07:00:00Z&end=2015-07-01T12:00:00Z&detail=true", "application/yaml")
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "application/yaml")
+
+	// Field names and their order are the same as the JSON
+	body := w.Body.String()
+	assert.True(t, strings.HasPrefix(body, "status: 200\nstart: "), body)
+	assert.Contains(t, body, "unit_price: 1750")
+
+	var rate struct {
+		Price     uint `yaml:"price"`
+		Breakdown struct {
+			Total uint `yaml:"total"`
+		} `yaml:"breakdown"`
+	}
+	assert.NoError(t, yaml.Unmarshal(w.Body.Bytes(), &rate))
+	assert.Equal(t, uint(1750), rate.Price)
+	assert.Equal(t, uint(1750), rate.Breakdown.Total)
+}
+
+func TestRateHandleFuncText(t *testing.T) {
+	w := getRate(t, "/api/rate?start=2015-07-01T07:00:00Z&end=2015-07-01T12:00:00Z&detail=true", "text/plain")
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/plain")
+	body := w.Body.String()
+	assert.Contains(t, body, "Start: 2015-07-01T07:00:00Z\n")
+	assert.Contains(t, body, "  wed    0600-1800  300 min  $17.50  $17.50\n")
+	assert.True(t, strings.HasSuffix(body, "Price: $17.50\n"), body)
+
+	w = getRate(t, "/api/rate?start=2015-07-02T07:00:00Z&end=2015-07-02T12:00:00Z", "text/plain")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), "Price: unavailable\n")
+
+	w = getRate(t, "/api/rate?start=2015-07-01T12:00:00Z&end=2015-07-01T07:00:00Z", "text/plain")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.True(t, strings.HasPrefix(w.Body.String(), "400 Bad Request: "), w.Body.String())
+	assert.Contains(t, w.Body.String(), "Code:  end_before_start\n")
+}
+
+func TestRateHandleFuncHTML(t *testing.T) {
+	w := getRate(t, "/api/rate?start=2015-07-01T07:00:00Z&end=2015-07-01T12:00:00Z&detail=true", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+	body := w.Body.String()
+	assert.Contains(t, body, "<h1>Parking quote</h1>")
+	assert.Contains(t, body, "<dt>Price</dt><dd>$17.50</dd>")
+	assert.Contains(t, body, "<td>0600-1800</td>")
+
+	// Error messages are escaped
+	w = getRate(t, "/api/rate?start=<b>&end=2015-07-01T07:00:00Z", "text/html")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "&lt;b&gt;")
+	assert.NotContains(t, w.Body.String(), "<b>")
+}
+
+func TestWriteResponseWithoutEncoding(t *testing.T) {
+	err := api.ReplaceRates(api.JSONDefaultRateConfig)
+	assert.NoError(t, err)
+
+	// A Schedule has no HTML page, so the next preference of a browser is used.
+	r := httptest.NewRequest(http.MethodGet, "/api/rates", nil)
+	r.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+	w := httptest.NewRecorder()
+	api.RatesHandleFunc(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "application/xml")
+
+	// Without another preference, JSON is used.
+	r = httptest.NewRequest(http.MethodGet, "/api/rates", nil)
+	r.Header.Set("Accept", "text/html")
+	w = httptest.NewRecorder()
+	api.RatesHandleFunc(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "application/json")
+}
+
+func TestRegisterEncoding(t *testing.T) {
+	mediaType := "application/vnd.gopark.price"
+	api.RegisterEncoding(mediaType, func(f api.WebFormatter) ([]byte, error) {
+		rate, ok := f.(api.Rate)
+		if !ok {
+			return nil, api.ErrNoEncoding
+		}
+		return []byte(strings.Repeat("$", int(rate.Price/1000))), nil
+	})
+	t.Cleanup(func() {
+		api.UnregisterEncoding(mediaType)
+		assert.NotContains(t, api.MediaTypes(), mediaType)
+	})
+	assert.Contains(t, api.MediaTypes(), mediaType)
+
+	w := getRate(t, "/api/rate?start=2015-07-01T07:00:00Z&end=2015-07-01T12:00:00Z", mediaType)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), mediaType)
+	assert.Equal(t, "$", w.Body.String())
+
+	_, err := api.Encode(mediaType, api.APIStandardResponse{Status: http.StatusOK})
+	assert.ErrorIs(t, err, api.ErrNoEncoding)
+	_, err = api.Encode("image/png", api.APIStandardResponse{Status: http.StatusOK})
+	assert.ErrorIs(t, err, api.ErrNoEncoding)
+}
@@ -0,0 +1,207 @@
+package api
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Stable, machine-readable codes for errors returned by the API. Each code is described in
+// doc/errors.md, which is linked from every error response.
+const (
+	CodeBadRequest             = "bad_request"
+	CodeMethodNotSupported     = "method_not_supported"
+	CodeUnsupportedContentType = "unsupported_content_type"
+	CodeNotAcceptable          = "not_acceptable"
+	CodeInvalidBody            = "invalid_body"
+	CodeMissingParameter       = "missing_parameter"
+	CodeInvalidParameter       = "invalid_parameter"
+	CodeInvalidStart           = "invalid_start"
+	CodeInvalidEnd             = "invalid_end"
+	CodeEndBeforeStart         = "end_before_start"
+	CodeInvalidDays            = "invalid_days"
+	CodeInvalidTimes           = "invalid_times"
+	CodeInvalidPrice           = "invalid_price"
+	CodeInvalidCurrency        = "invalid_currency"
+	CodeCurrencyMismatch       = "currency_mismatch"
+	CodeInvalidCharge          = "invalid_charge"
+	CodeInvalidVehicle         = "invalid_vehicle"
+	CodeInvalidSpecial         = "invalid_special"
+	CodeInvalidLadder          = "invalid_ladder"
+	CodeInvalidGrace           = "invalid_grace"
+	CodeInvalidDiscount        = "invalid_discount"
+	CodeDiscountNotFound       = "discount_not_found"
+	CodeDiscountUnavailable    = "discount_unavailable"
+	CodeSessionNotFound        = "session_not_found"
+	CodeSessionConflict        = "session_conflict"
+	CodeInvalidCapacity        = "invalid_capacity"
+	CodeInvalidRefund          = "invalid_refund"
+	CodeInvalidOccupancyBand   = "invalid_occupancy_band"
+	CodeRateUnavailable        = "rate_unavailable"
+	CodeCapacityExceeded       = "capacity_exceeded"
+	CodeReservationNotFound    = "reservation_not_found"
+	CodeReservationConflict    = "reservation_conflict"
+	CodeInvalidWebhook         = "invalid_webhook"
+	CodeWebhookNotFound        = "webhook_not_found"
+	CodeRateConflict           = "rate_conflict"
+	CodeRateNotFound           = "rate_not_found"
+	CodeBatchTooLarge          = "batch_too_large"
+	CodeInsufficientCoverage   = "insufficient_coverage"
+	CodeRateLimited            = "rate_limited"
+	CodeInternal               = "internal_error"
+)
+
+// errorTitles are short, human-readable summaries of each error code, used as the title of a Problem.
+var errorTitles = map[string]string{
+	CodeBadRequest:             "Bad request",
+	CodeMethodNotSupported:     "Method not supported",
+	CodeUnsupportedContentType: "Unsupported content type",
+	CodeNotAcceptable:          "Not acceptable",
+	CodeInvalidBody:            "Invalid request body",
+	CodeMissingParameter:       "Missing parameter",
+	CodeInvalidParameter:       "Invalid parameter",
+	CodeInvalidStart:           "Invalid start time",
+	CodeInvalidEnd:             "Invalid end time",
+	CodeEndBeforeStart:         "End time before start time",
+	CodeInvalidDays:            "Invalid days",
+	CodeInvalidTimes:           "Invalid time range",
+	CodeInvalidPrice:           "Invalid price",
+	CodeInvalidCurrency:        "Invalid currency",
+	CodeCurrencyMismatch:       "Currency mismatch",
+	CodeInvalidCharge:          "Invalid charge",
+	CodeInvalidVehicle:         "Invalid vehicle class",
+	CodeInvalidSpecial:         "Invalid special rate",
+	CodeInvalidLadder:          "Invalid ladder",
+	CodeInvalidGrace:           "Invalid grace period",
+	CodeInvalidDiscount:        "Invalid discount",
+	CodeDiscountNotFound:       "Discount not found",
+	CodeDiscountUnavailable:    "Discount unavailable",
+	CodeSessionNotFound:        "Session not found",
+	CodeSessionConflict:        "Conflicting session",
+	CodeInvalidCapacity:        "Invalid capacity",
+	CodeInvalidRefund:          "Invalid refund rule",
+	CodeInvalidOccupancyBand:   "Invalid occupancy band",
+	CodeRateUnavailable:        "Rate unavailable",
+	CodeCapacityExceeded:       "Capacity exceeded",
+	CodeReservationNotFound:    "Reservation not found",
+	CodeReservationConflict:    "Conflicting reservation",
+	CodeInvalidWebhook:         "Invalid webhook",
+	CodeWebhookNotFound:        "Webhook not found",
+	CodeRateConflict:           "Conflicting rate",
+	CodeRateNotFound:           "Rate not found",
+	CodeBatchTooLarge:          "Batch too large",
+	CodeInsufficientCoverage:   "Insufficient coverage",
+	CodeRateLimited:            "Too many requests",
+	CodeInternal:               "Internal error",
+}
+
+// ErrorDocsURL is the base URL of the error code documentation. The code is appended as a fragment.
+var ErrorDocsURL = "https://github.com/jtide/gopark/blob/master/doc/errors.md"
+
+// Error is an error with a stable code, and the request field that caused it, if any, such as
+// "start", "end", "days", "times" or "price". The message of the wrapped error is unchanged, so
+// an Error can be wrapped by fmt.Errorf chains and found again with errors.As.
+type Error struct {
+	Code  string
+	Field string
+	Err   error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// newError returns an *Error with a message formatted as by fmt.Errorf.
+func newError(code string, field string, format string, a ...interface{}) *Error {
+	return &Error{Code: code, Field: field, Err: fmt.Errorf(format, a...)}
+}
+
+// ErrorCode returns the code and field of the first *Error wrapped by err. If err does not wrap
+// an *Error, a generic code for the HTTP status is returned.
+func ErrorCode(err error, status uint) (string, string) {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code, apiErr.Field
+	}
+	if status >= http.StatusInternalServerError {
+		return CodeInternal, ""
+	}
+	return CodeBadRequest, ""
+}
+
+// ErrorLink returns the link to the documentation of an error code.
+func ErrorLink(code string) string {
+	return ErrorDocsURL + "#" + code
+}
+
+// Problem is an RFC 7807 problem details response, used for errors when the client accepts
+// "application/problem+json" or "application/problem+xml". The Type links to the documentation
+// of the Code.
+type Problem struct {
+	XMLName xml.Name `json:"-" xml:"urn:ietf:rfc:7807 problem"`
+	Type    string   `json:"type" xml:"type"`
+	Title   string   `json:"title" xml:"title"`
+	Status  uint     `json:"status" xml:"status"`
+	Detail  string   `json:"detail" xml:"detail"`
+	Code    string   `json:"code" xml:"code"`
+	Field   string   `json:"field,omitempty" xml:"field,omitempty"`
+}
+
+// NewProblem returns the Problem for an error with the given HTTP status.
+func NewProblem(status uint, err error) Problem {
+	code, field := ErrorCode(err, status)
+	return Problem{
+		Type:   ErrorLink(code),
+		Title:  errorTitles[code],
+		Status: status,
+		Detail: err.Error(),
+		Code:   code,
+		Field:  field,
+	}
+}
+
+// JSON implementation for WebFormatter interface.
+func (p Problem) JSON() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+// XML implementation for WebFormatter interface.
+func (p Problem) XML() ([]byte, error) {
+	return xml.Marshal(p)
+}
+
+// StatusCode implementation for WebFormatter interface.
+func (p Problem) StatusCode() uint {
+	return p.Status
+}
+
+// WriteError writes an error response with the given HTTP status. Clients that accept
+// "application/problem+json" or "application/problem+xml" get a Problem, and all others get an
+// APIStandardResponse. Both include the code, field and documentation link of the error.
+func WriteError(status uint, err error, w *http.ResponseWriter, r *http.Request) error {
+	switch ResponseMediaType(r) {
+	case MediaTypeProblemJSON, MediaTypeProblemXML:
+		return WriteResponse(NewProblem(status, err), w, r)
+	}
+
+	code, field := ErrorCode(err, status)
+	response := APIStandardResponse{
+		Status:      status,
+		Description: err.Error(),
+		Code:        code,
+		Field:       field,
+		Link:        ErrorLink(code),
+	}
+	return WriteResponse(response, w, r)
+}
+
+// methodNotSupported returns the error for a request method that an endpoint does not handle.
+func methodNotSupported(method string) error {
+	return newError(CodeMethodNotSupported, "", "%v method is not supported at this endpoint", method)
+}
@@ -0,0 +1,124 @@
+package api_test
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"github.com/jtide/gopark/api"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestErrorCodeThroughChains(t *testing.T) {
+	tests := []struct {
+		config []byte
+		code   string
+		field  string
+	}{
+		{[]byte(`{"rates": [{"days": "mon,funday", "times": "0900-1000", "price": 100}]}`), api.CodeInvalidDays, "days"},
+		{[]byte(`{"rates": [{"days": "mon", "times": "0900-1060", "price": 100}]}`), api.CodeInvalidTimes, "times"},
+		{[]byte(`{"rates": [{"days": "mon", "times": "0900-1000", "price": -100}]}`), api.CodeInvalidPrice, "price"},
+		{[]byte(`{"rates": [{"days": "mon", "times": "0900-1000", "price": 100}, {"days": "mon", "times": "0930-1100", "price": 100}]}`), api.CodeRateConflict, "times"},
+		{[]byte(`{"rates": [`), api.CodeInvalidBody, ""},
+	}
+
+	for _, test := range tests {
+		err := api.ReplaceRates(test.config)
+
+		var apiErr *api.Error
+		assert.True(t, errors.As(err, &apiErr), string(test.config))
+		code, field := api.ErrorCode(err, http.StatusBadRequest)
+		assert.Equal(t, test.code, code, string(test.config))
+		assert.Equal(t, test.field, field, string(test.config))
+
+		// The message is unchanged by the code
+		assert.True(t, strings.HasPrefix(err.Error(), "failed to replace rates: "), err.Error())
+	}
+}
+
+func TestErrorCodeFromCSV(t *testing.T) {
+	_, err := api.ConfigRatesFromCSV(strings.NewReader("days,times,price\nmon,0900-1000,ten\n"))
+	code, field := api.ErrorCode(err, http.StatusBadRequest)
+	assert.Equal(t, api.CodeInvalidPrice, code)
+	assert.Equal(t, "price", field)
+
+	var csvErr *api.CSVError
+	assert.True(t, errors.As(err, &csvErr))
+	assert.Equal(t, 2, csvErr.Row)
+}
+
+func TestErrorCodeWithoutError(t *testing.T) {
+	code, field := api.ErrorCode(errors.New("something went wrong"), http.StatusInternalServerError)
+	assert.Equal(t, api.CodeInternal, code)
+	assert.Equal(t, "", field)
+}
+
+func TestRateHandleFuncWithStandardError(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/api/rate?start=2015-07-01T07:00:00Z&end=tomorrow", nil)
+	r.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	api.RateHandleFunc(w, r)
+
+	response := api.APIStandardResponse{}
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(http.StatusBadRequest), response.Status)
+	assert.Equal(t, api.CodeInvalidEnd, response.Code)
+	assert.Equal(t, "end", response.Field)
+	assert.Equal(t, api.ErrorDocsURL+"#invalid_end", response.Link)
+}
+
+func TestRateHandleFuncWithProblemJSON(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/api/rate?start=yesterday&end=2015-07-01T07:00:00Z", nil)
+	r.Header.Set("Accept", "application/problem+json, application/json")
+	w := httptest.NewRecorder()
+	api.RateHandleFunc(w, r)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "application/problem+json")
+
+	problem := api.Problem{}
+	err := json.Unmarshal(w.Body.Bytes(), &problem)
+	assert.NoError(t, err)
+	assert.Equal(t, api.Problem{
+		Type:   api.ErrorDocsURL + "#invalid_start",
+		Title:  "Invalid start time",
+		Status: http.StatusBadRequest,
+		Detail: problem.Detail,
+		Code:   api.CodeInvalidStart,
+		Field:  "start",
+	}, problem)
+	assert.Contains(t, problem.Detail, "could not parse 'start' parameter [yesterday]")
+}
+
+func TestRateHandleFuncWithProblemXML(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPatch, "/api/rate", nil)
+	r.Header.Set("Accept", "application/problem+xml")
+	w := httptest.NewRecorder()
+	api.RateHandleFunc(w, r)
+
+	assert.Contains(t, w.Header().Get("Content-Type"), "application/problem+xml")
+	assert.True(t, strings.HasPrefix(w.Body.String(), `<problem xmlns="urn:ietf:rfc:7807">`), w.Body.String())
+
+	problem := api.Problem{}
+	err := xml.Unmarshal(w.Body.Bytes(), &problem)
+	assert.NoError(t, err)
+	assert.Equal(t, api.CodeMethodNotSupported, problem.Code)
+}
+
+func TestRateHandleFuncSuccessWithProblemAccept(t *testing.T) {
+	err := api.ReplaceRates(api.JSONDefaultRateConfig)
+	assert.NoError(t, err)
+
+	// Clients that accept problem details still get other responses as JSON
+	r := httptest.NewRequest(http.MethodGet, "/api/rate?start=2015-07-01T07:00:00Z&end=2015-07-01T12:00:00Z", nil)
+	r.Header.Set("Accept", "application/problem+json")
+	w := httptest.NewRecorder()
+	api.RateHandleFunc(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "application/json")
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"fmt"
+)
+
+// maxGraceMinutes is the longest grace period or free-minute allowance, which is a day.
+const maxGraceMinutes = 24 * 60
+
+// Grace is an allowance of free parking. A stay of at most Minutes is free, such as a driver who
+// enters and leaves within a 10 minute grace period, and the first FreeMinutes of any stay are free,
+// such as a lot that gives the first 30 minutes free. Free minutes make a stay within them free, and
+// the tiers of a ladder start after them, but they do not lower the flat price of a rate. The grace of the rule of the rate at the start
+// of a stay replaces the grace of the facility, if the rule has one.
+type Grace struct {
+	Minutes     uint64 `json:"minutes,omitempty" xml:",omitempty"`
+	FreeMinutes uint64 `json:"free_minutes,omitempty" xml:",omitempty"`
+}
+
+// Validate returns an error if the grace period or free minutes are longer than a day.
+func (g Grace) Validate() error {
+	if g.Minutes > maxGraceMinutes || g.FreeMinutes > maxGraceMinutes {
+		return newError(CodeInvalidGrace, "grace", "grace period and free minutes must be at most %d minutes", maxGraceMinutes)
+	}
+	return nil
+}
+
+// covers returns true if a stay of a number of minutes is free, because it is within the grace
+// period or the free minutes.
+func (g Grace) covers(minutes uint64) bool {
+	return (g.Minutes > 0 && minutes <= g.Minutes) || (g.FreeMinutes > 0 && minutes <= g.FreeMinutes)
+}
+
+// item returns the zero-priced line item of a quote for a stay that the grace covers.
+func (g Grace) item(d Duration) LineItem {
+	minutes := d.minutes()
+	grace := fmt.Sprintf("grace period of %d min", g.Minutes)
+	if g.Minutes == 0 || minutes > g.Minutes {
+		grace = fmt.Sprintf("first %d min free", g.FreeMinutes)
+	}
+	return LineItem{
+		Day:     StringFromWeekday(d.Start.Weekday()),
+		Times:   TimeRangeToConfigString(MinutesSinceMidnightFromTime(d.Start), MinutesSinceMidnightFromTime(d.End)),
+		Grace:   grace,
+		Minutes: minutes,
+	}
+}
+
+// freeItem returns the zero-priced line item for the free minutes at the start of a stay that enters
+// at a minute since midnight, and the number of minutes that are left to price.
+func (g Grace) freeItem(day string, start uint64, minutes uint64) (LineItem, uint64) {
+	item := LineItem{
+		Day:     day,
+		Times:   TimeRangeToConfigString(start, start+g.FreeMinutes),
+		Grace:   fmt.Sprintf("first %d min free", g.FreeMinutes),
+		Minutes: g.FreeMinutes,
+	}
+	return item, minutes - g.FreeMinutes
+}
+
+// graceOf returns the grace of a rate, which is the grace of its rule, if it has one, or else the
+// grace of the facility.
+func (rates *WeeklyRates) graceOf(rate HourlyRate) Grace {
+	if rate.Grace != nil {
+		return *rate.Grace
+	} else if rates.Facility.Grace != nil {
+		return *rates.Facility.Grace
+	}
+	return Grace{}
+}
+
+// graceFor returns the grace that applies to a stay, which is the grace of the rate at its start, or
+// the grace of the facility if no rate covers its start.
+func (rates *WeeklyRates) graceFor(d Duration) Grace {
+	dayRates := rates.Days[d.Start.Weekday()]
+	if rate, err := dayRates.AtMinuteSinceMidnight(MinutesSinceMidnightFromTime(d.Start)); err == nil {
+		return rates.graceOf(rate)
+	}
+	if grace := rates.Facility.Grace; grace != nil {
+		return *grace
+	}
+	return Grace{}
+}
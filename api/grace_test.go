@@ -0,0 +1,129 @@
+package api_test
+
+import (
+	"github.com/jtide/gopark/api"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+var jsonGraceConfig = []byte(`{
+	"grace": {"minutes": 10},
+	"charges": [{"name": "Service fee", "type": "fee", "amount": 50}],
+	"rates": [
+		{"days": "wed", "times": "0600-2200", "price": 1500},
+		{"days": "thurs", "times": "0600-2200", "price": 0, "grace": {"free_minutes": 30}, "ladder": {
+			"tiers": [{"minutes": 60, "price": 500}, {"every": 60, "price": 300}]
+		}},
+		{"days": "sat", "times": "0600-2200", "price": 100, "grace": {"free_minutes": 30}}
+	]
+}`)
+
+func TestQuoteByDurationWithGrace(t *testing.T) {
+	rates := api.NewWeeklyRates()
+	err := rates.Update(jsonGraceConfig)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		start string
+		end   string
+		grace []string
+		total uint
+	}{
+		{"2015-07-01T07:00:00Z", "2015-07-01T07:08:00Z", []string{"grace period of 10 min"}, 0},
+		{"2015-07-01T07:00:00Z", "2015-07-01T07:10:00Z", []string{"grace period of 10 min"}, 0},
+		{"2015-07-01T07:00:00Z", "2015-07-01T07:11:00Z", []string{""}, 1550},
+		// No rate covers the stay, but it is within the grace period of the facility
+		{"2015-07-01T03:00:00Z", "2015-07-01T03:05:00Z", []string{"grace period of 10 min"}, 0},
+		// The free minutes of the rule replace the grace period of the facility
+		{"2015-07-02T07:00:00Z", "2015-07-02T07:30:00Z", []string{"first 30 min free"}, 0},
+		{"2015-07-02T07:00:00Z", "2015-07-02T08:30:00Z", []string{"first 30 min free", ""}, 550},
+		{"2015-07-02T07:00:00Z", "2015-07-02T08:31:00Z", []string{"first 30 min free", "", ""}, 850},
+		// Free minutes do not lower the flat price of a rate without a ladder
+		{"2015-07-04T07:00:00Z", "2015-07-04T07:20:00Z", []string{"first 30 min free"}, 0},
+		{"2015-07-04T07:00:00Z", "2015-07-04T07:45:00Z", []string{""}, 150},
+	}
+
+	for _, test := range tests {
+		duration, err := api.ParseDuration(test.start, test.end)
+		assert.NoError(t, err)
+		quote, err := rates.QuoteByDuration(duration)
+		assert.NoError(t, err, test.end)
+
+		var grace []string
+		for _, item := range quote.Items {
+			grace = append(grace, item.Grace)
+		}
+		assert.Equal(t, test.grace, grace, test.end)
+		assert.Equal(t, test.total, quote.Total, test.end)
+	}
+}
+
+func TestQuoteByDurationWithFreeMinutes(t *testing.T) {
+	rates := api.NewWeeklyRates()
+	err := rates.Update(jsonGraceConfig)
+	assert.NoError(t, err)
+
+	duration, err := api.ParseDuration("2015-07-02T07:00:00Z", "2015-07-02T09:00:00Z")
+	assert.NoError(t, err)
+	quote, err := rates.QuoteByDuration(duration)
+	assert.NoError(t, err)
+
+	assert.Equal(t, api.LineItem{Day: "thurs", Times: "0700-0730", Grace: "first 30 min free", Minutes: 30}, quote.Items[0])
+	assert.Equal(t, uint64(60), quote.Items[1].Minutes)
+	assert.Equal(t, uint64(30), quote.Items[2].Minutes)
+	assert.Equal(t, uint(800), quote.Subtotal)
+	assert.Equal(t, uint(850), quote.Total)
+}
+
+func TestQuoteByDurationWithGraceHasNoCharges(t *testing.T) {
+	rates := api.NewWeeklyRates()
+	err := rates.Update(jsonGraceConfig)
+	assert.NoError(t, err)
+
+	duration, err := api.ParseDuration("2015-07-01T07:00:00Z", "2015-07-01T07:05:00Z")
+	assert.NoError(t, err)
+	quote, err := rates.QuoteByDuration(duration)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []api.LineItem{{Day: "wed", Times: "0700-0705", Grace: "grace period of 10 min", Minutes: 5}}, quote.Items)
+	assert.Empty(t, quote.Adjustments)
+	assert.Equal(t, "USD", quote.Currency)
+	assert.Equal(t, uint(0), quote.Total)
+}
+
+func TestWeeklyRates_UpdateKeepsGrace(t *testing.T) {
+	rates := api.NewWeeklyRates()
+	err := rates.Update(jsonGraceConfig)
+	assert.NoError(t, err)
+	err = rates.Update([]byte(`{"rates": [{"days": "fri", "times": "0600-2200", "price": 1000}]}`))
+	assert.NoError(t, err)
+
+	duration, err := api.ParseDuration("2015-07-03T07:00:00Z", "2015-07-03T07:05:00Z")
+	assert.NoError(t, err)
+	price, err := rates.LookupByDuration(duration)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(0), price)
+
+	config := rates.Config()
+	assert.Equal(t, &api.Grace{Minutes: 10}, config.Grace)
+	assert.Equal(t, &api.Grace{FreeMinutes: 30}, config.Rates[1].Grace)
+	_, err = config.CSV()
+	assert.ErrorIs(t, err, api.ErrNoEncoding)
+}
+
+func TestWeeklyRates_UpdateWithInvalidGrace(t *testing.T) {
+	configs := []string{
+		`{"grace": {"minutes": 1441}, "rates": [{"days": "wed", "times": "0600-1800", "price": 1500}]}`,
+		`{"grace": {"minutes": -10}, "rates": [{"days": "wed", "times": "0600-1800", "price": 1500}]}`,
+		`{"rates": [{"days": "wed", "times": "0600-1800", "price": 1500, "grace": {"free_minutes": 2000}}]}`,
+		`{"rates": [{"days": "wed", "times": "0600-1800", "price": 1500, "grace": {"free_minutes": "30"}}]}`,
+	}
+
+	for _, config := range configs {
+		rates := api.NewWeeklyRates()
+		err := rates.Update([]byte(config))
+		code, field := api.ErrorCode(err, 400)
+		assert.Equal(t, api.CodeInvalidGrace, code, config)
+		assert.Equal(t, "grace", field, config)
+	}
+}
@@ -0,0 +1,491 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"net/http"
+	"time"
+)
+
+// GraphQLRequest is the body of a Post request to the GraphQL endpoint. Variables are the values of
+// the variables of the query, and the OperationName chooses the operation to run if the query has
+// more than one.
+type GraphQLRequest struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	OperationName string                 `json:"operationName,omitempty"`
+}
+
+// GraphQLResult is the response for GraphQL requests. A query that runs has its Data, along with the
+// Errors of the fields that could not be resolved, such as a quote for a stay without a rate. A query
+// that could not run, such as one that does not match the schema, has only Errors.
+type GraphQLResult struct {
+	Data   interface{}    `json:"data,omitempty"`
+	Errors []GraphQLError `json:"errors,omitempty"`
+}
+
+// GraphQLError is an error of a GraphQL request. The Extensions of the errors of the API have the
+// code, field and link of the error, as they are in the body of an error response.
+type GraphQLError struct {
+	Message    string                 `json:"message"`
+	Locations  []GraphQLLocation      `json:"locations,omitempty"`
+	Path       []interface{}          `json:"path,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// GraphQLLocation is the line and column of the part of a query that caused an error.
+type GraphQLLocation struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// JSON implementation for WebFormatter interface.
+func (g GraphQLResult) JSON() ([]byte, error) {
+	return json.Marshal(g)
+}
+
+// XML implementation for WebFormatter interface. GraphQL results have no XML representation, so
+// they are written in JSON instead.
+func (g GraphQLResult) XML() ([]byte, error) {
+	return nil, ErrNoEncoding
+}
+
+// StatusCode implementation for WebFormatter interface. The result of a GraphQL request is always
+// successful, as its errors are in its body, and only a request without a query is a bad request.
+func (g GraphQLResult) StatusCode() uint {
+	return http.StatusOK
+}
+
+// graphQLFieldError is the error of a field of a GraphQL query, with the code, field and link of the
+// error as its extensions.
+type graphQLFieldError struct {
+	err error
+}
+
+func (e graphQLFieldError) Error() string {
+	return e.err.Error()
+}
+
+// Extensions implementation for the gqlerrors.ExtendedError interface.
+func (e graphQLFieldError) Extensions() map[string]interface{} {
+	code, field := ErrorCode(e.err, http.StatusBadRequest)
+	extensions := map[string]interface{}{"code": code, "link": ErrorLink(code)}
+	if field != "" {
+		extensions["field"] = field
+	}
+	return extensions
+}
+
+// graphQLFacility is the result of the facility query.
+type graphQLFacility struct {
+	Currency       string `json:"currency"`
+	DefaultVehicle string `json:"default_vehicle"`
+	Capacity       uint   `json:"capacity"`
+	Occupied       uint   `json:"occupied"`
+	Free           uint   `json:"free"`
+	Full           bool   `json:"full"`
+}
+
+// graphQLSchema is the schema of the GraphQL endpoint. Its types have the same fields, with the same
+// names, as the JSON of the REST API.
+var graphQLSchema = newGraphQLSchema()
+
+// graphQLObject returns an object type with fields of the given types, or an input object type if
+// input is true.
+func graphQLObject(name string, description string, input bool, types map[string]graphql.Type) graphql.Type {
+	if input {
+		fields := graphql.InputObjectConfigFieldMap{}
+		for field, t := range types {
+			fields[field] = &graphql.InputObjectFieldConfig{Type: t}
+		}
+		return graphql.NewInputObject(graphql.InputObjectConfig{Name: name + "Input", Description: description, Fields: fields})
+	}
+	fields := graphql.Fields{}
+	for field, t := range types {
+		fields[field] = &graphql.Field{Type: t}
+	}
+	return graphql.NewObject(graphql.ObjectConfig{Name: name, Description: description, Fields: fields})
+}
+
+// graphQLRateTypes returns the object type of ConfigRates, named Schedule, and of the types of its
+// fields, or their input object types if input is true.
+func graphQLRateTypes(input bool) graphql.Type {
+	list := func(t graphql.Type) graphql.Type { return graphql.NewList(graphql.NewNonNull(t)) }
+	required := func(t graphql.Type) graphql.Type {
+		if input {
+			return graphql.NewNonNull(t)
+		}
+		return t
+	}
+
+	vehicle := graphQLObject("VehiclePrice", "The price of a class of vehicle that differs from the price of its rate.", input, map[string]graphql.Type{
+		"class": required(graphql.String),
+		"price": required(graphql.Int),
+	})
+	tier := graphQLObject("LadderTier", "A band of a ladder.", input, map[string]graphql.Type{
+		"minutes": graphql.Int,
+		"every":   graphql.Int,
+		"price":   required(graphql.Int),
+	})
+	ladder := graphQLObject("Ladder", "Prices a stay by its length instead of the price of its rate.", input, map[string]graphql.Type{
+		"tiers": required(list(tier)),
+		"max":   graphql.Int,
+	})
+	charge := graphQLObject("Charge", "A tax or fee.", input, map[string]graphql.Type{
+		"name":      required(graphql.String),
+		"type":      required(graphql.String),
+		"percent":   graphql.Float,
+		"inclusive": graphql.Boolean,
+		"amount":    graphql.Int,
+	})
+	grace := graphQLObject("Grace", "The grace period and free minutes of a stay.", input, map[string]graphql.Type{
+		"minutes":      graphql.Int,
+		"free_minutes": graphql.Int,
+	})
+	band := graphQLObject("OccupancyBand", "Changes the price of a rate when the facility is more than above percent full.", input, map[string]graphql.Type{
+		"above":   required(graphql.Float),
+		"percent": required(graphql.Float),
+	})
+	rate := graphQLObject("Rate", "A price for a window of time, such as \"0900-2100\", on a list of days, such as \"mon,tues\".", input, map[string]graphql.Type{
+		"days":      required(graphql.String),
+		"times":     required(graphql.String),
+		"price":     required(graphql.Int),
+		"vehicles":  list(vehicle),
+		"ladder":    ladder,
+		"charges":   list(charge),
+		"grace":     grace,
+		"occupancy": list(band),
+	})
+	special := graphQLObject("SpecialRate", "A flat rate for stays that meet its conditions.", input, map[string]graphql.Type{
+		"name":         required(graphql.String),
+		"type":         required(graphql.String),
+		"price":        graphql.Int,
+		"days":         graphql.String,
+		"enter_after":  graphql.String,
+		"enter_before": graphql.String,
+		"exit_after":   graphql.String,
+		"exit_before":  graphql.String,
+		"start":        graphql.DateTime,
+		"end":          graphql.DateTime,
+	})
+	refund := graphQLObject("RefundRule", "The percent of the price of a reservation refunded when it is cancelled with notice minutes to spare.", input, map[string]graphql.Type{
+		"notice":  required(graphql.Int),
+		"percent": required(graphql.Float),
+	})
+	return graphQLObject("Schedule", "The rates of the facility, in the format of the rates of the REST API.", input, map[string]graphql.Type{
+		"currency":        graphql.String,
+		"default_vehicle": graphql.String,
+		"charges":         list(charge),
+		"specials":        list(special),
+		"grace":           grace,
+		"capacity":        graphql.Int,
+		"refunds":         list(refund),
+		"rates":           required(list(rate)),
+	})
+}
+
+// newGraphQLSchema returns the schema of the GraphQL endpoint. It panics if the schema is invalid,
+// which can only be a mistake in its definition.
+func newGraphQLSchema() graphql.Schema {
+	schedule := graphQLRateTypes(false)
+	config := graphQLRateTypes(true)
+
+	discount := graphql.NewObject(graphql.ObjectConfig{Name: "DiscountResult", Fields: graphql.Fields{
+		"code":    &graphql.Field{Type: graphql.String},
+		"applied": &graphql.Field{Type: graphql.Boolean},
+		"amount":  &graphql.Field{Type: graphql.Int},
+		"reason":  &graphql.Field{Type: graphql.String},
+	}})
+	item := graphql.NewObject(graphql.ObjectConfig{Name: "LineItem", Fields: graphql.Fields{
+		"day":        &graphql.Field{Type: graphql.String},
+		"times":      &graphql.Field{Type: graphql.String},
+		"special":    &graphql.Field{Type: graphql.String},
+		"tier":       &graphql.Field{Type: graphql.String},
+		"grace":      &graphql.Field{Type: graphql.String},
+		"minutes":    &graphql.Field{Type: graphql.Int},
+		"unit_price": &graphql.Field{Type: graphql.Int},
+		"subtotal":   &graphql.Field{Type: graphql.Int},
+	}})
+	adjustment := graphql.NewObject(graphql.ObjectConfig{Name: "Adjustment", Fields: graphql.Fields{
+		"type":     &graphql.Field{Type: graphql.String},
+		"desc":     &graphql.Field{Type: graphql.String},
+		"amount":   &graphql.Field{Type: graphql.Int},
+		"included": &graphql.Field{Type: graphql.Boolean},
+	}})
+	breakdown := graphql.NewObject(graphql.ObjectConfig{Name: "Breakdown", Fields: graphql.Fields{
+		"currency":    &graphql.Field{Type: graphql.String},
+		"vehicle":     &graphql.Field{Type: graphql.String},
+		"items":       &graphql.Field{Type: graphql.NewList(item)},
+		"subtotal":    &graphql.Field{Type: graphql.Int},
+		"adjustments": &graphql.Field{Type: graphql.NewList(adjustment)},
+		"total":       &graphql.Field{Type: graphql.Int},
+	}})
+	quote := graphql.NewObject(graphql.ObjectConfig{Name: "Quote", Description: "The price of a stay.", Fields: graphql.Fields{
+		"start":           &graphql.Field{Type: graphql.DateTime},
+		"end":             &graphql.Field{Type: graphql.DateTime},
+		"price":           &graphql.Field{Type: graphql.Int},
+		"currency":        &graphql.Field{Type: graphql.String},
+		"formatted_price": &graphql.Field{Type: graphql.String},
+		"vehicle":         &graphql.Field{Type: graphql.String},
+		"discounts":       &graphql.Field{Type: graphql.NewList(discount)},
+		"multiplier":      &graphql.Field{Type: graphql.Float},
+		"available":       &graphql.Field{Type: graphql.Boolean},
+		"breakdown":       &graphql.Field{Type: breakdown},
+	}})
+	facility := graphql.NewObject(graphql.ObjectConfig{Name: "Facility", Description: "The facility and the spots free in it.", Fields: graphql.Fields{
+		"currency":        &graphql.Field{Type: graphql.String},
+		"default_vehicle": &graphql.Field{Type: graphql.String},
+		"capacity":        &graphql.Field{Type: graphql.Int},
+		"occupied":        &graphql.Field{Type: graphql.Int},
+		"free":            &graphql.Field{Type: graphql.Int},
+		"full":            &graphql.Field{Type: graphql.Boolean},
+	}})
+
+	query := graphql.NewObject(graphql.ObjectConfig{Name: "Query", Fields: graphql.Fields{
+		"schedule": &graphql.Field{
+			Type:        schedule,
+			Description: "The current rates.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return currentWeeklyRates.Config(), nil
+			},
+		},
+		"quote": &graphql.Field{
+			Type:        quote,
+			Description: "Price a stay from start to end, in RFC3339 format.",
+			Args: graphql.FieldConfigArgument{
+				"start":   &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				"end":     &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				"vehicle": &graphql.ArgumentConfig{Type: graphql.String},
+				"codes":   &graphql.ArgumentConfig{Type: graphql.NewList(graphql.NewNonNull(graphql.String))},
+			},
+			Resolve: resolveQuote,
+		},
+		"facility": &graphql.Field{
+			Type:        facility,
+			Description: "The facility and its occupancy.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				rates := currentWeeklyRates
+				status := NewOccupancyStatus(rates.Capacity(), currentOccupancy.Count())
+				return graphQLFacility{
+					Currency:       rates.Currency(),
+					DefaultVehicle: rates.DefaultVehicle(),
+					Capacity:       status.Capacity,
+					Occupied:       status.Occupied,
+					Free:           status.Free,
+					Full:           status.Full,
+				}, nil
+			},
+		},
+	}})
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{Name: "Mutation", Fields: graphql.Fields{
+		"replaceRates": &graphql.Field{
+			Type:        schedule,
+			Description: "Replace all rates, and return the new rates.",
+			Args:        graphql.FieldConfigArgument{"config": &graphql.ArgumentConfig{Type: graphql.NewNonNull(config)}},
+			Resolve:     resolveRateChange(ReplaceRatesWithConfig),
+		},
+		"updateRates": &graphql.Field{
+			Type:        schedule,
+			Description: "Add rates that do not conflict with existing rates, and return the new rates.",
+			Args:        graphql.FieldConfigArgument{"config": &graphql.ArgumentConfig{Type: graphql.NewNonNull(config)}},
+			Resolve:     resolveRateChange(UpdateRatesWithConfig),
+		},
+		"removeRates": &graphql.Field{
+			Type:        schedule,
+			Description: "Remove the rates for a time range on a list of days, and return the new rates.",
+			Args: graphql.FieldConfigArgument{
+				"days":  &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				"times": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				if err := RemoveRates(p.Args["days"].(string), p.Args["times"].(string)); err != nil {
+					return nil, graphQLFieldError{err}
+				}
+				return currentWeeklyRates.Config(), nil
+			},
+		},
+	}})
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation})
+	if err != nil {
+		panic(err)
+	}
+	return schema
+}
+
+// resolveQuote prices a stay as RateGetHandleFunc does. A stay without a rate, or without a spot
+// free, is an error with the code of the status the REST API would return for it.
+func resolveQuote(p graphql.ResolveParams) (interface{}, error) {
+	start, _ := p.Args["start"].(string)
+	end, _ := p.Args["end"].(string)
+	duration, err := ParseDuration(start, end)
+	if err != nil {
+		return nil, graphQLFieldError{err}
+	}
+
+	options := QuoteOptions{Discounts: currentDiscounts, Occupancy: currentOccupancy}
+	options.Vehicle, _ = p.Args["vehicle"].(string)
+	codes, _ := p.Args["codes"].([]interface{})
+	for _, code := range codes {
+		options.Codes = append(options.Codes, code.(string))
+	}
+
+	rates := currentWeeklyRates
+	quote, err := rates.QuoteWithOptions(duration, options)
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return nil, graphQLFieldError{err}
+	} else if err != nil {
+		return nil, graphQLFieldError{newError(CodeRateUnavailable, "start", "%w", err)}
+	}
+
+	capacity := rates.Capacity()
+	free := spotFree(duration, time.Now(), capacity)
+	if free != nil && !*free {
+		return nil, graphQLFieldError{newError(CodeCapacityExceeded, "start", "all %d spots are taken during the stay", capacity)}
+	}
+	rate := NewRate(duration, quote)
+	rate.Available = free
+	rate.Breakdown = &quote
+	return rate, nil
+}
+
+// resolveRateChange returns a resolver that changes the rates with the configuration of its "config"
+// argument, and returns the new rates. The configuration is parsed by ConfigRatesFromJSON, so that it
+// is validated as the body of a request to the REST API is.
+func resolveRateChange(change func(ConfigRates) error) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		body, err := json.Marshal(p.Args["config"])
+		if err != nil {
+			return nil, err
+		}
+		config, err := ConfigRatesFromJSON(body)
+		if err == nil {
+			err = change(config)
+		}
+		if err != nil {
+			return nil, graphQLFieldError{err}
+		}
+		return currentWeeklyRates.Config(), nil
+	}
+}
+
+// GraphQLHandleFunc is the top-level handler for requests to the /api/graphql endpoint, which runs
+// GraphQL queries for the rates, quotes and facility, and mutations of the rates. A query is given by
+// the "query", "variables" and "operationName" parameters of a Get request, or by the body of a Post
+// request in JSON format. Mutations are only run for Post requests.
+//
+// Example:
+//
+//	curl -X POST -H "Content-Type: application/json" -d '{"query":"{ facility { capacity free } }"}' "http://localhost:8080/api/graphql"
+func GraphQLHandleFunc(w http.ResponseWriter, r *http.Request) {
+	r, ok := InitializeResponse(&w, r) // Required before WriteResponse
+	if !ok {
+		return
+	}
+
+	var request GraphQLRequest
+	switch r.Method {
+	case http.MethodGet:
+		query := r.URL.Query()
+		request.Query = query.Get("query")
+		request.OperationName = query.Get("operationName")
+		if variables := query.Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &request.Variables); err != nil {
+				err = newError(CodeInvalidParameter, "variables", "could not parse JSON of the 'variables' parameter : %w", err)
+				WriteError(http.StatusBadRequest, err, &w, r)
+				return
+			}
+		}
+	case http.MethodPost:
+		body, err := JSONFromRequestBody(r)
+		if err != nil {
+			WriteError(http.StatusBadRequest, err, &w, r)
+			return
+		}
+		if err = json.Unmarshal(body, &request); err != nil {
+			err = newError(CodeInvalidBody, "", "could not parse JSON of GraphQL request : %w", err)
+			WriteError(http.StatusBadRequest, err, &w, r)
+			return
+		}
+	default:
+		err := methodNotSupported(r.Method)
+		WriteError(http.StatusBadRequest, err, &w, r)
+		return
+	}
+
+	if request.Query == "" {
+		err := newError(CodeMissingParameter, "query", "the 'query' of a GraphQL request is required")
+		WriteError(http.StatusBadRequest, err, &w, r)
+		return
+	}
+
+	// The query is parsed once, to find whether it is a mutation and then to run it, as graphql.Do
+	// would parse it again.
+	document, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{Body: []byte(request.Query), Name: "GraphQL request"})})
+	if err != nil {
+		WriteResponse(NewGraphQLResult(&graphql.Result{Errors: gqlerrors.FormatErrors(err)}), &w, r)
+		return
+	}
+	if isMutation(document, request.OperationName) {
+		if r.Method == http.MethodGet {
+			err := newError(CodeMethodNotSupported, "query", "mutations are not supported for GET requests, use POST instead")
+			WriteError(http.StatusBadRequest, err, &w, r)
+			return
+		}
+		// The request was charged to the quote budget, before its body was read
+		if wait := recharge(r, BudgetMutations); wait > 0 {
+			writeRateLimited(BudgetMutations, wait, &w, r)
+			return
+		}
+	}
+	if validation := graphql.ValidateDocument(&graphQLSchema, document, nil); !validation.IsValid {
+		WriteResponse(NewGraphQLResult(&graphql.Result{Errors: validation.Errors}), &w, r)
+		return
+	}
+
+	result := graphql.Execute(graphql.ExecuteParams{
+		Schema:        graphQLSchema,
+		AST:           document,
+		OperationName: request.OperationName,
+		Args:          request.Variables,
+		Context:       r.Context(),
+	})
+	WriteResponse(NewGraphQLResult(result), &w, r)
+}
+
+// isMutation reports whether the operation of a query document, chosen by its name if the document
+// has more than one, is a mutation.
+func isMutation(document *ast.Document, operationName string) bool {
+	for _, definition := range document.Definitions {
+		operation, ok := definition.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if operationName == "" || (operation.Name != nil && operation.Name.Value == operationName) {
+			if operation.Operation == ast.OperationTypeMutation {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// NewGraphQLResult returns the response for the result of a GraphQL query.
+func NewGraphQLResult(result *graphql.Result) GraphQLResult {
+	response := GraphQLResult{Data: result.Data}
+	for _, err := range result.Errors {
+		e := GraphQLError{Message: err.Message, Path: err.Path, Extensions: err.Extensions}
+		for _, location := range err.Locations {
+			e.Locations = append(e.Locations, GraphQLLocation{Line: location.Line, Column: location.Column})
+		}
+		response.Errors = append(response.Errors, e)
+	}
+	return response
+}
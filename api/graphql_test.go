@@ -0,0 +1,144 @@
+package api_test
+
+import (
+	"encoding/json"
+	"github.com/jtide/gopark/api"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// graphQL runs a GraphQL request against the API, and returns the status and the result.
+func graphQL(t *testing.T, method string, request api.GraphQLRequest) (int, api.GraphQLResult) {
+	var r *http.Request
+	if method == http.MethodGet {
+		r = httptest.NewRequest(method, "/api/graphql?query="+url.QueryEscape(request.Query), nil)
+	} else {
+		body, err := json.Marshal(request)
+		assert.NoError(t, err)
+		r = httptest.NewRequest(method, "/api/graphql", strings.NewReader(string(body)))
+		r.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	api.GraphQLHandleFunc(w, r)
+
+	var result api.GraphQLResult
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result), w.Body.String())
+	return w.Code, result
+}
+
+func TestGraphQLScheduleQuotesAndFacility(t *testing.T) {
+	assert.NoError(t, api.ReplaceRates(api.JSONDefaultRateConfig))
+
+	query := `{
+		schedule { currency rates { days times price } }
+		morning: quote(start: "2015-07-01T07:00:00Z", end: "2015-07-01T12:00:00Z") { price formatted_price breakdown { total } }
+		missing: quote(start: "2015-07-02T07:00:00Z", end: "2015-07-02T12:00:00Z") { price }
+		invalid: quote(start: "2015-07-01T12:00:00Z", end: "2015-07-01T07:00:00Z") { price }
+		facility { currency default_vehicle capacity full }
+	}`
+	status, result := graphQL(t, http.MethodPost, api.GraphQLRequest{Query: query})
+	assert.Equal(t, http.StatusOK, status)
+
+	data := result.Data.(map[string]interface{})
+	schedule := data["schedule"].(map[string]interface{})
+	assert.Equal(t, "USD", schedule["currency"])
+	rates := schedule["rates"].([]interface{})
+	assert.NotEmpty(t, rates)
+	assert.Contains(t, rates[0], "times")
+
+	morning := data["morning"].(map[string]interface{})
+	assert.Equal(t, float64(1750), morning["price"])
+	assert.Equal(t, "$17.50", morning["formatted_price"])
+	assert.Equal(t, float64(1750), morning["breakdown"].(map[string]interface{})["total"])
+	assert.Nil(t, data["missing"])
+	assert.Nil(t, data["invalid"])
+
+	facility := data["facility"].(map[string]interface{})
+	assert.Equal(t, "USD", facility["currency"])
+	assert.Equal(t, false, facility["full"])
+
+	// Each quote that fails has an error with the code of the REST API
+	codes := make(map[string]interface{})
+	for _, err := range result.Errors {
+		codes[err.Path[0].(string)] = err.Extensions["code"]
+	}
+	assert.Equal(t, map[string]interface{}{"missing": api.CodeRateUnavailable, "invalid": api.CodeEndBeforeStart}, codes)
+}
+
+func TestGraphQLMutations(t *testing.T) {
+	assert.NoError(t, api.ReplaceRates(api.JSONDefaultRateConfig))
+	defer api.ReplaceRates(api.JSONDefaultRateConfig)
+
+	replace := `mutation($config: ScheduleInput!) { replaceRates(config: $config) { currency rates { days times price } } }`
+	variables := map[string]interface{}{"config": map[string]interface{}{
+		"currency": "EUR",
+		"rates":    []interface{}{map[string]interface{}{"days": "wed", "times": "0600-1800", "price": 1200}},
+	}}
+	status, result := graphQL(t, http.MethodPost, api.GraphQLRequest{Query: replace, Variables: variables})
+	assert.Equal(t, http.StatusOK, status)
+	assert.Empty(t, result.Errors)
+	schedule := result.Data.(map[string]interface{})["replaceRates"].(map[string]interface{})
+	assert.Equal(t, "EUR", schedule["currency"])
+	assert.Len(t, schedule["rates"], 1)
+
+	update := `mutation { updateRates(config: {rates: [{days: "thurs", times: "0600-1800", price: 900}]}) { rates { days } } }`
+	_, result = graphQL(t, http.MethodPost, api.GraphQLRequest{Query: update})
+	assert.Empty(t, result.Errors)
+	assert.Len(t, result.Data.(map[string]interface{})["updateRates"].(map[string]interface{})["rates"], 2)
+
+	// The same validation and conflict checks as the REST API apply
+	tests := []struct {
+		mutation string
+		code     string
+	}{
+		{`mutation { updateRates(config: {rates: [{days: "thurs", times: "0700-0800", price: 900}]}) { currency } }`, api.CodeRateConflict},
+		{`mutation { updateRates(config: {rates: [{days: "someday", times: "0700-0800", price: 900}]}) { currency } }`, api.CodeInvalidDays},
+		{`mutation { updateRates(config: {rates: [{days: "fri", times: "0700-0800", price: -1}]}) { currency } }`, api.CodeInvalidPrice},
+		{`mutation { removeRates(days: "fri", times: "0600-1800") { currency } }`, api.CodeRateNotFound},
+	}
+
+	for _, test := range tests {
+		status, result := graphQL(t, http.MethodPost, api.GraphQLRequest{Query: test.mutation})
+		assert.Equal(t, http.StatusOK, status, test.mutation)
+		if assert.Len(t, result.Errors, 1, test.mutation) {
+			assert.Equal(t, test.code, result.Errors[0].Extensions["code"], test.mutation)
+		}
+	}
+
+	remove := `mutation { removeRates(days: "thurs", times: "0600-1800") { rates { days } } }`
+	_, result = graphQL(t, http.MethodPost, api.GraphQLRequest{Query: remove})
+	assert.Empty(t, result.Errors)
+	assert.Len(t, result.Data.(map[string]interface{})["removeRates"].(map[string]interface{})["rates"], 1)
+}
+
+func TestGraphQLHandleFuncRequests(t *testing.T) {
+	assert.NoError(t, api.ReplaceRates(api.JSONDefaultRateConfig))
+
+	// Queries can be sent in Get requests, but mutations cannot
+	status, result := graphQL(t, http.MethodGet, api.GraphQLRequest{Query: `{ facility { capacity } }`})
+	assert.Equal(t, http.StatusOK, status)
+	assert.NotNil(t, result.Data)
+
+	r := httptest.NewRequest(http.MethodGet, "/api/graphql?query="+url.QueryEscape(`mutation { removeRates(days: "wed", times: "0600-1800") { currency } }`), nil)
+	w := httptest.NewRecorder()
+	api.GraphQLHandleFunc(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), api.CodeMethodNotSupported)
+
+	// A query that does not match the schema has only errors
+	status, result = graphQL(t, http.MethodPost, api.GraphQLRequest{Query: `{ schedule { days } }`})
+	assert.Equal(t, http.StatusOK, status)
+	assert.Nil(t, result.Data)
+	assert.Len(t, result.Errors, 1)
+
+	r = httptest.NewRequest(http.MethodPost, "/api/graphql", strings.NewReader(`{"query": ""}`))
+	r.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	api.GraphQLHandleFunc(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), api.CodeMissingParameter)
+}
@@ -0,0 +1,410 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"github.com/jtide/gopark/rpc"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// EventRatesCurrent is the event of the first RateChange of a stream of rate changes, which has the
+// rates when the stream starts.
+const EventRatesCurrent = "rates.current"
+
+// ErrorDomain is the domain of the ErrorInfo detail of gRPC errors.
+const ErrorDomain = "gopark"
+
+// watchers are the streams of rate changes of the gRPC API. Each stream has a buffer for a single
+// change, and a change that a stream has not received yet is replaced by the next one, as each change
+// has the whole of the rates after it. It is safe for concurrent use.
+type watchers struct {
+	mu      sync.Mutex
+	streams map[chan RateChange]bool
+}
+
+// currentWatchers are the streams of rate changes of the API.
+var currentWatchers = &watchers{streams: make(map[chan RateChange]bool)}
+
+// watch returns a stream of rate changes, and a function that ends the stream.
+func (ws *watchers) watch() (<-chan RateChange, func()) {
+	stream := make(chan RateChange, 1)
+	ws.mu.Lock()
+	ws.streams[stream] = true
+	ws.mu.Unlock()
+
+	return stream, func() {
+		ws.mu.Lock()
+		delete(ws.streams, stream)
+		ws.mu.Unlock()
+	}
+}
+
+// publish sends a RateChange for an event and the rates after the change to every stream, without
+// waiting for streams that have not received the previous change.
+func (ws *watchers) publish(event string, rates *WeeklyRates) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if len(ws.streams) == 0 {
+		return
+	}
+	change := RateChange{Event: event, Time: time.Now().UTC().Truncate(time.Second), Rates: rates.Config()}
+	for stream := range ws.streams {
+		select {
+		case <-stream:
+		default:
+		}
+		stream <- change
+	}
+}
+
+// RatesServer implements the Rates service of the gRPC API with the same rates, discounts,
+// occupancy and reservations as the REST API.
+type RatesServer struct {
+	rpc.UnimplementedRatesServer
+}
+
+// NewGRPCServer returns a gRPC server with the Rates service registered.
+func NewGRPCServer(options ...grpc.ServerOption) *grpc.Server {
+	server := grpc.NewServer(options...)
+	rpc.RegisterRatesServer(server, RatesServer{})
+	return server
+}
+
+// grpcError returns a gRPC error with a status code, and the code and field of an error as an
+// ErrorInfo detail, as they are in the body of an error response of the REST API.
+func grpcError(c codes.Code, err error) error {
+	httpStatus := uint(http.StatusBadRequest)
+	if c == codes.Internal {
+		httpStatus = http.StatusInternalServerError
+	}
+	code, field := ErrorCode(err, httpStatus)
+
+	info := &errdetails.ErrorInfo{Reason: code, Domain: ErrorDomain}
+	if field != "" {
+		info.Metadata = map[string]string{"field": field}
+	}
+	s, detailErr := status.New(c, err.Error()).WithDetails(info)
+	if detailErr != nil {
+		return status.Error(c, err.Error())
+	}
+	return s.Err()
+}
+
+// Quote prices a stay as RateGetHandleFunc does, with its breakdown.
+func (RatesServer) Quote(ctx context.Context, request *rpc.QuoteRequest) (*rpc.QuoteResponse, error) {
+	duration, err := ParseDuration(request.Start, request.End)
+	if err != nil {
+		return nil, grpcError(codes.InvalidArgument, err)
+	}
+
+	options := QuoteOptions{
+		Vehicle:   request.Vehicle,
+		Discounts: currentDiscounts,
+		Codes:     request.Codes,
+		Occupancy: currentOccupancy,
+	}
+	rates := currentWeeklyRates
+	quote, err := rates.QuoteWithOptions(duration, options)
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return nil, grpcError(codes.InvalidArgument, err)
+	} else if err != nil {
+		return nil, grpcError(codes.NotFound, newError(CodeRateUnavailable, "start", "%w", err))
+	}
+	capacity := rates.Capacity()
+	free := spotFree(duration, time.Now(), capacity)
+	if free != nil && !*free {
+		return nil, grpcError(codes.ResourceExhausted, newError(CodeCapacityExceeded, "start", "all %d spots are taken during the stay", capacity))
+	}
+
+	rate := NewRate(duration, quote)
+	return &rpc.QuoteResponse{
+		Start:          rate.Start.Format(time.RFC3339),
+		End:            rate.End.Format(time.RFC3339),
+		Price:          uint64(rate.Price),
+		Currency:       rate.Currency,
+		FormattedPrice: rate.FormattedPrice,
+		Vehicle:        rate.Vehicle,
+		Multiplier:     rate.Multiplier,
+		Available:      free,
+		Discounts:      discountResultsToProto(rate.Discounts),
+		Breakdown:      quoteToProto(quote),
+	}, nil
+}
+
+// BatchQuote prices many stays as BatchHandleFunc does.
+func (RatesServer) BatchQuote(ctx context.Context, request *rpc.BatchQuoteRequest) (*rpc.BatchQuoteResponse, error) {
+	if len(request.Intervals) > MaxBatchSize {
+		err := newError(CodeBatchTooLarge, "", "batch of %d intervals exceeds the maximum of %d", len(request.Intervals), MaxBatchSize)
+		return nil, grpcError(codes.InvalidArgument, err)
+	}
+
+	intervals := make([]Interval, 0, len(request.Intervals))
+	for _, interval := range request.Intervals {
+		intervals = append(intervals, Interval{Start: interval.Start, End: interval.End})
+	}
+
+	batch := currentWeeklyRates.QuoteBatch(intervals)
+	response := &rpc.BatchQuoteResponse{Results: make([]*rpc.BatchResult, 0, len(batch.Results))}
+	for _, result := range batch.Results {
+		r := &rpc.BatchResult{
+			Start:          result.Start,
+			End:            result.End,
+			Status:         uint32(result.Status),
+			Currency:       result.Currency,
+			FormattedPrice: result.FormattedPrice,
+			Reason:         result.Reason,
+		}
+		if result.Price != nil {
+			price := uint64(*result.Price)
+			r.Price = &price
+		}
+		response.Results = append(response.Results, r)
+	}
+	return response, nil
+}
+
+// GetRates exports the current rates as RatesGetHandleFunc does.
+func (RatesServer) GetRates(ctx context.Context, request *rpc.GetRatesRequest) (*rpc.RateConfig, error) {
+	return configToProto(currentWeeklyRates.Config()), nil
+}
+
+// ReplaceRates replaces all rates with ReplaceRatesWithConfig.
+func (RatesServer) ReplaceRates(ctx context.Context, request *rpc.RateConfig) (*rpc.UpdateRatesResponse, error) {
+	config, err := configFromProto(request)
+	if err == nil {
+		err = ReplaceRatesWithConfig(config)
+	}
+	if err != nil {
+		return nil, grpcError(codes.InvalidArgument, err)
+	}
+	return &rpc.UpdateRatesResponse{Desc: "replaced rates"}, nil
+}
+
+// UpdateRates adds rates with UpdateRatesWithConfig.
+func (RatesServer) UpdateRates(ctx context.Context, request *rpc.RateConfig) (*rpc.UpdateRatesResponse, error) {
+	config, err := configFromProto(request)
+	if err == nil {
+		err = UpdateRatesWithConfig(config)
+	}
+	if err != nil {
+		return nil, grpcError(codes.InvalidArgument, err)
+	}
+	return &rpc.UpdateRatesResponse{Desc: "updated rates"}, nil
+}
+
+// WatchRates sends the current rates, and then a RateChange for every change to the rates, until the
+// stream is cancelled.
+func (RatesServer) WatchRates(request *rpc.WatchRatesRequest, stream rpc.Rates_WatchRatesServer) error {
+	changes, stop := currentWatchers.watch()
+	defer stop()
+
+	current := RateChange{Event: EventRatesCurrent, Time: time.Now().UTC().Truncate(time.Second), Rates: currentWeeklyRates.Config()}
+	if err := stream.Send(rateChangeToProto(current)); err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case change := <-changes:
+			if err := stream.Send(rateChangeToProto(change)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func rateChangeToProto(change RateChange) *rpc.RateChange {
+	return &rpc.RateChange{Event: change.Event, Time: change.Time.Format(time.RFC3339), Rates: configToProto(change.Rates)}
+}
+
+func quoteToProto(quote Quote) *rpc.Quote {
+	q := &rpc.Quote{Currency: quote.Currency, Vehicle: quote.Vehicle, Subtotal: uint64(quote.Subtotal), Total: uint64(quote.Total)}
+	for _, item := range quote.Items {
+		q.Items = append(q.Items, &rpc.LineItem{
+			Day:       item.Day,
+			Times:     item.Times,
+			Special:   item.Special,
+			Tier:      item.Tier,
+			Grace:     item.Grace,
+			Minutes:   item.Minutes,
+			UnitPrice: uint64(item.UnitPrice),
+			Subtotal:  uint64(item.Subtotal),
+		})
+	}
+	for _, adjustment := range quote.Adjustments {
+		q.Adjustments = append(q.Adjustments, &rpc.Adjustment{
+			Type:     adjustment.Type,
+			Desc:     adjustment.Description,
+			Amount:   int64(adjustment.Amount),
+			Included: adjustment.Included,
+		})
+	}
+	return q
+}
+
+func discountResultsToProto(results []DiscountResult) []*rpc.DiscountResult {
+	var discounts []*rpc.DiscountResult
+	for _, result := range results {
+		discounts = append(discounts, &rpc.DiscountResult{Code: result.Code, Applied: result.Applied, Amount: uint64(result.Amount), Reason: result.Reason})
+	}
+	return discounts
+}
+
+func configToProto(config ConfigRates) *rpc.RateConfig {
+	c := &rpc.RateConfig{
+		Currency:       config.Currency,
+		DefaultVehicle: config.DefaultVehicle,
+		Charges:        chargesToProto(config.Charges),
+		Grace:          graceToProto(config.Grace),
+		Capacity:       uint64(config.Capacity),
+	}
+	for _, special := range config.Specials {
+		s := &rpc.SpecialRate{
+			Name:        special.Name,
+			Type:        special.Type,
+			Price:       uint64(special.Price),
+			Days:        special.Days,
+			EnterAfter:  special.EnterAfter,
+			EnterBefore: special.EnterBefore,
+			ExitAfter:   special.ExitAfter,
+			ExitBefore:  special.ExitBefore,
+		}
+		if special.Start != nil {
+			s.Start = special.Start.Format(time.RFC3339)
+		}
+		if special.End != nil {
+			s.End = special.End.Format(time.RFC3339)
+		}
+		c.Specials = append(c.Specials, s)
+	}
+	for _, rule := range config.Refunds {
+		c.Refunds = append(c.Refunds, &rpc.RefundRule{Notice: rule.Notice, Percent: rule.Percent})
+	}
+	for _, rate := range config.Rates {
+		r := &rpc.Rate{
+			Days:    rate.Days,
+			Times:   rate.Times,
+			Price:   uint64(rate.Price),
+			Charges: chargesToProto(rate.Charges),
+			Grace:   graceToProto(rate.Grace),
+		}
+		for _, vehicle := range rate.Vehicles {
+			r.Vehicles = append(r.Vehicles, &rpc.VehiclePrice{Class: vehicle.Class, Price: uint64(vehicle.Price)})
+		}
+		if rate.Ladder != nil {
+			r.Ladder = &rpc.Ladder{Max: uint64(rate.Ladder.Max)}
+			for _, tier := range rate.Ladder.Tiers {
+				r.Ladder.Tiers = append(r.Ladder.Tiers, &rpc.LadderTier{Minutes: tier.Minutes, Every: tier.Every, Price: uint64(tier.Price)})
+			}
+		}
+		for _, band := range rate.Occupancy {
+			r.Occupancy = append(r.Occupancy, &rpc.OccupancyBand{Above: band.Above, Percent: band.Percent})
+		}
+		c.Rates = append(c.Rates, r)
+	}
+	return c
+}
+
+func chargesToProto(charges []Charge) []*rpc.Charge {
+	var c []*rpc.Charge
+	for _, charge := range charges {
+		c = append(c, &rpc.Charge{Name: charge.Name, Type: charge.Type, Percent: charge.Percent, Inclusive: charge.Inclusive, Amount: uint64(charge.Amount)})
+	}
+	return c
+}
+
+func graceToProto(grace *Grace) *rpc.Grace {
+	if grace == nil {
+		return nil
+	}
+	return &rpc.Grace{Minutes: grace.Minutes, FreeMinutes: grace.FreeMinutes}
+}
+
+// configFromProto returns the configuration of a RateConfig, or an error if the start or end of a
+// special rate is not in RFC3339 format.
+func configFromProto(config *rpc.RateConfig) (ConfigRates, error) {
+	c := ConfigRates{
+		Currency:       config.Currency,
+		DefaultVehicle: config.DefaultVehicle,
+		Charges:        chargesFromProto(config.Charges),
+		Grace:          graceFromProto(config.Grace),
+		Capacity:       uint(config.Capacity),
+		Rates:          []ConfigRate{},
+	}
+	for _, special := range config.Specials {
+		s := SpecialRate{
+			Name:        special.Name,
+			Type:        special.Type,
+			Price:       uint(special.Price),
+			Days:        special.Days,
+			EnterAfter:  special.EnterAfter,
+			EnterBefore: special.EnterBefore,
+			ExitAfter:   special.ExitAfter,
+			ExitBefore:  special.ExitBefore,
+		}
+		for _, at := range []struct {
+			value string
+			time  **time.Time
+		}{{special.Start, &s.Start}, {special.End, &s.End}} {
+			if at.value == "" {
+				continue
+			}
+			t, err := time.Parse(time.RFC3339, at.value)
+			if err != nil {
+				return c, newError(CodeInvalidSpecial, "specials", "invalid time '%s' for special rate '%s', must be in RFC3339 format", at.value, special.Name)
+			}
+			*at.time = &t
+		}
+		c.Specials = append(c.Specials, s)
+	}
+	for _, rule := range config.Refunds {
+		c.Refunds = append(c.Refunds, RefundRule{Notice: rule.Notice, Percent: rule.Percent})
+	}
+	for _, rate := range config.Rates {
+		r := ConfigRate{
+			Days:    rate.Days,
+			Times:   rate.Times,
+			Price:   uint(rate.Price),
+			Charges: chargesFromProto(rate.Charges),
+			Grace:   graceFromProto(rate.Grace),
+		}
+		for _, vehicle := range rate.Vehicles {
+			r.Vehicles = append(r.Vehicles, VehiclePrice{Class: vehicle.Class, Price: uint(vehicle.Price)})
+		}
+		if rate.Ladder != nil {
+			r.Ladder = &Ladder{Max: uint(rate.Ladder.Max)}
+			for _, tier := range rate.Ladder.Tiers {
+				r.Ladder.Tiers = append(r.Ladder.Tiers, LadderTier{Minutes: tier.Minutes, Every: tier.Every, Price: uint(tier.Price)})
+			}
+		}
+		for _, band := range rate.Occupancy {
+			r.Occupancy = append(r.Occupancy, OccupancyBand{Above: band.Above, Percent: band.Percent})
+		}
+		c.Rates = append(c.Rates, r)
+	}
+	return c, nil
+}
+
+func chargesFromProto(charges []*rpc.Charge) []Charge {
+	var c []Charge
+	for _, charge := range charges {
+		c = append(c, Charge{Name: charge.Name, Type: charge.Type, Percent: charge.Percent, Inclusive: charge.Inclusive, Amount: uint(charge.Amount)})
+	}
+	return c
+}
+
+func graceFromProto(grace *rpc.Grace) *Grace {
+	if grace == nil {
+		return nil
+	}
+	return &Grace{Minutes: grace.Minutes, FreeMinutes: grace.FreeMinutes}
+}
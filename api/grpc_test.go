@@ -0,0 +1,171 @@
+package api_test
+
+import (
+	"context"
+	"github.com/jtide/gopark/api"
+	"github.com/jtide/gopark/rpc"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"testing"
+	"time"
+)
+
+// newRatesClient returns a client of the gRPC API, served in memory with the options until the test
+// ends.
+func newRatesClient(t *testing.T, options ...grpc.ServerOption) rpc.RatesClient {
+	listener := bufconn.Listen(1 << 20)
+	server := api.NewGRPCServer(options...)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	dial := func(ctx context.Context, _ string) (net.Conn, error) {
+		return listener.DialContext(ctx)
+	}
+	conn, err := grpc.NewClient("passthrough:///bufconn", grpc.WithContextDialer(dial), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return rpc.NewRatesClient(conn)
+}
+
+// errorReason returns the status code and the error code of the ErrorInfo detail of a gRPC error.
+func errorReason(err error) (codes.Code, string) {
+	s := status.Convert(err)
+	for _, detail := range s.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			return s.Code(), info.Reason
+		}
+	}
+	return s.Code(), ""
+}
+
+func TestRatesServerQuote(t *testing.T) {
+	assert.NoError(t, api.ReplaceRates(api.JSONDefaultRateConfig))
+	client := newRatesClient(t)
+	ctx := context.Background()
+
+	quote, err := client.Quote(ctx, &rpc.QuoteRequest{Start: "2015-07-01T07:00:00Z", End: "2015-07-01T12:00:00Z"})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1750), quote.Price)
+	assert.Equal(t, "$17.50", quote.FormattedPrice)
+	assert.Equal(t, uint64(1750), quote.Breakdown.Total)
+	assert.Len(t, quote.Breakdown.Items, 1)
+	assert.Nil(t, quote.Available)
+
+	tests := []struct {
+		request *rpc.QuoteRequest
+		code    codes.Code
+		reason  string
+	}{
+		{&rpc.QuoteRequest{Start: "2015-07-02T07:00:00Z", End: "2015-07-02T12:00:00Z"}, codes.NotFound, api.CodeRateUnavailable},
+		{&rpc.QuoteRequest{Start: "2015-07-01T12:00:00Z", End: "2015-07-01T07:00:00Z"}, codes.InvalidArgument, api.CodeEndBeforeStart},
+		{&rpc.QuoteRequest{Start: "2015-07-01T07:00:00Z", End: "2015-07-01T12:00:00Z", Vehicle: "truck"}, codes.InvalidArgument, api.CodeInvalidVehicle},
+	}
+
+	for _, test := range tests {
+		_, err := client.Quote(ctx, test.request)
+		code, reason := errorReason(err)
+		assert.Equal(t, test.code, code, test.request.Start)
+		assert.Equal(t, test.reason, reason, test.request.Start)
+	}
+}
+
+func TestRatesServerBatchQuote(t *testing.T) {
+	assert.NoError(t, api.ReplaceRates(api.JSONDefaultRateConfig))
+	client := newRatesClient(t)
+
+	batch, err := client.BatchQuote(context.Background(), &rpc.BatchQuoteRequest{Intervals: []*rpc.Interval{
+		{Start: "2015-07-01T07:00:00Z", End: "2015-07-01T12:00:00Z"},
+		{Start: "2015-07-02T07:00:00Z", End: "2015-07-02T12:00:00Z"},
+		{Start: "x", End: "y"},
+	}})
+	assert.NoError(t, err)
+	assert.Len(t, batch.Results, 3)
+	assert.Equal(t, uint32(200), batch.Results[0].Status)
+	assert.Equal(t, uint64(1750), batch.Results[0].GetPrice())
+	assert.Equal(t, uint32(404), batch.Results[1].Status)
+	assert.Nil(t, batch.Results[1].Price)
+	assert.Equal(t, uint32(400), batch.Results[2].Status)
+}
+
+func TestRatesServerReplaceAndUpdateRates(t *testing.T) {
+	client := newRatesClient(t)
+	ctx := context.Background()
+	defer api.ReplaceRates(api.JSONDefaultRateConfig)
+
+	config := &rpc.RateConfig{
+		Currency: "EUR",
+		Grace:    &rpc.Grace{Minutes: 10},
+		Rates: []*rpc.Rate{{
+			Days:     "wed",
+			Times:    "0600-1800",
+			Price:    1200,
+			Vehicles: []*rpc.VehiclePrice{{Class: "motorcycle", Price: 600}},
+			Charges:  []*rpc.Charge{{Name: "Tax", Type: "tax", Percent: 10}},
+		}},
+		Specials: []*rpc.SpecialRate{{Name: "Fireworks", Type: "event", Price: 1000, Start: "2015-07-04T18:00:00Z", End: "2015-07-04T23:00:00Z"}},
+	}
+	response, err := client.ReplaceRates(ctx, config)
+	assert.NoError(t, err)
+	assert.Equal(t, "replaced rates", response.Desc)
+
+	_, err = client.UpdateRates(ctx, &rpc.RateConfig{Rates: []*rpc.Rate{{Days: "thurs", Times: "0600-1800", Price: 900}}})
+	assert.NoError(t, err)
+
+	rates, err := client.GetRates(ctx, &rpc.GetRatesRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, "EUR", rates.Currency)
+	assert.Equal(t, uint64(10), rates.Grace.Minutes)
+	assert.Len(t, rates.Rates, 2)
+	assert.Equal(t, uint64(600), rates.Rates[0].Vehicles[0].Price)
+	assert.Equal(t, "2015-07-04T18:00:00Z", rates.Specials[0].Start)
+
+	// The same validation as the REST API applies.
+	tests := []struct {
+		config *rpc.RateConfig
+		reason string
+	}{
+		{&rpc.RateConfig{Rates: []*rpc.Rate{{Days: "thurs", Times: "0700-0800", Price: 900}}}, api.CodeRateConflict},
+		{&rpc.RateConfig{Rates: []*rpc.Rate{{Days: "someday", Times: "0700-0800", Price: 900}}}, api.CodeInvalidDays},
+		{&rpc.RateConfig{Specials: []*rpc.SpecialRate{{Name: "Late", Type: "event", Start: "tonight"}}}, api.CodeInvalidSpecial},
+	}
+
+	for _, test := range tests {
+		_, err := client.UpdateRates(ctx, test.config)
+		code, reason := errorReason(err)
+		assert.Equal(t, codes.InvalidArgument, code)
+		assert.Equal(t, test.reason, reason)
+	}
+}
+
+func TestRatesServerWatchRates(t *testing.T) {
+	assert.NoError(t, api.ReplaceRates(api.JSONDefaultRateConfig))
+	client := newRatesClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.WatchRates(ctx, &rpc.WatchRatesRequest{})
+	assert.NoError(t, err)
+	change, err := stream.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, api.EventRatesCurrent, change.Event)
+	assert.Equal(t, "USD", change.Rates.Currency)
+
+	assert.NoError(t, api.ReplaceRates([]byte(`{"currency": "EUR", "rates": [{"days": "wed", "times": "0600-1800", "price": 1200}]}`)))
+	defer api.ReplaceRates(api.JSONDefaultRateConfig)
+	change, err = stream.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, api.EventRatesReplaced, change.Event)
+	assert.Equal(t, "EUR", change.Rates.Currency)
+
+	assert.NoError(t, api.RemoveRates("wed", "0600-1800"))
+	change, err = stream.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, api.EventRatesRemoved, change.Event)
+	assert.Empty(t, change.Rates.Rates)
+}
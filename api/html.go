@@ -0,0 +1,115 @@
+package api
+
+import (
+	"bytes"
+	"html/template"
+)
+
+// page is the content of a simple HTML page for a quote or a message. Prices are formatted in
+// their currency, and Discounts describes the result of each discount code.
+type page struct {
+	Title     string
+	Message   string
+	Code      string
+	Link      string
+	Start     string
+	End       string
+	Price     string
+	Discounts []string
+	Breakdown *pageBreakdown
+}
+
+type pageBreakdown struct {
+	Items       []pageItem
+	Subtotal    string
+	Adjustments []pageAdjustment
+	Total       string
+}
+
+type pageItem struct {
+	Day       string
+	Times     string
+	Minutes   uint64
+	UnitPrice string
+	Subtotal  string
+}
+
+type pageAdjustment struct {
+	Type        string
+	Description string
+	Amount      string
+}
+
+// newPageBreakdown returns the breakdown of a quote for a page, or nil if there is no quote.
+func newPageBreakdown(q *Quote) *pageBreakdown {
+	if q == nil {
+		return nil
+	}
+
+	breakdown := &pageBreakdown{Subtotal: q.format(int(q.Subtotal)), Total: q.Price().String()}
+	for _, item := range q.Items {
+		breakdown.Items = append(breakdown.Items, pageItem{item.Day, item.label(), item.Minutes, q.format(int(item.UnitPrice)), q.format(int(item.Subtotal))})
+	}
+	for _, adjustment := range q.Adjustments {
+		breakdown.Adjustments = append(breakdown.Adjustments, pageAdjustment{adjustment.Type, adjustment.Description, q.format(adjustment.Amount)})
+	}
+	return breakdown
+}
+
+var pageTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}} - gopark</title>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{- if .Message}}
+<p>{{.Message}}</p>
+{{- end}}
+{{- if .Link}}
+<p><a href="{{.Link}}">{{.Code}}</a></p>
+{{- end}}
+{{- if .Price}}
+<dl>
+<dt>Start</dt><dd>{{.Start}}</dd>
+<dt>End</dt><dd>{{.End}}</dd>
+<dt>Price</dt><dd>{{.Price}}</dd>
+</dl>
+{{- end}}
+{{- if .Discounts}}
+<ul>
+{{- range .Discounts}}
+<li>{{.}}</li>
+{{- end}}
+</ul>
+{{- end}}
+{{- with .Breakdown}}
+<table>
+<thead><tr><th>Day</th><th>Times</th><th>Minutes</th><th>Unit price</th><th>Subtotal</th></tr></thead>
+<tbody>
+{{- range .Items}}
+<tr><td>{{.Day}}</td><td>{{.Times}}</td><td>{{.Minutes}}</td><td>{{.UnitPrice}}</td><td>{{.Subtotal}}</td></tr>
+{{- end}}
+{{- if .Adjustments}}
+<tr><th colspan="4">Subtotal</th><td>{{.Subtotal}}</td></tr>
+{{- end}}
+{{- range .Adjustments}}
+<tr><td>{{.Type}}</td><td colspan="3">{{.Description}}</td><td>{{.Amount}}</td></tr>
+{{- end}}
+</tbody>
+<tfoot><tr><th colspan="4">Total</th><td>{{.Total}}</td></tr></tfoot>
+</table>
+{{- end}}
+</body>
+</html>
+`))
+
+// render returns the page as HTML.
+func (p page) render() ([]byte, error) {
+	var b bytes.Buffer
+	if err := pageTemplate.Execute(&b, p); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
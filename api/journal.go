@@ -0,0 +1,117 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// compactAfter is the number of entries appended to a journal before its store is compacted.
+const compactAfter = 1000
+
+// journal is a file of the changes to a store, with one JSON entry per line, that is replayed when the
+// store is opened. Each change appends its entries to the file, rather than rewriting the whole store,
+// and the store rewrites the file with only its current entries once it has grown by compactAfter
+// entries. A journal without a path only counts its entries.
+type journal struct {
+	path    string
+	entries int
+}
+
+// replay calls apply with each entry of the file of the journal, in the order they were appended. A
+// file that does not exist has no entries. A last entry that is cut short, by a failure while it was
+// appended, is ignored.
+func (j *journal) replay(apply func(entry []byte) error) error {
+	if j.path == "" {
+		return nil
+	}
+	file, err := os.Open(j.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for line := 1; ; line++ {
+		entry, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		last := err == io.EOF
+		if len(bytes.TrimSpace(entry)) > 0 && (!last || json.Valid(entry)) {
+			if err := apply(entry); err != nil {
+				return fmt.Errorf("entry on line %d: %w", line, err)
+			}
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+// append adds entries to the end of the file of the journal.
+func (j *journal) append(entries ...interface{}) error {
+	j.entries += len(entries)
+	if j.path == "" {
+		return nil
+	}
+
+	data, err := marshalEntries(entries)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(j.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// full returns true if the store of the journal should be compacted.
+func (j *journal) full() bool {
+	return j.entries >= compactAfter
+}
+
+// rewrite replaces the file of the journal with the current entries of its store. The file is replaced
+// in one step, so that it is never left half written.
+func (j *journal) rewrite(entries []interface{}) error {
+	j.entries = 0
+	if j.path == "" {
+		return nil
+	}
+
+	data, err := marshalEntries(entries)
+	if err != nil {
+		return err
+	}
+	tmp := j.path + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, j.path)
+}
+
+// marshalEntries returns the entries of a journal as lines of JSON.
+func marshalEntries(entries []interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
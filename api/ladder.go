@@ -0,0 +1,92 @@
+package api
+
+import (
+	"fmt"
+)
+
+// Ladder is a progressive price for the length of a stay, made of Tiers in order, such as "$5 for the
+// first hour, then $3 for each additional hour". The price of the stay is at most Max, when it is not 0.
+type Ladder struct {
+	Tiers []LadderTier `json:"tiers" xml:"Tier"`
+	Max   uint         `json:"max,omitempty"`
+}
+
+// LadderTier is a band of a Ladder that lasts for Minutes of the stay, or for the rest of the stay
+// if Minutes is 0, as only the last tier can. The Price is for each started period of Every minutes
+// in the band, or for the whole band if Every is 0. Prices are in the minor unit of the currency of
+// the configuration.
+type LadderTier struct {
+	Minutes uint64 `json:"minutes,omitempty"`
+	Every   uint64 `json:"every,omitempty"`
+	Price   uint   `json:"price"`
+}
+
+// Validate returns an error if the ladder has no tiers, or if any tier but the last lasts for the
+// rest of the stay, or the last does not.
+func (l Ladder) Validate() error {
+	if len(l.Tiers) == 0 {
+		return newError(CodeInvalidLadder, "ladder", "ladder must have at least one tier")
+	}
+	for i, tier := range l.Tiers {
+		last := i == len(l.Tiers)-1
+		if last && tier.Minutes != 0 {
+			return newError(CodeInvalidLadder, "ladder", "the last tier of a ladder must last for the rest of the stay, without minutes")
+		} else if !last && tier.Minutes == 0 {
+			return newError(CodeInvalidLadder, "ladder", "tier %d of a ladder must have minutes, only the last tier lasts for the rest of the stay", i+1)
+		}
+	}
+	return nil
+}
+
+// items returns a line item for each tier used by a stay of a number of minutes, and the cap of the
+// ladder, if the stay reaches it. The first tier is always used, even by a stay of no minutes.
+func (l Ladder) items(item LineItem, minutes uint64) ([]LineItem, *Adjustment) {
+	var items []LineItem
+	var subtotal uint
+	var from uint64
+	remaining := minutes
+
+	for i, tier := range l.Tiers {
+		if remaining == 0 && i > 0 {
+			break
+		}
+
+		band := remaining
+		if tier.Minutes != 0 && tier.Minutes < remaining {
+			band = tier.Minutes
+		}
+
+		periods := uint64(1)
+		if tier.Every != 0 {
+			periods = (band + tier.Every - 1) / tier.Every
+		}
+
+		item.Tier = tier.describe(from)
+		item.Minutes = band
+		item.UnitPrice = tier.Price
+		item.Subtotal = tier.Price * uint(periods)
+		items = append(items, item)
+
+		subtotal += item.Subtotal
+		from += band
+		remaining -= band
+	}
+
+	if l.Max == 0 || subtotal <= l.Max {
+		return items, nil
+	}
+	return items, &Adjustment{Type: "cap", Description: "maximum price of the ladder", Amount: int(l.Max) - int(subtotal)}
+}
+
+// describe returns the band of the tier for a line item, such as "0-60 min" or "60+ min, per 60 min",
+// for a tier that starts a number of minutes into the stay.
+func (t LadderTier) describe(from uint64) string {
+	band := fmt.Sprintf("%d+ min", from)
+	if t.Minutes != 0 {
+		band = fmt.Sprintf("%d-%d min", from, from+t.Minutes)
+	}
+	if t.Every != 0 {
+		band += fmt.Sprintf(", per %d min", t.Every)
+	}
+	return band
+}
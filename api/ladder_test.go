@@ -0,0 +1,99 @@
+package api_test
+
+import (
+	"github.com/jtide/gopark/api"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+var jsonLadderConfig = []byte(`{
+	"rates": [
+		{"days": "wed", "times": "0600-2200", "price": 0, "ladder": {
+			"tiers": [{"minutes": 60, "price": 500}, {"every": 60, "price": 300}],
+			"max": 2000
+		}},
+		{"days": "thurs", "times": "0600-2200", "price": 0, "ladder": {
+			"tiers": [{"minutes": 30, "price": 0}, {"minutes": 90, "every": 30, "price": 100}, {"price": 1500}]
+		}}
+	]
+}`)
+
+func TestQuoteByDurationWithLadder(t *testing.T) {
+	rates := api.NewWeeklyRates()
+	err := rates.Update(jsonLadderConfig)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		start string
+		end   string
+		tiers []string
+		total uint
+	}{
+		{"2015-07-01T07:00:00Z", "2015-07-01T07:00:00Z", []string{"0-60 min"}, 500},
+		{"2015-07-01T07:00:00Z", "2015-07-01T07:45:00Z", []string{"0-60 min"}, 500},
+		{"2015-07-01T07:00:00Z", "2015-07-01T08:00:00Z", []string{"0-60 min"}, 500},
+		{"2015-07-01T07:00:00Z", "2015-07-01T08:01:00Z", []string{"0-60 min", "60+ min, per 60 min"}, 800},
+		{"2015-07-01T07:00:00Z", "2015-07-01T10:30:00Z", []string{"0-60 min", "60+ min, per 60 min"}, 1400},
+		// Capped at the maximum
+		{"2015-07-01T07:00:00Z", "2015-07-01T21:00:00Z", []string{"0-60 min", "60+ min, per 60 min"}, 2000},
+		{"2015-07-02T07:00:00Z", "2015-07-02T07:20:00Z", []string{"0-30 min"}, 0},
+		{"2015-07-02T07:00:00Z", "2015-07-02T08:10:00Z", []string{"0-30 min", "30-120 min, per 30 min"}, 200},
+		{"2015-07-02T07:00:00Z", "2015-07-02T12:00:00Z", []string{"0-30 min", "30-120 min, per 30 min", "120+ min"}, 1800},
+	}
+
+	for _, test := range tests {
+		duration, err := api.ParseDuration(test.start, test.end)
+		assert.NoError(t, err)
+		quote, err := rates.QuoteByDuration(duration)
+		assert.NoError(t, err)
+
+		var tiers []string
+		for _, item := range quote.Items {
+			tiers = append(tiers, item.Tier)
+		}
+		assert.Equal(t, test.tiers, tiers, test.end)
+		assert.Equal(t, test.total, quote.Total, test.end)
+	}
+}
+
+func TestQuoteByDurationWithLadderCap(t *testing.T) {
+	rates := api.NewWeeklyRates()
+	err := rates.Update(jsonLadderConfig)
+	assert.NoError(t, err)
+
+	duration, err := api.ParseDuration("2015-07-01T07:00:00Z", "2015-07-01T21:00:00Z")
+	assert.NoError(t, err)
+	quote, err := rates.QuoteByDuration(duration)
+	assert.NoError(t, err)
+
+	assert.Equal(t, uint64(60), quote.Items[0].Minutes)
+	assert.Equal(t, uint64(780), quote.Items[1].Minutes)
+	assert.Equal(t, uint(300), quote.Items[1].UnitPrice)
+	assert.Equal(t, uint(3900), quote.Items[1].Subtotal)
+	assert.Equal(t, uint(4400), quote.Subtotal)
+	assert.Equal(t, []api.Adjustment{{Type: "cap", Description: "maximum price of the ladder", Amount: -2400}}, quote.Adjustments)
+	assert.Equal(t, uint(2000), quote.Total)
+
+	config := rates.Config()
+	assert.Equal(t, uint(2000), config.Rates[0].Ladder.Max)
+	_, err = config.CSV()
+	assert.ErrorIs(t, err, api.ErrNoEncoding)
+}
+
+func TestWeeklyRates_UpdateWithInvalidLadder(t *testing.T) {
+	configs := []string{
+		`{"rates": [{"days": "wed", "times": "0600-1800", "price": 0, "ladder": {"tiers": []}}]}`,
+		`{"rates": [{"days": "wed", "times": "0600-1800", "price": 0, "ladder": {"tiers": [{"minutes": 60, "price": 500}]}}]}`,
+		`{"rates": [{"days": "wed", "times": "0600-1800", "price": 0, "ladder": {"tiers": [{"price": 500}, {"every": 60, "price": 300}]}}]}`,
+		`{"rates": [{"days": "wed", "times": "0600-1800", "price": 0, "ladder": {"tiers": [{"price": -500}]}}]}`,
+		`{"rates": [{"days": "wed", "times": "0600-1800", "price": 0, "ladder": {"tiers": [{"price": 500}]}, "vehicles": [{"class": "ev", "price": 100}]}]}`,
+	}
+
+	for _, config := range configs {
+		rates := api.NewWeeklyRates()
+		err := rates.Update([]byte(config))
+		code, field := api.ErrorCode(err, 400)
+		assert.Equal(t, api.CodeInvalidLadder, code, config)
+		assert.Equal(t, "ladder", field, config)
+	}
+}
@@ -0,0 +1,281 @@
+package api
+
+import (
+	"context"
+	"github.com/jtide/gopark/rpc"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Budgets of requests of the Limiter.
+const (
+	BudgetQuotes    = "quotes"
+	BudgetMutations = "mutations"
+)
+
+// HeaderAPIKey is the header of the API key of a client.
+const HeaderAPIKey = "X-API-Key"
+
+// grpcMutations are the methods of the gRPC API that use the mutation budget. All others change
+// nothing, and use the quote budget.
+var grpcMutations = map[string]bool{
+	rpc.Rates_ReplaceRates_FullMethodName: true,
+	rpc.Rates_UpdateRates_FullMethodName:  true,
+}
+
+// chargeKey is the key of the value of the context of a request that a Limiter passed, which is the
+// charge of the request.
+type chargeKey struct{}
+
+// charge is the request that a Limiter took from the budget of a client, at a time, for a request it
+// passed.
+type charge struct {
+	limiter     *Limiter
+	client      string
+	budget      string
+	at          time.Time
+	reservation *rate.Reservation
+}
+
+// sweepInterval is how often the Limiter forgets clients that have their full budget.
+const sweepInterval = time.Minute
+
+// Limit is a token bucket of requests. Rate is the number of requests per second that refill the
+// bucket, and Burst the number of requests it holds, which is at least 1. A Limit with a Rate of 0
+// does not limit requests.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Limiter limits the requests of each client to the Limit of their budget. Quotes, and any other
+// request that does not change anything, such as an export of the rates, a batch quote or a GraphQL
+// query, use the quote budget, and all other requests use the mutation budget, so that a client that
+// floods the API with quotes can still change the rates. Clients are known by their API key, if it
+// is one of the keys of the Limiter, and otherwise by their IP address. Calls of the gRPC API share
+// the budgets of the client. It is safe for concurrent use.
+type Limiter struct {
+	mu      sync.Mutex
+	limits  map[string]Limit
+	keys    map[string]bool
+	clients map[string]*rate.Limiter
+	swept   time.Time
+}
+
+// NewLimiter returns a Limiter with limits for quotes and mutations, and the API keys of clients.
+func NewLimiter(quotes Limit, mutations Limit, keys ...string) *Limiter {
+	l := &Limiter{
+		limits:  map[string]Limit{BudgetQuotes: quotes, BudgetMutations: mutations},
+		keys:    make(map[string]bool),
+		clients: make(map[string]*rate.Limiter),
+		swept:   time.Now(),
+	}
+	for budget, limit := range l.limits {
+		if limit.Burst < 1 {
+			limit.Burst = 1
+			l.limits[budget] = limit
+		}
+	}
+	for _, key := range keys {
+		if key != "" {
+			l.keys[key] = true
+		}
+	}
+	return l
+}
+
+// Handler returns a handler that passes the requests that are within the budget of their client to
+// next, and rejects all others with a 429 status and a Retry-After header with the number of seconds
+// until the request would be allowed.
+func (l *Limiter) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		budget, client, now := budgetOf(r), l.client(r), time.Now()
+		reservation, wait := l.reserve(budget, client, now)
+		if wait == 0 {
+			c := &charge{limiter: l, client: client, budget: budget, at: now, reservation: reservation}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), chargeKey{}, c)))
+			return
+		}
+
+		r, ok := InitializeResponse(&w, r) // Required before WriteResponse
+		if !ok {
+			return
+		}
+		writeRateLimited(budget, wait, &w, r)
+	})
+}
+
+// recharge moves a request that a Limiter passed to another budget, once its handler knows what it
+// does, and returns 0 if that budget had a request to take, or otherwise the time until it will. The
+// request is returned to the budget it was first charged to either way. A request that no Limiter
+// passed is not limited.
+func recharge(r *http.Request, budget string) time.Duration {
+	c, ok := r.Context().Value(chargeKey{}).(*charge)
+	if !ok || c.budget == budget {
+		return 0
+	}
+
+	// A reservation is only returned in full when it is cancelled at the time it was made
+	now := time.Now()
+	reservation, wait := c.limiter.reserve(budget, c.client, now)
+	if c.reservation != nil {
+		c.reservation.CancelAt(c.at)
+	}
+	c.budget, c.at, c.reservation = budget, now, reservation
+	return wait
+}
+
+// writeRateLimited writes the response that rejects a request over a budget, with a Retry-After
+// header with the number of seconds until the request would be allowed.
+func writeRateLimited(budget string, wait time.Duration, w *http.ResponseWriter, r *http.Request) {
+	seconds, err := rateLimited(budget, wait)
+	(*w).Header().Set("Retry-After", strconv.Itoa(seconds))
+	WriteError(http.StatusTooManyRequests, err, w, r)
+}
+
+// UnaryInterceptor returns an interceptor of a gRPC server that passes the calls that are within the
+// budget of their client to the handler, and rejects all others as the StreamInterceptor does.
+func (l *Limiter) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, request interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := l.reserveCall(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, request)
+	}
+}
+
+// StreamInterceptor returns an interceptor of a gRPC server that passes the streams that are within
+// the budget of their client to the handler, and rejects all others with a ResourceExhausted status
+// and a retry-after header with the number of seconds until the call would be allowed. Each stream
+// takes one request from the budget when it is opened.
+func (l *Limiter) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(server interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := l.reserveCall(stream.Context(), info.FullMethod); err != nil {
+			return err
+		}
+		return handler(server, stream)
+	}
+}
+
+// reserveCall takes a gRPC call of a method from the budget of its client, and returns nil if the
+// budget had one to take, or otherwise the error that rejects the call.
+func (l *Limiter) reserveCall(ctx context.Context, method string) error {
+	budget := BudgetQuotes
+	if grpcMutations[method] {
+		budget = BudgetMutations
+	}
+	_, wait := l.reserve(budget, l.callClient(ctx), time.Now())
+	if wait == 0 {
+		return nil
+	}
+
+	seconds, err := rateLimited(budget, wait)
+	grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.Itoa(seconds)))
+	return grpcError(codes.ResourceExhausted, err)
+}
+
+// rateLimited returns the number of whole seconds until a request over a budget would be allowed, and
+// the error that rejects it.
+func rateLimited(budget string, wait time.Duration) (int, error) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	return seconds, newError(CodeRateLimited, "", "too many requests for the %s budget, retry in %v", budget, time.Duration(seconds)*time.Second)
+}
+
+// reserve takes a request from the budget of a client, and returns the reservation of the request and
+// 0 if the budget had one to take, or otherwise the time until it will, without taking it. A budget
+// without a limit has no reservations.
+func (l *Limiter) reserve(budget string, client string, now time.Time) (*rate.Reservation, time.Duration) {
+	limit := l.limits[budget]
+	if limit.Rate <= 0 {
+		return nil, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.swept) >= sweepInterval {
+		l.sweep(now)
+	}
+
+	key := budget + " " + client
+	bucket, ok := l.clients[key]
+	if !ok {
+		bucket = rate.NewLimiter(rate.Limit(limit.Rate), limit.Burst)
+		l.clients[key] = bucket
+	}
+	reservation := bucket.ReserveN(now, 1)
+	wait := reservation.DelayFrom(now)
+	if wait > 0 {
+		reservation.CancelAt(now)
+		return nil, wait
+	}
+	return reservation, 0
+}
+
+// sweep forgets the clients that have their full budget, as they are the same as a new client.
+func (l *Limiter) sweep(now time.Time) {
+	for key, bucket := range l.clients {
+		if bucket.TokensAt(now) >= float64(bucket.Burst()) {
+			delete(l.clients, key)
+		}
+	}
+	l.swept = now
+}
+
+// client returns the API key of a request, if it is one of the keys of the Limiter, and otherwise
+// the IP address the request was sent from.
+func (l *Limiter) client(r *http.Request) string {
+	return l.clientOf(r.Header.Get(HeaderAPIKey), r.RemoteAddr)
+}
+
+// callClient returns the API key in the metadata of a gRPC call, if it is one of the keys of the
+// Limiter, and otherwise the IP address the call was sent from.
+func (l *Limiter) callClient(ctx context.Context) string {
+	var key, address string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if keys := md.Get(HeaderAPIKey); len(keys) > 0 {
+			key = keys[0]
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		address = p.Addr.String()
+	}
+	return l.clientOf(key, address)
+}
+
+// clientOf returns the client of an API key, if it is one of the keys of the Limiter, and otherwise
+// of the IP address of a network address.
+func (l *Limiter) clientOf(key string, address string) string {
+	if l.keys[key] {
+		return "key:" + key
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	return "ip:" + host
+}
+
+// budgetOf returns the budget that a request is first charged to. A GraphQL request is charged to the
+// quote budget, without reading its body, and moved to the mutation budget by its handler if it is a
+// mutation.
+func budgetOf(r *http.Request) string {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return BudgetQuotes
+	}
+
+	switch r.URL.Path {
+	case "/api/rate/batch", "/api/rates/validate", "/api/graphql":
+		return BudgetQuotes
+	}
+	return BudgetMutations
+}
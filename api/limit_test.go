@@ -0,0 +1,180 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/jtide/gopark/api"
+	"github.com/jtide/gopark/rpc"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// limitedRequest sends a request from an address through a handler, and returns the response.
+func limitedRequest(handler http.Handler, method string, target string, remoteAddr string, key string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, nil)
+	r.RemoteAddr = remoteAddr
+	if key != "" {
+		r.Header.Set(api.HeaderAPIKey, key)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestLimiterRejectsClientsOverBudget(t *testing.T) {
+	assert.NoError(t, api.ReplaceRates(api.JSONDefaultRateConfig))
+	limiter := api.NewLimiter(api.Limit{Rate: 0.01, Burst: 2}, api.Limit{Rate: 0.01, Burst: 1}, "k1")
+	handler := limiter.Handler(api.NewServeMux())
+	quote := "/api/rate?start=2015-07-01T07:00:00Z&end=2015-07-01T12:00:00Z"
+
+	assert.Equal(t, http.StatusOK, limitedRequest(handler, http.MethodGet, quote, "192.0.2.1:1000", "").Code)
+	assert.Equal(t, http.StatusOK, limitedRequest(handler, http.MethodGet, "/api/rates", "192.0.2.1:1001", "").Code)
+
+	w := limitedRequest(handler, http.MethodGet, quote, "192.0.2.1:1002", "")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "100", w.Header().Get("Retry-After"))
+	var response api.APIStandardResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, uint(http.StatusTooManyRequests), response.Status)
+	assert.Equal(t, api.CodeRateLimited, response.Code)
+
+	// Mutations have their own budget
+	assert.Equal(t, http.StatusOK, limitedRequest(handler, http.MethodPost, "/api/occupancy?event=exit", "192.0.2.1:1003", "").Code)
+	assert.Equal(t, http.StatusTooManyRequests, limitedRequest(handler, http.MethodPost, "/api/occupancy?event=exit", "192.0.2.1:1004", "").Code)
+
+	// Other addresses, and clients with a known API key, have their own budgets
+	assert.Equal(t, http.StatusOK, limitedRequest(handler, http.MethodGet, quote, "192.0.2.2:1000", "").Code)
+	assert.Equal(t, http.StatusOK, limitedRequest(handler, http.MethodGet, quote, "192.0.2.1:1005", "k1").Code)
+	assert.Equal(t, http.StatusOK, limitedRequest(handler, http.MethodGet, quote, "192.0.2.1:1006", "k1").Code)
+	assert.Equal(t, http.StatusTooManyRequests, limitedRequest(handler, http.MethodGet, quote, "192.0.2.1:1007", "k1").Code)
+
+	// An unknown API key does not escape the budget of the address
+	assert.Equal(t, http.StatusTooManyRequests, limitedRequest(handler, http.MethodGet, quote, "192.0.2.1:1008", "k2").Code)
+}
+
+func TestLimiterBudgets(t *testing.T) {
+	assert.NoError(t, api.ReplaceRates(api.JSONDefaultRateConfig))
+	defer api.ReplaceRates(api.JSONDefaultRateConfig)
+
+	tests := []struct {
+		method string
+		target string
+		body   string
+		budget string
+	}{
+		{http.MethodGet, "/api/rates", "", api.BudgetQuotes},
+		{http.MethodPost, "/api/rate/batch", `[{"start": "2015-07-01T07:00:00Z", "end": "2015-07-01T12:00:00Z"}]`, api.BudgetQuotes},
+		{http.MethodPost, "/api/graphql", `{"query": "{ facility { free } }"}`, api.BudgetQuotes},
+		{http.MethodPost, "/api/graphql", `{"query": "mutation { removeRates(days: \"wed\", times: \"0600-1800\") { currency } }"}`, api.BudgetMutations},
+		{http.MethodDelete, "/api/rate?days=thurs&times=0000-0100", "", api.BudgetMutations},
+	}
+
+	for _, test := range tests {
+		limit := api.Limit{Rate: 0.01, Burst: 1}
+		handler := api.NewLimiter(limit, limit).Handler(api.NewServeMux())
+		send := func(method string, target string, body string) int {
+			r := httptest.NewRequest(method, target, strings.NewReader(body))
+			r.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			return w.Code
+		}
+
+		// The request takes the whole of its budget, and none of the other
+		assert.NotEqual(t, http.StatusTooManyRequests, send(test.method, test.target, test.body), test.target)
+		assert.Equal(t, http.StatusTooManyRequests, send(test.method, test.target, test.body), test.target)
+		if test.budget == api.BudgetQuotes {
+			assert.Equal(t, http.StatusOK, send(http.MethodPost, "/api/occupancy?event=exit", ""), test.target)
+		} else {
+			assert.Equal(t, http.StatusOK, send(http.MethodGet, "/api/occupancy", ""), test.target)
+		}
+	}
+}
+
+func TestLimiterWithoutLimit(t *testing.T) {
+	handler := api.NewLimiter(api.Limit{}, api.Limit{}).Handler(api.NewServeMux())
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, http.StatusOK, limitedRequest(handler, http.MethodGet, "/api/occupancy", "192.0.2.1:1000", "").Code)
+	}
+}
+
+func TestLimiterInterceptors(t *testing.T) {
+	assert.NoError(t, api.ReplaceRates(api.JSONDefaultRateConfig))
+	defer api.ReplaceRates(api.JSONDefaultRateConfig)
+	limiter := api.NewLimiter(api.Limit{Rate: 0.01, Burst: 1}, api.Limit{Rate: 0.01, Burst: 1}, "k1")
+	client := newRatesClient(t, grpc.UnaryInterceptor(limiter.UnaryInterceptor()), grpc.StreamInterceptor(limiter.StreamInterceptor()))
+	ctx := context.Background()
+	request := &rpc.QuoteRequest{Start: "2015-07-01T07:00:00Z", End: "2015-07-01T12:00:00Z"}
+
+	_, err := client.Quote(ctx, request)
+	assert.NoError(t, err)
+	var header metadata.MD
+	_, err = client.Quote(ctx, request, grpc.Header(&header))
+	code, reason := errorReason(err)
+	assert.Equal(t, codes.ResourceExhausted, code)
+	assert.Equal(t, api.CodeRateLimited, reason)
+	assert.Equal(t, []string{"100"}, header.Get("retry-after"))
+
+	// Exports and streams of changes use the quote budget, and changes to the rates their own
+	_, err = client.GetRates(ctx, &rpc.GetRatesRequest{})
+	code, _ = errorReason(err)
+	assert.Equal(t, codes.ResourceExhausted, code)
+	stream, err := client.WatchRates(ctx, &rpc.WatchRatesRequest{})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	code, _ = errorReason(err)
+	assert.Equal(t, codes.ResourceExhausted, code)
+	_, err = client.UpdateRates(ctx, &rpc.RateConfig{})
+	code, _ = errorReason(err)
+	assert.NotEqual(t, codes.ResourceExhausted, code)
+	_, err = client.UpdateRates(ctx, &rpc.RateConfig{})
+	code, _ = errorReason(err)
+	assert.Equal(t, codes.ResourceExhausted, code)
+
+	// Clients with a known API key in the metadata of the call have their own budgets
+	keyed := metadata.AppendToOutgoingContext(ctx, "x-api-key", "k1")
+	_, err = client.Quote(keyed, request)
+	assert.NoError(t, err)
+	unknown := metadata.AppendToOutgoingContext(ctx, "x-api-key", "k2")
+	_, err = client.Quote(unknown, request)
+	code, _ = errorReason(err)
+	assert.Equal(t, codes.ResourceExhausted, code)
+}
+
+// unreadBody is the body of a request that records whether it was read.
+type unreadBody struct {
+	read bool
+}
+
+func (b *unreadBody) Read(p []byte) (int, error) {
+	b.read = true
+	return 0, io.EOF
+}
+
+func TestLimiterRejectsGraphQLBeforeReadingBody(t *testing.T) {
+	limit := api.Limit{Rate: 0.01, Burst: 1}
+	handler := api.NewLimiter(limit, limit).Handler(api.NewServeMux())
+	query := `{"query": "{ facility { free } }"}`
+
+	r := httptest.NewRequest(http.MethodPost, "/api/graphql", strings.NewReader(query))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	body := &unreadBody{}
+	r = httptest.NewRequest(http.MethodPost, "/api/graphql", body)
+	r.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.False(t, body.read)
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultCurrency is the currency of a rate configuration that does not declare one.
+const DefaultCurrency = "USD"
+
+// Currency is an ISO 4217 currency. Digits is the number of decimal digits of its minor unit, such
+// as 2 for USD, where a price of 1500 is $15.00, or 0 for JPY, where a price of 1500 is ¥1500.
+type Currency struct {
+	Code   string
+	Digits int
+	Symbol string
+}
+
+// currencies are the ISO 4217 currencies a rate configuration can declare.
+var currencies = map[string]Currency{
+	"AUD": {"AUD", 2, "A$"},
+	"BHD": {"BHD", 3, ""},
+	"BRL": {"BRL", 2, "R$"},
+	"CAD": {"CAD", 2, "CA$"},
+	"CHF": {"CHF", 2, ""},
+	"CLP": {"CLP", 0, ""},
+	"CNY": {"CNY", 2, "CN¥"},
+	"CZK": {"CZK", 2, ""},
+	"DKK": {"DKK", 2, ""},
+	"EUR": {"EUR", 2, "€"},
+	"GBP": {"GBP", 2, "£"},
+	"HKD": {"HKD", 2, "HK$"},
+	"HUF": {"HUF", 2, ""},
+	"IDR": {"IDR", 2, ""},
+	"ILS": {"ILS", 2, "₪"},
+	"INR": {"INR", 2, "₹"},
+	"ISK": {"ISK", 0, ""},
+	"JOD": {"JOD", 3, ""},
+	"JPY": {"JPY", 0, "¥"},
+	"KRW": {"KRW", 0, "₩"},
+	"KWD": {"KWD", 3, ""},
+	"MXN": {"MXN", 2, "MX$"},
+	"MYR": {"MYR", 2, ""},
+	"NOK": {"NOK", 2, ""},
+	"NZD": {"NZD", 2, "NZ$"},
+	"OMR": {"OMR", 3, ""},
+	"PHP": {"PHP", 2, "₱"},
+	"PLN": {"PLN", 2, ""},
+	"SEK": {"SEK", 2, ""},
+	"SGD": {"SGD", 2, ""},
+	"THB": {"THB", 2, ""},
+	"TRY": {"TRY", 2, ""},
+	"TWD": {"TWD", 2, "NT$"},
+	"USD": {"USD", 2, "$"},
+	"VND": {"VND", 0, "₫"},
+	"ZAR": {"ZAR", 2, ""},
+}
+
+// CurrencyFromCode returns the currency for an ISO 4217 code, such as "USD" or "eur".
+func CurrencyFromCode(code string) (Currency, error) {
+	currency, ok := currencies[strings.ToUpper(strings.TrimSpace(code))]
+	if !ok {
+		return Currency{}, newError(CodeInvalidCurrency, "currency", "unknown currency '%s', must be an ISO 4217 code such as \"USD\"", code)
+	}
+	return currency, nil
+}
+
+// Money is an amount in the minor unit of a currency, such as cents for USD.
+type Money struct {
+	Amount   uint   `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// Add returns the sum of two amounts in the same currency.
+func (m Money) Add(other Money) Money {
+	return Money{Amount: m.Amount + other.Amount, Currency: m.Currency}
+}
+
+// String formats the amount in the major unit of its currency, such as "$15.00" for 1500 USD, or
+// "CHF 15.00" for a currency without a symbol.
+func (m Money) String() string {
+	currency, err := CurrencyFromCode(m.Currency)
+	if err != nil {
+		return fmt.Sprintf("%d %s", m.Amount, m.Currency)
+	}
+
+	amount := fmt.Sprintf("%d", m.Amount)
+	if currency.Digits > 0 {
+		amount = fmt.Sprintf("%0*d", currency.Digits+1, m.Amount)
+		split := len(amount) - currency.Digits
+		amount = amount[:split] + "." + amount[split:]
+	}
+
+	if currency.Symbol == "" {
+		return currency.Code + " " + amount
+	}
+	return currency.Symbol + amount
+}
@@ -0,0 +1,98 @@
+package api_test
+
+import (
+	"errors"
+	"github.com/jtide/gopark/api"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+var jsonEuroConfig = []byte(`{
+	"currency": "EUR",
+	"rates": [{"days": "wed", "times": "0600-1800", "price": 1750}]
+}`)
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		money    api.Money
+		expected string
+	}{
+		{api.Money{Amount: 1500, Currency: "USD"}, "$15.00"},
+		{api.Money{Amount: 5, Currency: "USD"}, "$0.05"},
+		{api.Money{Amount: 0, Currency: "USD"}, "$0.00"},
+		{api.Money{Amount: 1750, Currency: "EUR"}, "€17.50"},
+		{api.Money{Amount: 1500, Currency: "JPY"}, "¥1500"},
+		{api.Money{Amount: 12345, Currency: "KWD"}, "KWD 12.345"},
+		{api.Money{Amount: 925, Currency: "CHF"}, "CHF 9.25"},
+		{api.Money{Amount: 925, Currency: "XXX"}, "925 XXX"},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, test.money.String())
+	}
+}
+
+func TestCurrencyFromCode(t *testing.T) {
+	currency, err := api.CurrencyFromCode(" eur ")
+	assert.NoError(t, err)
+	assert.Equal(t, "EUR", currency.Code)
+	assert.Equal(t, 2, currency.Digits)
+
+	_, err = api.CurrencyFromCode("dollars")
+	code, field := api.ErrorCode(err, 400)
+	assert.Equal(t, api.CodeInvalidCurrency, code)
+	assert.Equal(t, "currency", field)
+}
+
+func TestWeeklyRates_UpdateWithCurrency(t *testing.T) {
+	rates := api.NewWeeklyRates()
+	assert.Equal(t, api.DefaultCurrency, rates.Currency())
+
+	err := rates.Update(jsonEuroConfig)
+	assert.NoError(t, err)
+	assert.Equal(t, "EUR", rates.Currency())
+
+	duration, err := api.ParseDuration("2015-07-01T07:00:00Z", "2015-07-01T12:00:00Z")
+	assert.NoError(t, err)
+	quote, err := rates.QuoteByDuration(duration)
+	assert.NoError(t, err)
+	rate := api.NewRate(duration, quote)
+	assert.Equal(t, uint(1750), rate.Price)
+	assert.Equal(t, "EUR", rate.Currency)
+	assert.Equal(t, "€17.50", rate.FormattedPrice)
+
+	// Rates without a currency are in the currency of the existing rates
+	err = rates.Update([]byte(`{"rates": [{"days": "thurs", "times": "0600-1800", "price": 1500}]}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "EUR", rates.Config().Currency)
+
+	// Rates in another currency cannot be mixed in
+	err = rates.Update([]byte(`{"currency": "USD", "rates": [{"days": "fri", "times": "0600-1800", "price": 1500}]}`))
+	assert.Error(t, err)
+	code, field := api.ErrorCode(err, 400)
+	assert.Equal(t, api.CodeCurrencyMismatch, code)
+	assert.Equal(t, "currency", field)
+
+	err = rates.Update([]byte(`{"currency": "dollars", "rates": []}`))
+	code, _ = api.ErrorCode(err, 400)
+	assert.Equal(t, api.CodeInvalidCurrency, code)
+}
+
+func TestConfigRatesFromCSVWithCurrency(t *testing.T) {
+	config, err := api.ConfigRatesFromCSV(strings.NewReader("days,times,price,currency\nwed,0600-1800,1750,gbp\nthurs,0600-1800,1500,GBP\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, "GBP", config.Currency)
+
+	data, err := config.CSV()
+	assert.NoError(t, err)
+	assert.Equal(t, "days,times,price,currency\nwed,0600-1800,1750,GBP\nthurs,0600-1800,1500,GBP\n", string(data))
+
+	_, err = api.ConfigRatesFromCSV(strings.NewReader("days,times,price,currency\nwed,0600-1800,1750,GBP\nthurs,0600-1800,1500,EUR\n"))
+	var csvErr *api.CSVError
+	assert.True(t, errors.As(err, &csvErr))
+	assert.Equal(t, 3, csvErr.Row)
+	assert.Equal(t, "currency", csvErr.Column)
+	code, _ := api.ErrorCode(err, 400)
+	assert.Equal(t, api.CodeCurrencyMismatch, code)
+}
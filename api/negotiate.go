@@ -0,0 +1,149 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Media types of the responses the API can produce.
+const (
+	MediaTypeJSON        = "application/json"
+	MediaTypeXML         = "application/xml"
+	MediaTypeCSV         = "text/csv"
+	MediaTypeProblemJSON = "application/problem+json"
+	MediaTypeProblemXML  = "application/problem+xml"
+	MediaTypeYAML        = "application/yaml"
+	MediaTypeText        = "text/plain"
+	MediaTypeHTML        = "text/html"
+)
+
+type contextKey int
+
+const mediaTypeKey contextKey = 0
+
+// mediaRange is a single media range of an "Accept" header, such as "application/*;q=0.5".
+type mediaRange struct {
+	Type    string
+	Subtype string
+	Quality float64
+}
+
+// specificity orders media ranges from the least to the most specific, "*/*", "type/*" and "type/subtype".
+func (m mediaRange) specificity() int {
+	switch {
+	case m.Type == "*":
+		return 0
+	case m.Subtype == "*":
+		return 1
+	default:
+		return 2
+	}
+}
+
+func (m mediaRange) matches(mediaType string) bool {
+	split := strings.SplitN(mediaType, "/", 2)
+	return (m.Type == "*" || m.Type == split[0]) && (m.Subtype == "*" || m.Subtype == split[1])
+}
+
+// parseAccept parses the media ranges of an "Accept" header, as described by RFC 7231 section 5.3.2.
+// A missing header accepts all media types. Ranges that cannot be parsed are ignored.
+func parseAccept(header string) []mediaRange {
+	if strings.TrimSpace(header) == "" {
+		return []mediaRange{{"*", "*", 1}}
+	}
+
+	var ranges []mediaRange
+	for _, element := range strings.Split(header, ",") {
+		params := strings.Split(element, ";")
+
+		mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+		if mediaType == "*" {
+			// Sent by some clients in place of "*/*"
+			mediaType = "*/*"
+		}
+		split := strings.SplitN(mediaType, "/", 2)
+		if len(split) != 2 || split[0] == "" || split[1] == "" || (split[0] == "*" && split[1] != "*") {
+			continue
+		}
+
+		m := mediaRange{Type: split[0], Subtype: split[1], Quality: 1}
+		valid := true
+		for _, param := range params[1:] {
+			kv := strings.SplitN(param, "=", 2)
+			if len(kv) != 2 || strings.ToLower(strings.TrimSpace(kv[0])) != "q" {
+				continue
+			}
+			q, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+			if err != nil || q < 0 || q > 1 {
+				valid = false
+				break
+			}
+			m.Quality = q
+		}
+		if valid {
+			ranges = append(ranges, m)
+		}
+	}
+
+	// Most specific first, so that the first match for a media type is the one that applies to it.
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].specificity() > ranges[j].specificity()
+	})
+	return ranges
+}
+
+// Negotiate returns the offered media type with the highest quality in the "Accept" header. The
+// quality of each offer is taken from the most specific media range that matches it, so
+// "application/*;q=0.5, application/xml" prefers XML. When several offers have the same quality, the
+// first is chosen. Offers with a structured syntax suffix, such as "application/problem+json", are
+// only chosen when the header names them. It returns false if no offer is acceptable.
+func Negotiate(accept string, offers []string) (string, bool) {
+	acceptable := preferences(accept, offers)
+	if len(acceptable) == 0 {
+		return "", false
+	}
+	return acceptable[0], true
+}
+
+// preferences returns the offers that are acceptable to the "Accept" header, from the most to the
+// least preferred, as described by Negotiate.
+func preferences(accept string, offers []string) []string {
+	ranges := parseAccept(accept)
+
+	var acceptable []string
+	qualities := make(map[string]float64)
+	for _, offer := range offers {
+		for _, m := range ranges {
+			if !m.matches(offer) {
+				continue
+			}
+			if m.Quality > 0 && (m.specificity() == 2 || !strings.Contains(offer, "+")) {
+				acceptable = append(acceptable, offer)
+				qualities[offer] = m.Quality
+			}
+			break
+		}
+	}
+
+	sort.SliceStable(acceptable, func(i, j int) bool {
+		return qualities[acceptable[i]] > qualities[acceptable[j]]
+	})
+	return acceptable
+}
+
+// ResponseMediaType returns the media type negotiated for the response to a request by
+// InitializeResponse, or JSON if none has been.
+func ResponseMediaType(r *http.Request) string {
+	if mediaType, ok := r.Context().Value(mediaTypeKey).(string); ok {
+		return mediaType
+	}
+	return MediaTypeJSON
+}
+
+// withResponseMediaType returns a copy of the request with the media type of its response.
+func withResponseMediaType(r *http.Request, mediaType string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), mediaTypeKey, mediaType))
+}
@@ -0,0 +1,111 @@
+package api_test
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"github.com/jtide/gopark/api"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	offers := []string{api.MediaTypeProblemJSON, api.MediaTypeProblemXML, api.MediaTypeJSON, api.MediaTypeXML, api.MediaTypeCSV}
+
+	tests := []struct {
+		accept   string
+		expected string
+	}{
+		{"", api.MediaTypeJSON},
+		{"*/*", api.MediaTypeJSON},
+		{"*", api.MediaTypeJSON},
+		{"application/json", api.MediaTypeJSON},
+		{"application/xml", api.MediaTypeXML},
+		{"text/csv", api.MediaTypeCSV},
+		{"application/xml;q=1, application/json;q=0.1", api.MediaTypeXML},
+		{"application/json;q=0.1, application/xml", api.MediaTypeXML},
+		{"application/json; q=0.5, application/xml; q=0.8, text/csv; q=0.9", api.MediaTypeCSV},
+		{"text/*", api.MediaTypeCSV},
+		{"text/html, application/*;q=0.2", api.MediaTypeJSON},
+		{"application/*;q=0.5, application/xml", api.MediaTypeXML},
+		{"*/*;q=0.1, text/csv;q=0.5", api.MediaTypeCSV},
+		{"APPLICATION/XML", api.MediaTypeXML},
+		{"application/problem+json, application/json", api.MediaTypeProblemJSON},
+		{"application/problem+xml", api.MediaTypeProblemXML},
+		{"application/json, application/problem+json;q=0.5", api.MediaTypeJSON},
+		{"application/xml, */*;q=0.1", api.MediaTypeXML},
+		{"application/json;q=0, */*", api.MediaTypeXML},
+		{"application/json;q=abc, application/xml", api.MediaTypeXML},
+	}
+
+	for _, test := range tests {
+		mediaType, ok := api.Negotiate(test.accept, offers)
+		assert.True(t, ok, test.accept)
+		assert.Equal(t, test.expected, mediaType, test.accept)
+	}
+}
+
+func TestNegotiateNotAcceptable(t *testing.T) {
+	offers := []string{api.MediaTypeProblemJSON, api.MediaTypeJSON, api.MediaTypeXML}
+
+	for _, accept := range []string{"image/png", "image/*", "application/json;q=0", "*/*;q=0", "image/png, application/*;q=0"} {
+		_, ok := api.Negotiate(accept, offers)
+		assert.False(t, ok, accept)
+	}
+}
+
+func TestRateHandleFuncHonoursQuality(t *testing.T) {
+	err := api.ReplaceRates(api.JSONDefaultRateConfig)
+	assert.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodGet, "/api/rate?start=2015-07-01T07:00:00Z&end=2015-07-01T12:00:00Z", nil)
+	r.Header.Set("Accept", "application/xml;q=1, application/json;q=0.1")
+	w := httptest.NewRecorder()
+	api.RateHandleFunc(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "application/xml")
+	assert.Contains(t, w.Header().Get("Vary"), "Accept")
+	rate := api.Rate{}
+	assert.NoError(t, xml.Unmarshal(w.Body.Bytes(), &rate))
+	assert.Equal(t, uint(1750), rate.Price)
+}
+
+func TestRateHandleFuncNotAcceptable(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/api/rate?start=2015-07-01T07:00:00Z&end=2015-07-01T12:00:00Z", nil)
+	r.Header.Set("Accept", "image/png")
+	w := httptest.NewRecorder()
+	api.RateHandleFunc(w, r)
+
+	assert.Equal(t, http.StatusNotAcceptable, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "application/json")
+	response := api.APIStandardResponse{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, uint(http.StatusNotAcceptable), response.Status)
+	assert.Equal(t, api.CodeNotAcceptable, response.Code)
+	assert.Contains(t, response.Description, "image/png")
+}
+
+func TestWriteResponseFallsBackFromCSV(t *testing.T) {
+	err := api.ReplaceRates(api.JSONDefaultRateConfig)
+	assert.NoError(t, err)
+
+	// A Rate has no CSV representation, so the next preference of the client is used.
+	r := httptest.NewRequest(http.MethodGet, "/api/rate?start=2015-07-01T07:00:00Z&end=2015-07-01T12:00:00Z", nil)
+	r.Header.Set("Accept", "text/csv, application/xml;q=0.5")
+	w := httptest.NewRecorder()
+	api.RateHandleFunc(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "application/xml")
+
+	// A Schedule has, so CSV is used.
+	r = httptest.NewRequest(http.MethodGet, "/api/rates", nil)
+	r.Header.Set("Accept", "text/csv, application/xml;q=0.5")
+	w = httptest.NewRecorder()
+	api.RatesHandleFunc(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/csv")
+}
@@ -0,0 +1,358 @@
+package api
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Occupancy events.
+const (
+	EventEntry = "entry"
+	EventExit  = "exit"
+)
+
+// MaxAudits is the number of quotes kept in the audit of an Occupancy. The oldest are dropped first.
+const MaxAudits = 1000
+
+// Occupancy is the live count of vehicles parked in the facility, kept by entry and exit events, and
+// the audit of the quotes that occupancy bands changed. It is safe for concurrent use.
+type Occupancy struct {
+	mu       sync.Mutex
+	vehicles uint
+	audits   []OccupancyAudit
+}
+
+// OccupancyAudit is the record of a quote whose price an occupancy band changed, so that the price can
+// be explained later. Occupancy is how full the facility was, in percent, the Multiplier is the factor
+// of the band and the Adjustment is the change it made to the price, and the Total is the price quoted.
+type OccupancyAudit struct {
+	Time       time.Time  `json:"time"`
+	Start      time.Time  `json:"start"`
+	End        time.Time  `json:"end"`
+	Vehicle    string     `json:"vehicle"`
+	Occupancy  float64    `json:"occupancy"`
+	Multiplier float64    `json:"multiplier"`
+	Adjustment Adjustment `json:"adjustment"`
+	Total      uint       `json:"total"`
+	Currency   string     `json:"currency"`
+}
+
+// currentOccupancy is the occupancy of the facility used by the API.
+var currentOccupancy = &Occupancy{}
+
+// Enter records a vehicle entering the facility, and returns the new count.
+func (o *Occupancy) Enter() uint {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.vehicles++
+	return o.vehicles
+}
+
+// Exit records a vehicle leaving the facility, and returns the new count. The count never drops
+// below 0, so that an exit without an entry, such as one missed by a gate counter, is ignored.
+func (o *Occupancy) Exit() uint {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.vehicles > 0 {
+		o.vehicles--
+	}
+	return o.vehicles
+}
+
+// Count returns the number of vehicles in the facility.
+func (o *Occupancy) Count() uint {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.vehicles
+}
+
+// Set replaces the number of vehicles in the facility, such as after a count of the lot.
+func (o *Occupancy) Set(vehicles uint) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.vehicles = vehicles
+}
+
+// record adds a quote of a duration to the audit, if an occupancy band changed it. Only quotes that
+// are served or committed are recorded, never previews.
+func (o *Occupancy) record(d Duration, quote Quote) {
+	if quote.Multiplier == 0 {
+		return
+	}
+	audit := OccupancyAudit{
+		Time:       time.Now().UTC().Truncate(time.Second),
+		Start:      d.Start,
+		End:        d.End,
+		Vehicle:    quote.Vehicle,
+		Occupancy:  quote.occupancy,
+		Multiplier: quote.Multiplier,
+		Total:      quote.Total,
+		Currency:   quote.Currency,
+	}
+	for _, adjustment := range quote.Adjustments {
+		if adjustment.Type == "occupancy" {
+			audit.Adjustment = adjustment
+		}
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.audits = append(o.audits, audit)
+	if len(o.audits) > MaxAudits {
+		o.audits = o.audits[len(o.audits)-MaxAudits:]
+	}
+}
+
+// Audits returns the audit of the quotes that occupancy bands changed, most recent first.
+func (o *Occupancy) Audits() []OccupancyAudit {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	audits := []OccupancyAudit{}
+	for i := len(o.audits) - 1; i >= 0; i-- {
+		audits = append(audits, o.audits[i])
+	}
+	return audits
+}
+
+// Capacity returns the number of spots of the facility, or 0 if it does not declare one.
+func (rates *WeeklyRates) Capacity() uint {
+	return rates.Facility.Capacity
+}
+
+// OccupancyBand changes the price of a rate by a Percent, such as 25 for +25%, when the facility is
+// more than Above percent full at the time of the quote. The band with the highest Above that the
+// occupancy is over applies.
+type OccupancyBand struct {
+	Above   float64 `json:"above"`
+	Percent float64 `json:"percent"`
+}
+
+// validateBands returns an error for the first band that is not above 0 to 100 percent full, that
+// would lower the price by 100 percent or more, or that is above the same occupancy as another band.
+func validateBands(bands []OccupancyBand) error {
+	seen := make(map[float64]bool)
+	for _, band := range bands {
+		if band.Above < 0 || band.Above >= 100 {
+			return newError(CodeInvalidOccupancyBand, "occupancy", "invalid occupancy band above %v%%, must be at least 0 and less than 100", band.Above)
+		}
+		if band.Percent <= -100 {
+			return newError(CodeInvalidOccupancyBand, "occupancy", "invalid percent %v for occupancy band above %v%%, must be more than -100", band.Percent, band.Above)
+		}
+		if seen[band.Above] {
+			return newError(CodeInvalidOccupancyBand, "occupancy", "occupancy band above %v%% is repeated", band.Above)
+		}
+		seen[band.Above] = true
+	}
+	return nil
+}
+
+// bandFor returns the band of a rate for an occupancy in percent, or nil if none applies.
+func bandFor(bands []OccupancyBand, occupancy float64) *OccupancyBand {
+	var band *OccupancyBand
+	for i := range bands {
+		if occupancy > bands[i].Above && (band == nil || bands[i].Above > band.Above) {
+			band = &bands[i]
+		}
+	}
+	return band
+}
+
+// multiplier returns the factor that the band multiplies a price by, such as 1.25 for +25%.
+func (b OccupancyBand) multiplier() float64 {
+	return 1 + b.Percent/100
+}
+
+// applyOccupancy adds an adjustment to the quote for the band of its rate at an occupancy in percent,
+// if one applies, and records the multiplier of the band. The adjustment is rounded half up to the
+// minor unit.
+func (q *Quote) applyOccupancy(occupancy float64) {
+	rate := q.rate()
+	if rate == nil {
+		return
+	}
+	band := bandFor(rate.Occupancy, occupancy)
+	if band == nil {
+		return
+	}
+
+	change := strconv.FormatFloat(band.Percent, 'f', -1, 64)
+	if band.Percent >= 0 {
+		change = "+" + change
+	}
+	q.Multiplier = band.multiplier()
+	q.occupancy = occupancy
+	q.Adjustments = append(q.Adjustments, Adjustment{
+		Type:        "occupancy",
+		Description: fmt.Sprintf("%s%% full, %s%%", strconv.FormatFloat(math.Round(occupancy), 'f', -1, 64), change),
+		Amount:      int(math.Round(float64(q.total()) * band.Percent / 100)),
+	})
+}
+
+// Percent returns how full a facility with a capacity is, in percent, or 0 if it has no capacity.
+func (o *Occupancy) Percent(capacity uint) float64 {
+	if capacity == 0 {
+		return 0
+	}
+	return float64(o.Count()) * 100 / float64(capacity)
+}
+
+// spotsTaken returns the largest number of spots taken at any time during a stay, which is the
+// vehicles in the facility now, if they are still expected to be parked during the stay, and the
+// booked reservations during the stay.
+func spotsTaken(d Duration, now time.Time, occupancy *Occupancy, reservations *Reservations) uint {
+	reservations.mu.Lock()
+	taken := reservations.peak(d)
+	reservations.mu.Unlock()
+
+	return taken + occupiedDuring(d, now, occupancy)
+}
+
+// occupiedDuring returns the vehicles in the facility now, if a stay has not ended and starts before
+// the end of the current day, or 0 otherwise. Rates only price stays within a day, so the vehicles
+// parked now are expected to stay until the end of the day, but not to still be parked on a later one.
+func occupiedDuring(d Duration, now time.Time, occupancy *Occupancy) uint {
+	year, month, day := now.Date()
+	midnight := time.Date(year, month, day+1, 0, 0, 0, 0, now.Location())
+	if occupancy != nil && now.Before(d.End) && d.Start.Before(midnight) {
+		return occupancy.Count()
+	}
+	return 0
+}
+
+// spotFree returns whether the facility has a spot free during the whole of a stay, or nil if the
+// facility declares no capacity, so that quotes only say whether a stay is available when it can be
+// full.
+func spotFree(d Duration, now time.Time, capacity uint) *bool {
+	if capacity == 0 {
+		return nil
+	}
+	free := spotsTaken(d, now, currentOccupancy, currentReservations) < capacity
+	return &free
+}
+
+// OccupancyStatus is the response for requests for the occupancy of the facility. Free is the
+// number of spots that are not Occupied, and the facility is Full when there are none. A facility
+// without a Capacity is never full.
+type OccupancyStatus struct {
+	Status   uint `json:"status"`
+	Capacity uint `json:"capacity"`
+	Occupied uint `json:"occupied"`
+	Free     uint `json:"free"`
+	Full     bool `json:"full"`
+}
+
+// NewOccupancyStatus returns the response for a number of vehicles in a facility with a capacity.
+func NewOccupancyStatus(capacity uint, occupied uint) OccupancyStatus {
+	status := OccupancyStatus{Status: http.StatusOK, Capacity: capacity, Occupied: occupied}
+	if capacity > occupied {
+		status.Free = capacity - occupied
+	}
+	status.Full = capacity > 0 && status.Free == 0
+	return status
+}
+
+// JSON implementation for WebFormatter interface.
+func (s OccupancyStatus) JSON() ([]byte, error) {
+	return json.Marshal(s)
+}
+
+// XML implementation for WebFormatter interface.
+func (s OccupancyStatus) XML() ([]byte, error) {
+	return xml.Marshal(s)
+}
+
+// StatusCode implementation for WebFormatter interface.
+func (s OccupancyStatus) StatusCode() uint {
+	return s.Status
+}
+
+// OccupancyHandleFunc is the top-level handler for requests to the /api/occupancy endpoint, which
+// returns the occupancy of the facility, and records entry and exit events.
+func OccupancyHandleFunc(w http.ResponseWriter, r *http.Request) {
+	r, ok := InitializeResponse(&w, r) // Required before WriteResponse
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		WriteResponse(NewOccupancyStatus(currentWeeklyRates.Capacity(), currentOccupancy.Count()), &w, r)
+	case http.MethodPost:
+		OccupancyPostHandleFunc(w, r)
+	default:
+		err := methodNotSupported(r.Method)
+		WriteError(http.StatusBadRequest, err, &w, r)
+	}
+}
+
+// OccupancyPostHandleFunc records the "entry" or "exit" in the "event" parameter of a Post request,
+// and returns the new occupancy of the facility.
+//
+// Example:
+//
+//	curl -X POST "http://localhost:8080/api/occupancy?event=entry"
+func OccupancyPostHandleFunc(w http.ResponseWriter, r *http.Request) {
+	var occupied uint
+	switch event := r.URL.Query().Get("event"); event {
+	case EventEntry:
+		occupied = currentOccupancy.Enter()
+	case EventExit:
+		occupied = currentOccupancy.Exit()
+	case "":
+		err := newError(CodeMissingParameter, "event", "the 'event' parameter is required to record an entry or exit")
+		WriteError(http.StatusBadRequest, err, &w, r)
+		return
+	default:
+		err := newError(CodeInvalidParameter, "event", "invalid event '%s', must be \"%s\" or \"%s\"", event, EventEntry, EventExit)
+		WriteError(http.StatusBadRequest, err, &w, r)
+		return
+	}
+	WriteResponse(NewOccupancyStatus(currentWeeklyRates.Capacity(), occupied), &w, r)
+}
+
+// OccupancyAuditList is the response for requests for the audit of occupancy pricing.
+type OccupancyAuditList struct {
+	Status uint             `json:"status"`
+	Audits []OccupancyAudit `json:"audits" xml:"Audit"`
+}
+
+// JSON implementation for WebFormatter interface.
+func (l OccupancyAuditList) JSON() ([]byte, error) {
+	return json.Marshal(l)
+}
+
+// XML implementation for WebFormatter interface.
+func (l OccupancyAuditList) XML() ([]byte, error) {
+	return xml.Marshal(l)
+}
+
+// StatusCode implementation for WebFormatter interface.
+func (l OccupancyAuditList) StatusCode() uint {
+	return l.Status
+}
+
+// OccupancyAuditHandleFunc returns the audit of the quotes that occupancy bands changed, most recent
+// first, for a Get request to the /api/occupancy/audit endpoint.
+//
+// Example:
+//
+//	curl "http://localhost:8080/api/occupancy/audit"
+func OccupancyAuditHandleFunc(w http.ResponseWriter, r *http.Request) {
+	r, ok := InitializeResponse(&w, r) // Required before WriteResponse
+	if !ok {
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		WriteError(http.StatusBadRequest, methodNotSupported(r.Method), &w, r)
+		return
+	}
+	WriteResponse(OccupancyAuditList{Status: http.StatusOK, Audits: currentOccupancy.Audits()}, &w, r)
+}
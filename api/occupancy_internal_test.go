@@ -0,0 +1,26 @@
+package api
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestOccupancyRecordKeepsMaxAudits(t *testing.T) {
+	occupancy := &Occupancy{}
+	start := time.Date(2015, 7, 1, 7, 0, 0, 0, time.UTC)
+
+	// Quotes that no band changed are not recorded.
+	occupancy.record(Duration{Start: start, End: start.Add(time.Hour)}, Quote{Total: 1500})
+	assert.Empty(t, occupancy.Audits())
+
+	for i := 0; i <= MaxAudits; i++ {
+		end := start.Add(time.Duration(i+1) * time.Minute)
+		occupancy.record(Duration{Start: start, End: end}, Quote{Total: 1875, Multiplier: 1.25, occupancy: 90})
+	}
+	audits := occupancy.Audits()
+	assert.Len(t, audits, MaxAudits)
+	assert.Equal(t, start.Add(time.Duration(MaxAudits+1)*time.Minute), audits[0].End)
+	assert.Equal(t, start.Add(2*time.Minute), audits[MaxAudits-1].End)
+	assert.Equal(t, 90.0, audits[0].Occupancy)
+}
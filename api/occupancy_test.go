@@ -0,0 +1,320 @@
+package api_test
+
+import (
+	"encoding/json"
+	"github.com/jtide/gopark/api"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOccupancyEnterAndExit(t *testing.T) {
+	occupancy := &api.Occupancy{}
+	assert.Equal(t, uint(1), occupancy.Enter())
+	assert.Equal(t, uint(2), occupancy.Enter())
+	assert.Equal(t, uint(1), occupancy.Exit())
+	assert.Equal(t, uint(0), occupancy.Exit())
+	// An exit without an entry is ignored.
+	assert.Equal(t, uint(0), occupancy.Exit())
+	occupancy.Set(5)
+	assert.Equal(t, uint(5), occupancy.Count())
+}
+
+func TestNewOccupancyStatus(t *testing.T) {
+	tests := []struct {
+		capacity uint
+		occupied uint
+		free     uint
+		full     bool
+	}{
+		{10, 4, 6, false},
+		{10, 10, 0, true},
+		{10, 12, 0, true},
+		{0, 12, 0, false},
+	}
+
+	for _, test := range tests {
+		status := api.NewOccupancyStatus(test.capacity, test.occupied)
+		assert.Equal(t, test.free, status.Free)
+		assert.Equal(t, test.full, status.Full)
+	}
+}
+
+func TestRateHandleFuncWhenFull(t *testing.T) {
+	// The grace period prices a short stay now, whatever the day and time.
+	err := api.ReplaceRates([]byte(`{"capacity": 1, "grace": {"minutes": 10}, "rates": [{"days": "wed", "times": "0600-2200", "price": 1500}]}`))
+	assert.NoError(t, err)
+	defer api.ReplaceRates(api.JSONDefaultRateConfig)
+
+	request := func(method string, target string) (int, string) {
+		r := httptest.NewRequest(method, target, strings.NewReader(""))
+		r.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		api.NewServeMux().ServeHTTP(w, r)
+		return w.Code, w.Body.String()
+	}
+	now := time.Now().UTC()
+	target := "/api/rate?start=" + now.Add(-2*time.Minute).Format(time.RFC3339) + "&end=" + now.Add(2*time.Minute).Format(time.RFC3339)
+
+	status, body := request(http.MethodGet, target)
+	assert.Equal(t, http.StatusOK, status)
+	var rate api.Rate
+	assert.NoError(t, json.Unmarshal([]byte(body), &rate))
+	assert.Equal(t, uint(http.StatusOK), rate.Status)
+	assert.True(t, *rate.Available)
+
+	status, body = request(http.MethodPost, "/api/occupancy?event=entry")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, `"full":true`)
+	defer request(http.MethodPost, "/api/occupancy?event=exit")
+
+	status, body = request(http.MethodGet, target)
+	assert.Equal(t, http.StatusConflict, status)
+	var full api.UnknownRate
+	assert.NoError(t, json.Unmarshal([]byte(body), &full))
+	assert.Equal(t, api.PriceFull, full.Price)
+	assert.False(t, *full.Available)
+
+	// Vehicles parked now do not fill the facility for a later stay, but reservations do.
+	target = "/api/rate?start=2037-07-01T08:00:00Z&end=2037-07-01T10:00:00Z"
+	status, _ = request(http.MethodGet, target)
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = request(http.MethodPost, "/api/reservations?start=2037-07-01T09:00:00Z&end=2037-07-01T11:00:00Z")
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = request(http.MethodGet, target)
+	assert.Equal(t, http.StatusConflict, status)
+}
+
+var jsonOccupancyBandConfig = []byte(`{
+	"capacity": 10,
+	"rates": [{"days": "wed", "times": "0600-2200", "price": 1500, "occupancy": [{"above": 50, "percent": 10}, {"above": 80, "percent": 25}]}]
+}`)
+
+func TestWeeklyRates_QuoteWithOccupancyBands(t *testing.T) {
+	rates := api.NewWeeklyRates()
+	assert.NoError(t, rates.Update(jsonOccupancyBandConfig))
+	duration, err := api.ParseDuration("2015-07-01T07:00:00Z", "2015-07-01T12:00:00Z")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		occupied    uint
+		total       uint
+		multiplier  float64
+		description string
+	}{
+		{0, 1500, 0, ""},
+		{5, 1500, 0, ""},
+		{6, 1650, 1.1, "60% full, +10%"},
+		{9, 1875, 1.25, "90% full, +25%"},
+		{12, 1875, 1.25, "120% full, +25%"},
+	}
+
+	for _, test := range tests {
+		occupancy := &api.Occupancy{}
+		occupancy.Set(test.occupied)
+		quote, err := rates.QuoteWithOptions(duration, api.QuoteOptions{Occupancy: occupancy})
+		assert.NoError(t, err)
+		assert.Equal(t, uint(1500), quote.Subtotal)
+		assert.Equal(t, test.total, quote.Total, test.occupied)
+		assert.Equal(t, test.multiplier, quote.Multiplier, test.occupied)
+		if test.description == "" {
+			assert.Empty(t, quote.Adjustments)
+			continue
+		}
+		assert.Equal(t, []api.Adjustment{{Type: "occupancy", Description: test.description, Amount: int(test.total) - 1500}}, quote.Adjustments)
+	}
+
+	// Quotes without an occupancy are not changed by the bands.
+	quote, err := rates.QuoteByDuration(duration)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1500), quote.Total)
+}
+
+func TestWeeklyRates_UpdateWithInvalidOccupancyBand(t *testing.T) {
+	tests := []string{
+		`{"rates": [{"days": "wed", "times": "0600-2200", "price": 1500, "occupancy": [{"above": 100, "percent": 25}]}]}`,
+		`{"rates": [{"days": "wed", "times": "0600-2200", "price": 1500, "occupancy": [{"above": -10, "percent": 25}]}]}`,
+		`{"rates": [{"days": "wed", "times": "0600-2200", "price": 1500, "occupancy": [{"above": 80, "percent": -100}]}]}`,
+		`{"rates": [{"days": "wed", "times": "0600-2200", "price": 1500, "occupancy": [{"above": 80, "percent": 25}, {"above": 80, "percent": 50}]}]}`,
+		`{"rates": [{"days": "wed", "times": "0600-2200", "price": 1500, "occupancy": [{"above": "80", "percent": 25}]}]}`,
+	}
+
+	for _, config := range tests {
+		rates := api.NewWeeklyRates()
+		err := rates.Update([]byte(config))
+		code, field := api.ErrorCode(err, 400)
+		assert.Equal(t, api.CodeInvalidOccupancyBand, code, config)
+		assert.Equal(t, "occupancy", field, config)
+	}
+}
+
+func TestRateHandleFuncWithOccupancyBand(t *testing.T) {
+	err := api.ReplaceRates(jsonOccupancyBandConfig)
+	assert.NoError(t, err)
+	defer api.ReplaceRates(api.JSONDefaultRateConfig)
+
+	for i := 0; i < 9; i++ {
+		api.NewServeMux().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/occupancy?event=entry", nil))
+		defer api.NewServeMux().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/occupancy?event=exit", nil))
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/rate?start=2037-07-01T08:00:00Z&end=2037-07-01T10:00:00Z&detail=true", nil)
+	r.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	api.NewServeMux().ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var rate api.Rate
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &rate))
+	assert.Equal(t, uint(1875), rate.Price)
+	assert.Equal(t, 1.25, rate.Multiplier)
+	assert.Equal(t, "90% full, +25%", rate.Breakdown.Adjustments[0].Description)
+
+	// A batch quote of the same stay is priced without the occupancy band.
+	r = httptest.NewRequest(http.MethodPost, "/api/rate/batch", strings.NewReader(`[{"start": "2037-07-01T08:00:00Z", "end": "2037-07-01T10:00:00Z"}]`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Accept", "application/json")
+	w = httptest.NewRecorder()
+	api.NewServeMux().ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var batch api.BatchQuote
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &batch))
+	assert.Equal(t, uint(1500), *batch.Results[0].Price)
+}
+
+func TestWeeklyRates_QuoteWithOccupancyBandBeforeSpecials(t *testing.T) {
+	rates := api.NewWeeklyRates()
+	assert.NoError(t, rates.Update([]byte(`{
+		"capacity": 10,
+		"specials": [{"name": "Early bird", "type": "early_bird", "price": 1500, "days": "wed", "enter_before": "0900", "exit_after": "1500", "exit_before": "1900"}],
+		"rates": [{"days": "wed", "times": "0600-2200", "price": 1000, "occupancy": [{"above": 80, "percent": 100}]}]
+	}`)))
+	duration, err := api.ParseDuration("2015-07-01T08:00:00Z", "2015-07-01T16:00:00Z")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		occupied uint
+		total    uint
+		special  string
+	}{
+		{0, 1000, ""},
+		{9, 1500, "Early bird"},
+	}
+
+	for _, test := range tests {
+		occupancy := &api.Occupancy{}
+		occupancy.Set(test.occupied)
+		quote, err := rates.QuoteWithOptions(duration, api.QuoteOptions{Occupancy: occupancy})
+		assert.NoError(t, err)
+		assert.Equal(t, test.total, quote.Total, test.occupied)
+		assert.Equal(t, test.special, quote.Items[0].Special, test.occupied)
+		assert.Empty(t, occupancy.Audits(), test.occupied)
+	}
+}
+
+func TestOccupancyAudits(t *testing.T) {
+	err := api.ReplaceRates(jsonOccupancyBandConfig)
+	assert.NoError(t, err)
+	defer api.ReplaceRates(api.JSONDefaultRateConfig)
+
+	request := func(method string, target string) int {
+		w := httptest.NewRecorder()
+		api.NewServeMux().ServeHTTP(w, httptest.NewRequest(method, target, nil))
+		return w.Code
+	}
+	audits := func() []api.OccupancyAudit {
+		r := httptest.NewRequest(http.MethodGet, "/api/occupancy/audit", nil)
+		r.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		api.NewServeMux().ServeHTTP(w, r)
+		var list api.OccupancyAuditList
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+		return list.Audits
+	}
+	enter := func(vehicles int) {
+		for i := 0; i < vehicles; i++ {
+			request(http.MethodPost, "/api/occupancy?event=entry")
+		}
+	}
+	defer func() {
+		for i := 0; i < 10; i++ {
+			request(http.MethodPost, "/api/occupancy?event=exit")
+		}
+	}()
+
+	// Only the quotes a band changed are audited, most recent first.
+	before := len(audits())
+	target := "/api/rate?start=2037-07-01T07:00:00Z&end=2037-07-01T12:00:00Z"
+	for _, vehicles := range []int{5, 1, 3} {
+		enter(vehicles)
+		assert.Equal(t, http.StatusOK, request(http.MethodGet, target))
+	}
+	recorded := audits()
+	assert.Len(t, recorded, before+2)
+	assert.Equal(t, 90.0, recorded[0].Occupancy)
+	assert.Equal(t, 1.25, recorded[0].Multiplier)
+	assert.Equal(t, uint(1875), recorded[0].Total)
+	assert.Equal(t, api.Adjustment{Type: "occupancy", Description: "90% full, +25%", Amount: 375}, recorded[0].Adjustment)
+	assert.Equal(t, "2037-07-01T07:00:00Z", recorded[0].Start.Format(time.RFC3339))
+	assert.Equal(t, 60.0, recorded[1].Occupancy)
+	assert.Equal(t, uint(1650), recorded[1].Total)
+
+	// Previews of a price are not audited.
+	query := `{ quote(start: "2037-07-01T07:00:00Z", end: "2037-07-01T12:00:00Z") { price multiplier } }`
+	status, _ := graphQL(t, http.MethodPost, api.GraphQLRequest{Query: query})
+	assert.Equal(t, http.StatusOK, status)
+	duration, err := api.ParseDuration("2037-07-01T07:00:00Z", "2037-07-01T12:00:00Z")
+	assert.NoError(t, err)
+	rates := api.NewWeeklyRates()
+	assert.NoError(t, rates.Update(jsonOccupancyBandConfig))
+	occupancy := &api.Occupancy{}
+	occupancy.Set(9)
+	quote, err := rates.QuoteWithOptions(duration, api.QuoteOptions{Occupancy: occupancy})
+	assert.NoError(t, err)
+	assert.Equal(t, 1.25, quote.Multiplier)
+	assert.Empty(t, occupancy.Audits())
+	assert.Len(t, audits(), before+2)
+
+	// Booked reservations and the charges of sessions are audited.
+	assert.Equal(t, http.StatusOK, request(http.MethodPost, "/api/reservations?start=2038-07-07T07:00:00Z&end=2038-07-07T12:00:00Z"))
+	assert.Equal(t, http.StatusOK, request(http.MethodPost, "/api/sessions?ticket=AUDIT&start=2037-07-01T07:00:00Z"))
+	assert.Equal(t, http.StatusOK, request(http.MethodPost, "/api/sessions/checkout?ticket=AUDIT&end=2037-07-01T12:00:00Z"))
+	recorded = audits()
+	assert.Len(t, recorded, before+4)
+	assert.Equal(t, "2037-07-01T12:00:00Z", recorded[0].End.Format(time.RFC3339))
+	assert.Equal(t, "2038-07-07T07:00:00Z", recorded[1].Start.Format(time.RFC3339))
+	assert.Equal(t, uint(1875), recorded[1].Total)
+}
+
+func TestOccupancyAuditHandleFunc(t *testing.T) {
+	err := api.ReplaceRates(jsonOccupancyBandConfig)
+	assert.NoError(t, err)
+	defer api.ReplaceRates(api.JSONDefaultRateConfig)
+
+	for i := 0; i < 9; i++ {
+		api.NewServeMux().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/occupancy?event=entry", nil))
+		defer api.NewServeMux().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/occupancy?event=exit", nil))
+	}
+	r := httptest.NewRequest(http.MethodGet, "/api/rate?start=2037-07-01T08:00:00Z&end=2037-07-01T10:00:00Z", nil)
+	api.NewServeMux().ServeHTTP(httptest.NewRecorder(), r)
+
+	r = httptest.NewRequest(http.MethodGet, "/api/occupancy/audit", nil)
+	r.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	api.NewServeMux().ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var list api.OccupancyAuditList
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.NotEmpty(t, list.Audits)
+	assert.Equal(t, "2037-07-01T10:00:00Z", list.Audits[0].End.Format(time.RFC3339))
+	assert.Equal(t, uint(1875), list.Audits[0].Total)
+
+	w = httptest.NewRecorder()
+	api.NewServeMux().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/occupancy/audit", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,240 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OpenAPIPath is the well-known path at which the OpenAPI document is served.
+const OpenAPIPath = "/api/openapi.json"
+
+// OpenAPIDocument returns an OpenAPI 3 document describing every endpoint of the API. The schemas
+// of request and response bodies are generated from the Go types the handlers decode and encode,
+// using the same JSON field names, so the document stays in step with the handlers.
+func OpenAPIDocument() map[string]interface{} {
+	schemas := make(map[string]interface{})
+	paths := make(map[string]interface{})
+
+	for _, e := range endpoints() {
+		item := make(map[string]interface{})
+		for _, op := range e.Operations {
+			item[strings.ToLower(op.Method)] = op.document(schemas)
+		}
+		paths[e.Path] = item
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "gopark",
+			"description": "A REST API for querying parking rates based on time-of-day.",
+			"version":     "1.0",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+		},
+	}
+}
+
+// document returns the OpenAPI operation object, adding the schema of each type it uses to schemas.
+func (op operation) document(schemas map[string]interface{}) map[string]interface{} {
+	doc := map[string]interface{}{"summary": op.Summary}
+
+	if len(op.Parameters) > 0 {
+		var parameters []interface{}
+		for _, p := range op.Parameters {
+			parameters = append(parameters, map[string]interface{}{
+				"name":        p.Name,
+				"in":          "query",
+				"description": p.Description,
+				"required":    p.Required,
+				"schema":      p.Schema,
+			})
+		}
+		doc["parameters"] = parameters
+	}
+
+	if op.RequestBody != nil {
+		content := map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": schemaOf(reflect.TypeOf(op.RequestBody), schemas)},
+		}
+		for _, contentType := range op.RequestText {
+			content[contentType] = map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}
+		}
+		doc["requestBody"] = map[string]interface{}{"required": true, "content": content}
+	}
+
+	responses := make(map[string]interface{})
+	for status, body := range op.Responses {
+		schema := schemaOf(reflect.TypeOf(body), schemas)
+		content := make(map[string]interface{})
+		for _, mediaType := range MediaTypes() {
+			if f, ok := body.(WebFormatter); ok {
+				if _, err := Encode(mediaType, f); errors.Is(err, ErrNoEncoding) {
+					continue
+				}
+			}
+			if structured(mediaType) {
+				content[mediaType] = map[string]interface{}{"schema": schema}
+			} else {
+				content[mediaType] = map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}
+			}
+		}
+		if status >= http.StatusBadRequest {
+			problem := schemaOf(reflect.TypeOf(Problem{}), schemas)
+			content["application/problem+json"] = map[string]interface{}{"schema": problem}
+			content["application/problem+xml"] = map[string]interface{}{"schema": problem}
+		}
+		responses[strconv.Itoa(status)] = map[string]interface{}{
+			"description": http.StatusText(status),
+			"content":     content,
+		}
+	}
+	if len(responses) > 0 {
+		// Any operation that negotiates its response can reject the "Accept" header, which is always
+		// reported in JSON, since the client accepts none of the formats.
+		responses[strconv.Itoa(http.StatusNotAcceptable)] = map[string]interface{}{
+			"description": http.StatusText(http.StatusNotAcceptable),
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": schemaOf(reflect.TypeOf(APIStandardResponse{}), schemas)},
+			},
+		}
+
+		// A server with a Limiter rejects the requests of a client that is over its budget.
+		responses[strconv.Itoa(http.StatusTooManyRequests)] = map[string]interface{}{
+			"description": http.StatusText(http.StatusTooManyRequests),
+			"headers": map[string]interface{}{
+				"Retry-After": map[string]interface{}{
+					"description": "Number of seconds until the request would be allowed.",
+					"schema":      map[string]interface{}{"type": "integer", "minimum": 1},
+				},
+			},
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": schemaOf(reflect.TypeOf(APIStandardResponse{}), schemas)},
+			},
+		}
+	} else {
+		responses["200"] = map[string]interface{}{
+			"description": http.StatusText(http.StatusOK),
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": map[string]interface{}{"type": "object"}},
+			},
+		}
+	}
+	doc["responses"] = responses
+
+	return doc
+}
+
+// structured reports whether a media type has the same structure as JSON, so that the schema of a
+// response describes it. Other media types, such as CSV or HTML, are described as a string.
+func structured(mediaType string) bool {
+	for _, suffix := range []string{"json", "xml", "yaml"} {
+		if strings.HasSuffix(mediaType, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// schemaOf returns the JSON schema for a Go type, as encoding/json would marshal it. Structs are
+// added to schemas by name and referenced, so that each is described only once.
+func schemaOf(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaOf(t.Elem(), schemas)
+	case reflect.Struct:
+		if _, ok := schemas[t.Name()]; !ok {
+			// Reserve the name before describing the fields, in case a field refers back to the struct.
+			schemas[t.Name()] = nil
+			schemas[t.Name()] = structSchema(t, schemas)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaOf(t.Elem(), schemas)}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// structSchema describes the exported fields of a struct, using their JSON names. Fields
+// marked "omitempty" are optional, and all others are required.
+func structSchema(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	properties := make(map[string]interface{})
+	var required []string
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		tag := strings.Split(field.Tag.Get("json"), ",")
+		name := tag[0]
+		if name == "-" {
+			continue
+		} else if name == "" {
+			name = field.Name
+		}
+
+		properties[name] = schemaOf(field.Type, schemas)
+		if len(tag) < 2 || tag[1] != "omitempty" {
+			required = append(required, name)
+		}
+	}
+
+	schema := map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// OpenAPIHandleFunc serves the OpenAPI document for the API in JSON format.
+//
+// Example:
+//
+//	curl "http://localhost:8080/api/openapi.json"
+func OpenAPIHandleFunc(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		if r, ok := InitializeResponse(&w, r); ok { // Required before WriteResponse
+			WriteError(http.StatusBadRequest, methodNotSupported(r.Method), &w, r)
+		}
+		return
+	}
+
+	document, err := json.MarshalIndent(OpenAPIDocument(), "", "  ")
+	if err != nil {
+		if r, ok := InitializeResponse(&w, r); ok { // Required before WriteResponse
+			WriteError(http.StatusInternalServerError, err, &w, r)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(document)
+}
@@ -0,0 +1,160 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers/legacy"
+	"github.com/jtide/gopark/api"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func loadOpenAPIDocument(t *testing.T) *openapi3.T {
+	server := httptest.NewServer(api.NewServeMux())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + api.OpenAPIPath)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err)
+
+	doc, err := openapi3.NewLoader().LoadFromData(data)
+	assert.NoError(t, err)
+	assert.NoError(t, doc.Validate(context.Background()))
+	return doc
+}
+
+func TestOpenAPIDocumentIsValid(t *testing.T) {
+	loadOpenAPIDocument(t)
+}
+
+func TestOpenAPIDocumentDescribesResponseTypes(t *testing.T) {
+	doc := loadOpenAPIDocument(t)
+
+	for _, name := range []string{"Rate", "UnknownRate", "APIStandardResponse"} {
+		assert.Contains(t, doc.Components.Schemas, name)
+	}
+
+	// The standard response uses "status" and "desc", not "error"
+	properties := doc.Components.Schemas["APIStandardResponse"].Value.Properties
+	assert.Contains(t, properties, "status")
+	assert.Contains(t, properties, "desc")
+	assert.NotContains(t, properties, "error")
+}
+
+func TestOpenAPIDocumentMatchesHandlerResponses(t *testing.T) {
+	err := api.ReplaceRates(api.JSONDefaultRateConfig)
+	assert.NoError(t, err)
+
+	doc := loadOpenAPIDocument(t)
+	router, err := legacy.NewRouter(doc)
+	assert.NoError(t, err)
+	handler := api.NewServeMux()
+
+	requests := []struct {
+		method      string
+		target      string
+		contentType string
+		body        string
+		status      int
+		accept      string
+	}{
+		{http.MethodGet, "/api/rate?start=2015-07-01T07:00:00Z&end=2015-07-01T12:00:00Z", "", "", http.StatusOK, ""},
+		{http.MethodGet, "/api/rate?start=2015-07-01T07:00:00Z&end=2015-07-01T12:00:00Z&detail=true", "", "", http.StatusOK, ""},
+		{http.MethodGet, "/api/rate?start=2015-07-02T07:00:00Z&end=2015-07-02T12:00:00Z", "", "", http.StatusNotFound, ""},
+		{http.MethodGet, "/api/rate?start=2015-07-01T12:00:00Z&end=2015-07-01T07:00:00Z", "", "", http.StatusBadRequest, ""},
+		{http.MethodPost, "/api/rate", "application/json", `{"rates": [{"days": "mon", "times": "0900-1000", "price": 100}]}`, http.StatusBadRequest, ""},
+		{http.MethodPut, "/api/rate", "text/csv", "days,times,price\nsomeday,0900-1000,100\n", http.StatusBadRequest, ""},
+		{http.MethodDelete, "/api/rate?days=thurs&times=0000-0100", "", "", http.StatusBadRequest, ""},
+		{http.MethodPost, "/api/rate/batch", "application/json", `[{"start": "2015-07-01T07:00:00Z", "end": "2015-07-01T12:00:00Z"}, {"start": "x", "end": "y"}]`, http.StatusOK, ""},
+		{http.MethodGet, "/api/rates", "", "", http.StatusOK, ""},
+		{http.MethodGet, "/api/rates/coverage", "", "", http.StatusOK, ""},
+		{http.MethodGet, "/api/rates/coverage?minimum=90", "", "", http.StatusUnprocessableEntity, ""},
+		{http.MethodPost, "/api/rates/validate", "application/json", string(api.JSONDefaultRateConfig), http.StatusOK, ""},
+		{http.MethodGet, "/api/rate?start=2015-07-01T12:00:00Z&end=2015-07-01T07:00:00Z", "", "", http.StatusBadRequest, "application/problem+json"},
+		{http.MethodPost, "/api/rates/validate?minimum=90", "application/json", string(api.JSONDefaultRateConfig), http.StatusUnprocessableEntity, "application/problem+json"},
+		{http.MethodGet, "/api/rate?start=2015-07-01T07:00:00Z&end=2015-07-01T12:00:00Z", "", "", http.StatusNotAcceptable, "image/png"},
+		{http.MethodGet, "/api/rates", "", "", http.StatusOK, "application/xml;q=0.5, application/*"},
+		{http.MethodGet, "/api/rate?start=2015-07-01T07:00:00Z&end=2015-07-01T12:00:00Z&detail=true", "", "", http.StatusOK, "application/yaml"},
+		{http.MethodGet, "/api/rates/coverage", "", "", http.StatusOK, "text/plain"},
+		{http.MethodGet, "/api/rates", "", "", http.StatusOK, "text/plain, application/yaml;q=0.5"},
+		{http.MethodGet, "/api/rate?start=2015-07-01T07:00:00Z&end=2015-07-01T12:00:00Z&detail=true&code=NONE", "", "", http.StatusOK, ""},
+		{http.MethodGet, "/api/rate?start=2015-07-01T07:00:00Z&end=2015-07-01T12:00:00Z&vehicle=truck", "", "", http.StatusBadRequest, ""},
+		{http.MethodPost, "/api/discounts", "application/json", `{"discounts": [{"code": "HALF", "type": "percent", "percent": 50, "valid_from": "2015-07-01T00:00:00Z"}]}`, http.StatusOK, ""},
+		{http.MethodGet, "/api/discounts", "", "", http.StatusOK, ""},
+		{http.MethodPost, "/api/discounts/redeem?code=NONE", "", "", http.StatusBadRequest, ""},
+		{http.MethodPut, "/api/discounts", "application/json", `{"discounts": []}`, http.StatusOK, ""},
+		{http.MethodPost, "/api/sessions?ticket=OPENAPI&start=2015-07-01T07:00:00Z", "", "", http.StatusOK, ""},
+		{http.MethodPost, "/api/sessions/checkout?ticket=OPENAPI&end=2015-07-01T12:00:00Z", "", "", http.StatusOK, ""},
+		{http.MethodPost, "/api/sessions/checkout?ticket=NONE", "", "", http.StatusNotFound, ""},
+		{http.MethodGet, "/api/sessions?status=closed", "", "", http.StatusOK, ""},
+		{http.MethodGet, "/api/sessions?status=parked", "", "", http.StatusBadRequest, ""},
+		{http.MethodPost, "/api/sessions?reservation=NONE", "", "", http.StatusNotFound, ""},
+		{http.MethodPost, "/api/reservations?start=2035-07-04T07:00:00Z&end=2035-07-04T12:00:00Z", "", "", http.StatusOK, ""},
+		{http.MethodPost, "/api/reservations?start=2035-07-05T07:00:00Z&end=2035-07-05T12:00:00Z", "", "", http.StatusNotFound, ""},
+		{http.MethodGet, "/api/reservations?status=booked", "", "", http.StatusOK, ""},
+		{http.MethodPost, "/api/reservations?start=2015-07-01T07:00:00Z&end=2015-07-01T12:00:00Z", "", "", http.StatusBadRequest, ""},
+		{http.MethodPost, "/api/reservations/cancel?id=NONE", "", "", http.StatusNotFound, ""},
+		{http.MethodPost, "/api/occupancy?event=entry", "", "", http.StatusOK, ""},
+		{http.MethodPost, "/api/occupancy?event=exit", "", "", http.StatusOK, ""},
+		{http.MethodPost, "/api/occupancy?event=leave", "", "", http.StatusBadRequest, ""},
+		{http.MethodGet, "/api/occupancy", "", "", http.StatusOK, ""},
+		{http.MethodGet, "/api/occupancy/audit", "", "", http.StatusOK, ""},
+		{http.MethodPost, "/api/webhooks", "application/json", `{"url": "example.com/gopark"}`, http.StatusBadRequest, ""},
+		{http.MethodGet, "/api/webhooks", "", "", http.StatusOK, ""},
+		{http.MethodDelete, "/api/webhooks?id=NONE", "", "", http.StatusNotFound, ""},
+		{http.MethodGet, "/api/webhooks/deliveries", "", "", http.StatusOK, ""},
+		{http.MethodGet, "/api/graphql?query=%7Bfacility%7Bcapacity%20free%7D%7D", "", "", http.StatusOK, ""},
+		{http.MethodGet, "/api/graphql", "", "", http.StatusBadRequest, ""},
+		{http.MethodPost, "/api/graphql", "application/json", `{"query": "{ quote(start: \"2015-07-02T07:00:00Z\", end: \"2015-07-02T12:00:00Z\") { price } }"}`, http.StatusOK, ""},
+		{http.MethodPost, "/api/graphql", "application/json", `{"query": "{ schedule { days } }"}`, http.StatusOK, ""},
+	}
+
+	for _, request := range requests {
+		r := httptest.NewRequest(request.method, request.target, strings.NewReader(request.body))
+		r.Header.Set("Accept", "application/json")
+		if request.accept != "" {
+			r.Header.Set("Accept", request.accept)
+		}
+		if request.contentType != "" {
+			r.Header.Set("Content-Type", request.contentType)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		assert.Equal(t, request.status, w.Code, request.target)
+
+		route, pathParams, err := router.FindRoute(r)
+		assert.NoError(t, err, request.target)
+
+		input := &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: &openapi3filter.RequestValidationInput{
+				Request:    r,
+				PathParams: pathParams,
+				Route:      route,
+			},
+			Status: w.Code,
+			Header: w.Header(),
+			Body:   ioutil.NopCloser(strings.NewReader(w.Body.String())),
+		}
+		err = openapi3filter.ValidateResponse(context.Background(), input)
+		assert.NoError(t, err, "%s %s: %s", request.method, request.target, w.Body.String())
+	}
+}
+
+func TestOpenAPIDocumentRejectsDrift(t *testing.T) {
+	doc := loadOpenAPIDocument(t)
+
+	// The response documented on the old API contract no longer validates
+	schema := doc.Components.Schemas["APIStandardResponse"].Value
+	var body interface{}
+	err := json.Unmarshal([]byte(`{"error": "could not parse 'start' parameter"}`), &body)
+	assert.NoError(t, err)
+	assert.Error(t, schema.VisitJSON(body))
+}
@@ -0,0 +1,256 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// Quote is an itemized price for a Duration. Items lists each rule applied to the duration, and the
+// Subtotal is their sum. Adjustments lists any caps, discounts, taxes or fees applied afterwards, so
+// that the Total is explainable. All amounts are in the minor unit of the Currency. Discounts has a
+// result for each discount code given for the quote, and the Vehicle is the class of vehicle priced.
+// The Multiplier is the factor of the occupancy band that changed the price, if one did.
+type Quote struct {
+	Currency    string           `json:"currency"`
+	Vehicle     string           `json:"vehicle"`
+	Items       []LineItem       `json:"items" xml:"Item"`
+	Subtotal    uint             `json:"subtotal"`
+	Adjustments []Adjustment     `json:"adjustments" xml:"Adjustment"`
+	Total       uint             `json:"total"`
+	Multiplier  float64          `json:"multiplier,omitempty" xml:",omitempty"`
+	Discounts   []DiscountResult `json:"discounts,omitempty" xml:"Discount"`
+
+	occupancy float64 // How full the facility was, in percent, when a band changed the price.
+}
+
+// LineItem is the part of a Quote priced by a single HourlyRate, or by the SpecialRate named by
+// Special, in which case there is no Rate. The Tier is the band of the ladder of the rate that priced
+// the Minutes of the line item, if the rate has a ladder. A line item for Minutes that are free under
+// a grace period or free-minute allowance describes it by Grace, and has no price.
+type LineItem struct {
+	Day       string      `json:"day"`
+	Times     string      `json:"times"`
+	Rate      *HourlyRate `json:"rate,omitempty"`
+	Special   string      `json:"special,omitempty"`
+	Tier      string      `json:"tier,omitempty"`
+	Grace     string      `json:"grace,omitempty"`
+	Minutes   uint64      `json:"minutes"`
+	UnitPrice uint        `json:"unit_price"`
+	Subtotal  uint        `json:"subtotal"`
+}
+
+// label returns the times of the line item, followed by the name of its special rate, the band of its
+// tier or its grace, if any.
+func (i LineItem) label() string {
+	if i.Grace != "" {
+		return i.Times + " " + i.Grace
+	} else if i.Special != "" {
+		return i.Times + " " + i.Special
+	} else if i.Tier != "" {
+		return i.Times + " " + i.Tier
+	}
+	return i.Times
+}
+
+// Adjustment is a change to the price of a Quote after its line items have been priced. The Type
+// describes the kind of adjustment, such as a "cap", "discount", "tax" or "fee", and the Amount is
+// negative when it lowers the price. An Included adjustment, such as an inclusive tax, is already part
+// of the price, and does not change the Total.
+type Adjustment struct {
+	Type        string `json:"type"`
+	Description string `json:"desc"`
+	Amount      int    `json:"amount"`
+	Included    bool   `json:"included,omitempty"`
+}
+
+// rate returns the rate that priced the line items of the quote, or nil if no rate did, such as for a
+// special rate or a grace period.
+func (q Quote) rate() *HourlyRate {
+	for _, item := range q.Items {
+		if item.Rate != nil {
+			return item.Rate
+		}
+	}
+	return nil
+}
+
+// total returns the subtotal with each adjustment that is not included applied, and at least 0.
+func (q Quote) total() uint {
+	total := int(q.Subtotal)
+	for _, adjustment := range q.Adjustments {
+		if !adjustment.Included {
+			total += adjustment.Amount
+		}
+	}
+	if total < 0 {
+		return 0
+	}
+	return uint(total)
+}
+
+// addCharges adds an adjustment to the quote for each charge on a price.
+func (q *Quote) addCharges(charges []Charge, price uint) {
+	for _, charge := range charges {
+		q.Adjustments = append(q.Adjustments, charge.adjustment(price))
+	}
+}
+
+// writeText writes the line items and adjustments of the quote as a table, followed by the total.
+func (q Quote) writeText(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, item := range q.Items {
+		fmt.Fprintf(tw, "  %v\t%v\t%v min\t%v\t%v\n", item.Day, item.label(), item.Minutes, q.format(int(item.UnitPrice)), q.format(int(item.Subtotal)))
+	}
+	if len(q.Adjustments) > 0 {
+		fmt.Fprintf(tw, "  subtotal\t\t\t\t%v\n", q.format(int(q.Subtotal)))
+	}
+	for _, adjustment := range q.Adjustments {
+		fmt.Fprintf(tw, "  %v\t%v\t\t\t%v\n", adjustment.Type, adjustment.Description, q.format(adjustment.Amount))
+	}
+	fmt.Fprintf(tw, "  total\t\t\t\t%v\n", q.Price())
+	tw.Flush()
+}
+
+// Price returns the total of the quote in its currency.
+func (q Quote) Price() Money {
+	return Money{Amount: q.Total, Currency: q.Currency}
+}
+
+// format formats an amount of the quote in its currency, with a sign if it is negative.
+func (q Quote) format(amount int) string {
+	if amount < 0 {
+		return "-" + Money{Amount: uint(-amount), Currency: q.Currency}.String()
+	}
+	return Money{Amount: uint(amount), Currency: q.Currency}.String()
+}
+
+// QuoteOptions are the optional inputs of a quote. The Vehicle is the class of vehicle to price, or
+// the default class of the rates if it is empty. Codes are discount codes to look up in Discounts.
+// The Occupancy of the facility at the time of the quote selects the occupancy band of the rate.
+type QuoteOptions struct {
+	Vehicle   string
+	Discounts *Discounts
+	Codes     []string
+	Occupancy *Occupancy
+}
+
+// QuoteByDuration returns an itemized price for the time duration, if available.
+func (weekRates *WeeklyRates) QuoteByDuration(d Duration) (Quote, error) {
+	return weekRates.QuoteWithOptions(d, QuoteOptions{})
+}
+
+// QuoteWithOptions returns an itemized price for the time duration, if available, for the class of
+// vehicle and with the largest of the discounts for the codes applied. The stay is priced by its rate,
+// changed by the occupancy band of the rate if the facility has a capacity, or by a special rate that
+// applies to it, if one is cheaper. Taxes and fees are charged on the discounted price. A stay within its grace period
+// or free minutes is free, with no taxes or fees, even if no rate covers it. An error for an unknown
+// vehicle class is an *Error, unlike the error for a duration without a rate.
+func (weekRates *WeeklyRates) QuoteWithOptions(d Duration, options QuoteOptions) (Quote, error) {
+	vehicle, err := weekRates.vehicleFor(options.Vehicle)
+	if err != nil {
+		return Quote{}, err
+	}
+
+	// Grace applies before pricing, so that a free stay is quoted even without a rate.
+	if grace := weekRates.graceFor(d); grace.covers(d.minutes()) {
+		quote := Quote{
+			Currency:    weekRates.Currency(),
+			Vehicle:     vehicle,
+			Items:       []LineItem{grace.item(d)},
+			Adjustments: []Adjustment{},
+		}
+		options.Discounts.apply(&quote, d, options.Codes)
+		return quote, nil
+	}
+
+	quote, charges, err := weekRates.itemize(d, vehicle)
+	if capacity := weekRates.Capacity(); err == nil && capacity > 0 && options.Occupancy != nil {
+		quote.applyOccupancy(options.Occupancy.Percent(capacity))
+	}
+	for _, special := range weekRates.Specials() {
+		if special.AppliesTo(d) && (err != nil || special.Price < quote.total()) {
+			item := special.item(d)
+			quote, charges, err = Quote{Items: []LineItem{item}, Subtotal: item.Subtotal, Adjustments: []Adjustment{}}, nil, nil
+		}
+	}
+	if err != nil {
+		return Quote{}, err
+	}
+	quote.Currency = weekRates.Currency()
+	quote.Vehicle = vehicle
+	options.Discounts.apply(&quote, d, options.Codes)
+
+	// Charges of the rule apply to its line items, and charges of the facility to the whole quote, both
+	// after any discount.
+	price := quote.total()
+	quote.addCharges(charges, price)
+	quote.addCharges(weekRates.FacilityCharges(), price)
+
+	quote.Total = quote.total()
+	return quote, nil
+}
+
+// itemize returns a quote with the line items for the rate of the time duration and class of vehicle,
+// and the charges of the rate, if a single rate covers the duration. If the rate has a ladder, the free
+// minutes of its grace are a line item of their own, and its tiers start after them. The price of a rate
+// without a ladder is for the whole stay, so its free minutes only make a stay within them free, which
+// QuoteWithOptions quotes before pricing. The quote has the cap of the ladder of the rate as an
+// adjustment, if the stay reaches it.
+func (weekRates *WeeklyRates) itemize(d Duration, vehicle string) (Quote, []Charge, error) {
+	if d.Start.YearDay() != d.End.YearDay() {
+		return Quote{}, nil, fmt.Errorf("start and end times must be on same day: start=%v, end=%v", d.Start.YearDay(), d.End.YearDay())
+	}
+
+	dayRates := weekRates.Days[d.Start.Weekday()]
+	startMin := MinutesSinceMidnightFromTime(d.Start)
+	endMin := MinutesSinceMidnightFromTime(d.End)
+
+	startRate, err := dayRates.AtMinuteSinceMidnight(startMin)
+	if err != nil {
+		return Quote{}, nil, fmt.Errorf("rate unavailable: %v", err.Error())
+	}
+
+	endRate, err := dayRates.AtMinuteSinceMidnight(endMin)
+	if err != nil {
+		return Quote{}, nil, fmt.Errorf("rate unavailable: %v", err.Error())
+	}
+
+	// Require that rates are in the same range, even if the numeric price
+	// is equal.
+	if !startRate.EqualTo(endRate) {
+		return Quote{}, nil, fmt.Errorf("rate not in same time range")
+	}
+
+	// The price of a rate is for the whole stay within its time range, so a
+	// single line item is billed at the rate's price, unless the rate has a
+	// ladder, which bills a line item for each tier used.
+	item := LineItem{
+		Day:       StringFromWeekday(startRate.Day),
+		Times:     TimeRangeToConfigString(startRate.StartMinute, startRate.EndMinute),
+		Rate:      &startRate,
+		Minutes:   endMin - startMin,
+		UnitPrice: startRate.PriceFor(vehicle).Amount,
+		Subtotal:  startRate.PriceFor(vehicle).Amount,
+	}
+	quote := Quote{Items: []LineItem{}, Adjustments: []Adjustment{}}
+	if startRate.Ladder == nil {
+		quote.Items = append(quote.Items, item)
+	} else {
+		if grace := weekRates.graceOf(startRate); grace.FreeMinutes > 0 {
+			var free LineItem
+			free, item.Minutes = grace.freeItem(item.Day, startMin, item.Minutes)
+			quote.Items = append(quote.Items, free)
+		}
+		items, limit := startRate.Ladder.items(item, item.Minutes)
+		quote.Items = append(quote.Items, items...)
+		if limit != nil {
+			quote.Adjustments = append(quote.Adjustments, *limit)
+		}
+	}
+
+	for _, item := range quote.Items {
+		quote.Subtotal += item.Subtotal
+	}
+	return quote, startRate.Charges, nil
+}
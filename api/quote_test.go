@@ -0,0 +1,64 @@
+package api_test
+
+import (
+	"encoding/xml"
+	"github.com/jtide/gopark/api"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestQuoteByDuration(t *testing.T) {
+	rates := api.NewWeeklyRates()
+	err := rates.Update(jsonStandardConfig)
+	assert.NoError(t, err)
+
+	duration, err := api.ParseDuration("2015-07-01T07:00:00Z", "2015-07-01T12:00:00Z")
+	assert.NoError(t, err)
+
+	quote, err := rates.QuoteByDuration(duration)
+	assert.NoError(t, err)
+	assert.Equal(t, []api.LineItem{{
+		Day:       "wed",
+		Times:     "0600-1800",
+		Rate:      &api.HourlyRate{Day: time.Wednesday, StartMinute: 360, EndMinute: 1080, Price: api.Money{Amount: 1750, Currency: "USD"}},
+		Minutes:   300,
+		UnitPrice: 1750,
+		Subtotal:  1750,
+	}}, quote.Items)
+	assert.Empty(t, quote.Adjustments)
+	assert.Equal(t, uint(1750), quote.Total)
+	assert.Equal(t, "USD", quote.Currency)
+	assert.Equal(t, "$17.50", quote.Price().String())
+}
+
+func TestQuoteByDurationUnavailable(t *testing.T) {
+	rates := api.NewWeeklyRates()
+	err := rates.Update(jsonStandardConfig)
+	assert.NoError(t, err)
+
+	duration, err := api.ParseDuration("2015-07-02T07:00:00Z", "2015-07-02T12:00:00Z")
+	assert.NoError(t, err)
+
+	_, err = rates.QuoteByDuration(duration)
+	assert.EqualError(t, err, "rate unavailable: no rate exists for minute: 420")
+}
+
+func TestRateXMLWithBreakdown(t *testing.T) {
+	quote := api.Quote{
+		Items:       []api.LineItem{{Day: "wed", Times: "0600-1800", Subtotal: 1750}},
+		Adjustments: []api.Adjustment{{Type: "discount", Description: "promo", Amount: -250}},
+		Total:       1500,
+	}
+	rate := api.Rate{Status: 200, Price: 1500, Breakdown: &quote}
+
+	data, err := rate.XML()
+	assert.NoError(t, err)
+
+	decoded := api.Rate{}
+	err = xml.Unmarshal(data, &decoded)
+	assert.NoError(t, err)
+	assert.Equal(t, "wed", decoded.Breakdown.Items[0].Day)
+	assert.Equal(t, -250, decoded.Breakdown.Adjustments[0].Amount)
+	assert.Equal(t, uint(1500), decoded.Breakdown.Total)
+}
@@ -1,20 +1,52 @@
 package api
 
 import (
+	"bytes"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"net/http"
+	"reflect"
 	"sort"
 	"strings"
 	"time"
 )
 
+// Rate is the response for a duration with an available price. The Price is in the minor unit
+// of the Currency, such as cents for USD, and the FormattedPrice is the same price for display,
+// such as "$15.00", for the class of Vehicle. Discounts has a result for each discount code given for
+// the quote. The Multiplier is the factor of the occupancy band that changed the price, if one did.
+// The Breakdown is only included when a detailed quote is requested. Available is only included
+// when the facility declares a capacity, and is true when it has a spot free for the stay. A stay
+// without a spot free is an UnknownRate that is "full" instead.
 type Rate struct {
-	Status uint      `json:"status"`
-	Start  time.Time `json:"start"`
-	End    time.Time `json:"end"`
-	Price  uint      `json:"price"`
+	Status         uint             `json:"status"`
+	Start          time.Time        `json:"start"`
+	End            time.Time        `json:"end"`
+	Price          uint             `json:"price"`
+	Currency       string           `json:"currency"`
+	FormattedPrice string           `json:"formatted_price"`
+	Vehicle        string           `json:"vehicle"`
+	Discounts      []DiscountResult `json:"discounts,omitempty" xml:"Discount"`
+	Multiplier     float64          `json:"multiplier,omitempty" xml:",omitempty"`
+	Available      *bool            `json:"available,omitempty" xml:",omitempty"`
+	Breakdown      *Quote           `json:"breakdown,omitempty"`
+}
+
+// NewRate returns the response for a duration priced by a quote.
+func NewRate(d Duration, quote Quote) Rate {
+	return Rate{
+		Status:         http.StatusOK,
+		Start:          d.Start,
+		End:            d.End,
+		Price:          quote.Total,
+		Currency:       quote.Currency,
+		FormattedPrice: quote.Price().String(),
+		Vehicle:        quote.Vehicle,
+		Multiplier:     quote.Multiplier,
+		Discounts:      quote.Discounts,
+	}
 }
 
 // JSON implementation for WebFormatter interface.
@@ -32,11 +64,47 @@ func (r Rate) StatusCode() uint {
 	return r.Status
 }
 
+// Text implementation for TextFormatter interface.
+func (r Rate) Text() ([]byte, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "Start: %v\nEnd:   %v\n", r.Start.Format(time.RFC3339), r.End.Format(time.RFC3339))
+	if r.Breakdown != nil {
+		r.Breakdown.writeText(&b)
+	}
+	fmt.Fprintf(&b, "Price: %v\n", r.FormattedPrice)
+	for _, discount := range r.Discounts {
+		fmt.Fprintf(&b, "Code:  %v\n", discount.describe())
+	}
+	return b.Bytes(), nil
+}
+
+// HTML implementation for HTMLFormatter interface.
+func (r Rate) HTML() ([]byte, error) {
+	return page{
+		Title:     "Parking quote",
+		Start:     r.Start.Format(time.RFC3339),
+		End:       r.End.Format(time.RFC3339),
+		Price:     r.FormattedPrice,
+		Discounts: describeDiscounts(r.Discounts),
+		Breakdown: newPageBreakdown(r.Breakdown),
+	}.render()
+}
+
+// Prices of an UnknownRate.
+const (
+	PriceUnavailable = "unavailable"
+	PriceFull        = "full"
+)
+
+// UnknownRate is the response for a duration without a price. The Price is "unavailable" when no
+// single rate covers the stay, and "full" when the facility has no spot free for it, in which case
+// Available is false.
 type UnknownRate struct {
-	Status uint      `json:"status"`
-	Start  time.Time `json:"start"`
-	End    time.Time `json:"end"`
-	Price  string    `json:"price"`
+	Status    uint      `json:"status"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Price     string    `json:"price"`
+	Available *bool     `json:"available,omitempty" xml:",omitempty"`
 }
 
 // JSON implementation for WebFormatter interface.
@@ -54,21 +122,67 @@ func (r UnknownRate) StatusCode() uint {
 	return r.Status
 }
 
+// Text implementation for TextFormatter interface.
+func (r UnknownRate) Text() ([]byte, error) {
+	text := fmt.Sprintf("Start: %v\nEnd:   %v\nPrice: %v\n", r.Start.Format(time.RFC3339), r.End.Format(time.RFC3339), r.Price)
+	return []byte(text), nil
+}
+
+// HTML implementation for HTMLFormatter interface.
+func (r UnknownRate) HTML() ([]byte, error) {
+	title, message := "No rate available", "No single rate covers the whole stay."
+	if r.Price == PriceFull {
+		title, message = "Facility full", "No spot is free for the whole stay."
+	}
+	return page{
+		Title:   title,
+		Message: message,
+		Start:   r.Start.Format(time.RFC3339),
+		End:     r.End.Format(time.RFC3339),
+		Price:   r.Price,
+	}.render()
+}
+
 // currentWeeklyRates is (the only) global variable containing rate information for given times
 var currentWeeklyRates *WeeklyRates
 
-// WeeklyRates is a mapping of DailyRates for each day of the week
-type WeeklyRates map[time.Weekday]DailyRates
+// WeeklyRates is a mapping of DailyRates for each day of the week, with the Facility they belong to
+type WeeklyRates struct {
+	Facility Facility
+	Days     map[time.Weekday]DailyRates
+}
 
 // DailyRates is mapping between "minutes-since-midnight" and the associated rate that begins at that time
 type DailyRates map[uint64]HourlyRate
 
 // HourlyRate contains a price corresponding to a specific time-range and specific day of the week.
+// Vehicles are the prices for vehicle classes that differ from the Price, and a Ladder replaces the
+// Price with a price for the length of the stay. Charges are the taxes and
+// fees of the rule the rate was configured by, Grace is its grace period and free minutes, if the
+// rule has its own, and Occupancy are the bands that change its price as the facility fills up.
 type HourlyRate struct {
-	Day         time.Weekday `json:"day"`
-	StartMinute uint64       `json:"start"`
-	EndMinute   uint64       `json:"end"`
-	Price       uint         `json:"price"`
+	Day         time.Weekday    `json:"day"`
+	StartMinute uint64          `json:"start"`
+	EndMinute   uint64          `json:"end"`
+	Price       Money           `json:"price"`
+	Vehicles    []VehiclePrice  `json:"vehicles,omitempty" xml:"Vehicle"`
+	Ladder      *Ladder         `json:"ladder,omitempty"`
+	Charges     []Charge        `json:"charges,omitempty" xml:"Charge"`
+	Grace       *Grace          `json:"grace,omitempty"`
+	Occupancy   []OccupancyBand `json:"occupancy,omitempty" xml:"Occupancy"`
+}
+
+// Facility is the part of a rate configuration that applies to every quote, rather than to a single
+// rate: the taxes and fees of the facility, its default vehicle class, its special rates, its grace
+// period and free minutes, its capacity in spots and the refund rules of its reservations. It is kept
+// next to the rates of each day, so that it holds even while the facility has no rates.
+type Facility struct {
+	Charges        []Charge
+	DefaultVehicle string
+	Specials       []SpecialRate
+	Grace          *Grace
+	Capacity       uint
+	Refunds        []RefundRule
 }
 
 func (r1 *HourlyRate) EqualTo(r2 HourlyRate) bool {
@@ -84,27 +198,34 @@ func (r1 *HourlyRate) EqualTo(r2 HourlyRate) bool {
 	if r1.Price != r2.Price {
 		return false
 	}
+	if !reflect.DeepEqual(r1.Vehicles, r2.Vehicles) || !reflect.DeepEqual(r1.Ladder, r2.Ladder) {
+		return false
+	}
+	if !reflect.DeepEqual(r1.Charges, r2.Charges) || !reflect.DeepEqual(r1.Grace, r2.Grace) || !reflect.DeepEqual(r1.Occupancy, r2.Occupancy) {
+		return false
+	}
 	return true
 }
 
 // NewWeeklyRates creates an empty WeeklyRates table that is ready to populate
 func NewWeeklyRates() WeeklyRates {
-	rates := make(WeeklyRates)
-	rates[time.Monday] = make(DailyRates)
-	rates[time.Tuesday] = make(DailyRates)
-	rates[time.Wednesday] = make(DailyRates)
-	rates[time.Thursday] = make(DailyRates)
-	rates[time.Friday] = make(DailyRates)
-	rates[time.Saturday] = make(DailyRates)
-	rates[time.Sunday] = make(DailyRates)
+	rates := WeeklyRates{Days: make(map[time.Weekday]DailyRates)}
+	rates.Days[time.Monday] = make(DailyRates)
+	rates.Days[time.Tuesday] = make(DailyRates)
+	rates.Days[time.Wednesday] = make(DailyRates)
+	rates.Days[time.Thursday] = make(DailyRates)
+	rates.Days[time.Friday] = make(DailyRates)
+	rates.Days[time.Saturday] = make(DailyRates)
+	rates.Days[time.Sunday] = make(DailyRates)
 	return rates
 }
 
 func (src *WeeklyRates) DeepCopy() WeeklyRates {
 	rates := NewWeeklyRates()
-	for i, srcDailyRates := range *src {
+	rates.Facility = src.Facility
+	for i, srcDailyRates := range src.Days {
 		for j, srcRate := range srcDailyRates {
-			rates[i][j] = srcRate
+			rates.Days[i][j] = srcRate
 		}
 	}
 	return rates
@@ -113,14 +234,25 @@ func (src *WeeklyRates) DeepCopy() WeeklyRates {
 // ReplaceRates will clear any existing rate configuration and replace it with
 // a new configuration, specified in JSON format.
 func ReplaceRates(jsonConfig []byte) error {
+	config, err := ConfigRatesFromJSON(jsonConfig)
+	if err != nil {
+		return fmt.Errorf("failed to replace rates: %w", err)
+	}
+	return ReplaceRatesWithConfig(config)
+}
+
+// ReplaceRatesWithConfig will clear any existing rate configuration and replace
+// it with an already parsed configuration.
+func ReplaceRatesWithConfig(config ConfigRates) error {
 	rates := NewWeeklyRates()
-	err := rates.Update(jsonConfig)
+	err := rates.UpdateWithConfig(config)
 	if err != nil {
-		return fmt.Errorf("failed to replace rates: %v", err.Error())
+		return fmt.Errorf("failed to replace rates: %w", err)
 	}
 
 	// Set global weekly rates
 	currentWeeklyRates = &rates
+	ratesChanged(EventRatesReplaced)
 	return nil
 }
 
@@ -129,19 +261,54 @@ func ReplaceRates(jsonConfig []byte) error {
 // rates intact. It will return an error if the update fails, which may occur
 // if a rate already exists for the duration in a new rate.
 func UpdateRates(jsonConfig []byte) error {
+	config, err := ConfigRatesFromJSON(jsonConfig)
+	if err != nil {
+		return fmt.Errorf("failed to update rates: %w", err)
+	}
+	return UpdateRatesWithConfig(config)
+}
+
+// UpdateRatesWithConfig will update existing rate configuration, if possible,
+// with the rates of an already parsed configuration. See UpdateRates.
+func UpdateRatesWithConfig(config ConfigRates) error {
 	rates := currentWeeklyRates.DeepCopy()
-	err := rates.Update(jsonConfig)
+	err := rates.UpdateWithConfig(config)
 	if err != nil {
-		return fmt.Errorf("failed to update rates: %v", err.Error())
+		return fmt.Errorf("failed to update rates: %w", err)
 	}
 
 	// Update global weekly rates in one atomic operation
 	// to avoid race conditions where of queries could access
 	// rate information while it is being updated.
 	currentWeeklyRates = &rates
+	ratesChanged(EventRatesUpdated)
+	return nil
+}
+
+// RemoveRates will remove the existing rates for a time range, specified in the
+// configuration format such as "0900-2100", on each of a list of days, such as
+// "mon,tues". No rates are removed if any of the days has no rate for exactly
+// that time range.
+func RemoveRates(days string, times string) error {
+	rates := currentWeeklyRates.DeepCopy()
+	err := rates.Remove(days, times)
+	if err != nil {
+		return fmt.Errorf("failed to remove rates: %w", err)
+	}
+
+	// Update global weekly rates in one atomic operation, as for UpdateRates.
+	currentWeeklyRates = &rates
+	ratesChanged(EventRatesRemoved)
 	return nil
 }
 
+// ratesChanged sends a RateChange for an event and the current rates to the webhooks and to the
+// streams of rate changes of the gRPC API.
+func ratesChanged(event string) {
+	currentWebhooks.Notify(event, currentWeeklyRates)
+	currentWatchers.publish(event, currentWeeklyRates)
+}
+
 // Keys returns a sorted []uint64 array of start-time indexes (keys) for DailyRates.
 //
 // NOTE: When using Keys() with range, remember that it is actually the values
@@ -200,17 +367,146 @@ func (d *DailyRates) AtMinuteSinceMidnight(m uint64) (HourlyRate, error) {
 // Update accepts a JSON byte array to update the weekly rates.
 func (rates *WeeklyRates) Update(jsonNewRates []byte) error {
 	// Unmarshalling into ConfigRates will catch any JSON formatting errors early on.
-	config := ConfigRates{}
-	err := json.Unmarshal(jsonNewRates, &config)
+	config, err := ConfigRatesFromJSON(jsonNewRates)
 	if err != nil {
-		return fmt.Errorf("could not parse JSON to update rates : %v", err.Error())
+		return err
+	}
+
+	return rates.UpdateWithConfig(config)
+}
+
+// UpdateWithConfig updates the weekly rates with each rate of an already parsed configuration. The
+// rates of the configuration must be in the same currency as any existing rates. If the configuration
+// has facility charges, a default vehicle class, special rates, grace, a capacity or refund rules,
+// they replace those of the facility, and otherwise the facility keeps its own, even if the
+// configuration has no rates.
+func (rates *WeeklyRates) UpdateWithConfig(config ConfigRates) error {
+	currency := rates.Currency()
+	if config.Currency != "" {
+		c, err := CurrencyFromCode(config.Currency)
+		if err != nil {
+			return fmt.Errorf("could not update rate: %w", err)
+		}
+		if c.Code != currency && !rates.IsEmpty() {
+			err = newError(CodeCurrencyMismatch, "currency", "rates in %s cannot be added to rates in %s", c.Code, currency)
+			return fmt.Errorf("could not update rate: %w", err)
+		}
+		currency = c.Code
+	}
+
+	facility := rates.Facility
+	if config.Charges != nil {
+		if err := validateCharges(config.Charges); err != nil {
+			return fmt.Errorf("could not update rate: %w", err)
+		}
+		facility.Charges = config.Charges
+	}
+	if config.DefaultVehicle != "" {
+		vehicle, err := VehicleClassFromString(config.DefaultVehicle)
+		if err != nil {
+			return fmt.Errorf("could not update rate: %w", err)
+		}
+		facility.DefaultVehicle = vehicle
+	}
+	if config.Specials != nil {
+		specials, err := validateSpecials(config.Specials)
+		if err != nil {
+			return fmt.Errorf("could not update rate: %w", err)
+		}
+		facility.Specials = specials
+	}
+	if config.Grace != nil {
+		if err := config.Grace.Validate(); err != nil {
+			return fmt.Errorf("could not update rate: %w", err)
+		}
+		facility.Grace = config.Grace
+	}
+	if config.Capacity != 0 {
+		facility.Capacity = config.Capacity
+	}
+	if config.Refunds != nil {
+		if err := validateRefunds(config.Refunds); err != nil {
+			return fmt.Errorf("could not update rate: %w", err)
+		}
+		facility.Refunds = config.Refunds
 	}
 
 	// Update weekly rates with each new rate.
 	for _, newRateConfig := range config.Rates {
-		if err = updateRate(newRateConfig, rates); err != nil {
-			return fmt.Errorf("could not update rate: %v", err.Error())
+		if err := updateRate(newRateConfig, currency, rates); err != nil {
+			return fmt.Errorf("could not update rate: %w", err)
+		}
+	}
+
+	rates.Facility = facility
+	return nil
+}
+
+// Currency returns the ISO 4217 code of the currency of the weekly rates, or the DefaultCurrency
+// if there are no rates.
+func (rates *WeeklyRates) Currency() string {
+	for _, weekday := range Weekdays {
+		for _, rate := range rates.Days[weekday] {
+			return rate.Price.Currency
+		}
+	}
+	return DefaultCurrency
+}
+
+// FacilityCharges returns the taxes and fees that apply to every quote, or nil if the facility has none.
+func (rates *WeeklyRates) FacilityCharges() []Charge {
+	return rates.Facility.Charges
+}
+
+// Specials returns the special rates of the facility, or nil if it has none.
+func (rates *WeeklyRates) Specials() []SpecialRate {
+	return rates.Facility.Specials
+}
+
+// DefaultVehicle returns the vehicle class of quotes that do not give one.
+func (rates *WeeklyRates) DefaultVehicle() string {
+	if vehicle := rates.defaultVehicle(); vehicle != "" {
+		return vehicle
+	}
+	return DefaultVehicleClass
+}
+
+// defaultVehicle returns the default vehicle class of the configuration, or an empty string if it
+// does not declare one.
+func (rates *WeeklyRates) defaultVehicle() string {
+	return rates.Facility.DefaultVehicle
+}
+
+// IsEmpty returns true if there are no rates on any day of the week.
+func (rates *WeeklyRates) IsEmpty() bool {
+	for _, dayRates := range rates.Days {
+		if len(dayRates) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Remove deletes the rates for a time range on each of a list of days, in the same
+// format as a ConfigRate. It returns an error if any of the days has no rate for
+// exactly that time range, in which case the weekly rates may be partially updated.
+func (rates *WeeklyRates) Remove(days string, times string) error {
+	start, end, err := TimeRangeFromConfigString(times)
+	if err != nil {
+		return err
+	}
+
+	for _, day := range strings.Split(days, ",") {
+		weekday, err := WeekdayFromString(day)
+		if err != nil {
+			return err
 		}
+
+		rate, ok := rates.Days[weekday][start]
+		if !ok || rate.EndMinute != end {
+			return newError(CodeRateNotFound, "times", "no rate exists for %s on %s", times, day)
+		}
+		delete(rates.Days[weekday], start)
 	}
 
 	return nil
@@ -228,12 +524,34 @@ func (weekRates *WeeklyRates) Lookup(start string, end string) (uint, error) {
 }
 
 // updateRate is a helper function for the WeeklyRates.Update() method that attempts to
-// update the rate configuration for a single time-slot.
-func updateRate(rate ConfigRate, rates *WeeklyRates) error {
+// update the rate configuration for a single time-slot, with a price in the given currency.
+func updateRate(rate ConfigRate, currency string, rates *WeeklyRates) error {
 	start, end, err := TimeRangeFromConfigString(rate.Times)
 	if err != nil {
 		return err
 	}
+	vehicles, err := validateVehiclePrices(rate.Vehicles)
+	if err != nil {
+		return err
+	}
+	if rate.Ladder != nil {
+		if err = rate.Ladder.Validate(); err != nil {
+			return err
+		} else if len(vehicles) > 0 {
+			return newError(CodeInvalidLadder, "ladder", "a rate with a ladder cannot have prices for vehicle classes")
+		}
+	}
+	if err = validateCharges(rate.Charges); err != nil {
+		return err
+	}
+	if rate.Grace != nil {
+		if err = rate.Grace.Validate(); err != nil {
+			return err
+		}
+	}
+	if err = validateBands(rate.Occupancy); err != nil {
+		return err
+	}
 
 	days := strings.Split(rate.Days, ",")
 	for _, day := range days {
@@ -243,52 +561,42 @@ func updateRate(rate ConfigRate, rates *WeeklyRates) error {
 		}
 
 		// Create new rate for time-window
-		newRate := HourlyRate{Day: weekday, StartMinute: start, EndMinute: end, Price: rate.Price}
+		newRate := HourlyRate{
+			Day:         weekday,
+			StartMinute: start,
+			EndMinute:   end,
+			Price:       Money{Amount: rate.Price, Currency: currency},
+			Vehicles:    vehicles,
+			Ladder:      rate.Ladder,
+			Charges:     rate.Charges,
+			Grace:       rate.Grace,
+			Occupancy:   rate.Occupancy,
+		}
 		if err = rates.ConflictsWith(newRate); err != nil {
-			return fmt.Errorf("new rate presents a conflict %v: %v", newRate, err.Error())
+			return newError(CodeRateConflict, "times", "new rate presents a conflict %v: %w", newRate, err)
 		}
 
 		// Insert new rate for the appropriate weekday
-		(*rates)[weekday][start] = newRate
+		rates.Days[weekday][start] = newRate
 	}
 
 	return nil
 }
 
 // LookupByDuration returns a price for the time duration, if available.
+// See QuoteByDuration for an itemized price.
 func (weekRates *WeeklyRates) LookupByDuration(d Duration) (uint, error) {
-
-	if d.Start.YearDay() != d.End.YearDay() {
-		return 0, fmt.Errorf("start and end times must be on same day: start=%v, end=%v", d.Start.YearDay(), d.End.YearDay())
-	}
-
-	dayRates := (*weekRates)[d.Start.Weekday()]
-	startMin := MinutesSinceMidnightFromTime(d.Start)
-	endMin := MinutesSinceMidnightFromTime(d.End)
-
-	startRate, err := dayRates.AtMinuteSinceMidnight(startMin)
-	if err != nil {
-		return 0, fmt.Errorf("rate unavailable: %v", err.Error())
-	}
-
-	endRate, err := dayRates.AtMinuteSinceMidnight(endMin)
+	quote, err := weekRates.QuoteByDuration(d)
 	if err != nil {
-		return 0, fmt.Errorf("rate unavailable: %v", err.Error())
-	}
-
-	// Require that rates are in the same range, even if the numeric price
-	// is equal.
-	if !startRate.EqualTo(endRate) {
-		return 0, fmt.Errorf("rate not in same time range")
+		return 0, err
 	}
-
-	return startRate.Price, nil
+	return quote.Total, nil
 }
 
 // ConflictsWith determines if a new HourlyRate will overlap with any existing HourlyRate in WeeklyRates, and
 // returns true if a conflict exists, false if no conflict.
 func (weekRates *WeeklyRates) ConflictsWith(newRate HourlyRate) error {
-	dayRates := (*weekRates)[newRate.Day]
+	dayRates := weekRates.Days[newRate.Day]
 
 	rate, err := dayRates.AtMinuteSinceMidnight(newRate.StartMinute)
 	if err == nil {
@@ -305,7 +613,10 @@ func (weekRates *WeeklyRates) ConflictsWith(newRate HourlyRate) error {
 // /api/rate endpoint and dispatches requests appropriately, based
 // on the type of request method.
 func RateHandleFunc(w http.ResponseWriter, r *http.Request) {
-	InitializeResponse(&w, r) // Required before WriteResponse
+	r, ok := InitializeResponse(&w, r) // Required before WriteResponse
+	if !ok {
+		return
+	}
 
 	switch r.Method {
 	case http.MethodGet:
@@ -314,70 +625,132 @@ func RateHandleFunc(w http.ResponseWriter, r *http.Request) {
 		RatePutHandleFunc(w, r)
 	case http.MethodPost:
 		RatePostHandleFunc(w, r)
+	case http.MethodDelete:
+		RateDeleteHandleFunc(w, r)
 	default:
-		err := fmt.Errorf("%v method is not supported at this endpoint", r.Method)
-		WriteResponse(APIStandardResponse{http.StatusBadRequest, err.Error()}, &w)
+		err := methodNotSupported(r.Method)
+		WriteError(http.StatusBadRequest, err, &w, r)
 	}
 }
 
 // RateGetHandleFunc provides an endpoint to that echos back both a start and end timestamp
 // in RFC3339 format along with the price for the duration, if available.  Returns a response
-// with "unavailable" if a rate does not exist for the requested time range.
+// with "unavailable" if a rate does not exist for the requested time range. If the optional
+// "detail" parameter is true, an itemized breakdown of the price is included. Discount codes in the
+// optional "code" parameter are applied to the price, and the optional "vehicle" parameter is the
+// class of vehicle to price, which is the default class of the rates if it is missing. When the
+// facility declares a capacity, the response says whether a spot is available, and is "full" with a
+// 409 status if the vehicles parked now and the reservations leave no spot free during the stay. A
+// price that an occupancy band changed is recorded in the audit of the occupancy.
 //
 // Example:
-// 		curl  "http://localhost:8080/api/duration?start=2015-07-01T07%3A00%3A00Z&end=2015-07-01T12%3A00%3A00Z"
+//
+//	curl  "http://localhost:8080/api/duration?start=2015-07-01T07%3A00%3A00Z&end=2015-07-01T12%3A00%3A00Z"
 func RateGetHandleFunc(w http.ResponseWriter, r *http.Request) {
 	// Calculate duration from start to end
 	duration, err := DurationFromHTTPRequest(r)
 	if err != nil {
-		WriteResponse(APIStandardResponse{http.StatusBadRequest, err.Error()}, &w)
+		WriteError(http.StatusBadRequest, err, &w, r)
 		return
 	}
 
-	// Lookup the Rate
-	price, err := currentWeeklyRates.LookupByDuration(duration)
+	detailed, err := DetailFromHTTPRequest(r)
 	if err != nil {
-		unknownRate := UnknownRate{Status: http.StatusNotFound, Start: duration.Start, End: duration.End, Price: "unavailable"}
-		WriteResponse(unknownRate, &w)
+		WriteError(http.StatusBadRequest, err, &w, r)
+		return
+	}
+
+	// Lookup the Rate
+	options := QuoteOptions{
+		Vehicle:   VehicleFromHTTPRequest(r),
+		Discounts: currentDiscounts,
+		Codes:     CodesFromHTTPRequest(r),
+		Occupancy: currentOccupancy,
+	}
+	quote, err := currentWeeklyRates.QuoteWithOptions(duration, options)
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		WriteError(http.StatusBadRequest, err, &w, r)
+		return
+	} else if err != nil {
+		unknownRate := UnknownRate{Status: http.StatusNotFound, Start: duration.Start, End: duration.End, Price: PriceUnavailable}
+		WriteResponse(unknownRate, &w, r)
 		return
 	}
 
 	// Return rate in Rate format
-	rate := Rate{Status: http.StatusOK, Start: duration.Start, End: duration.End, Price: price}
-	err = WriteResponse(rate, &w)
+	rate := NewRate(duration, quote)
+	rate.Available = spotFree(duration, time.Now(), currentWeeklyRates.Capacity())
+	if rate.Available != nil && !*rate.Available {
+		full := UnknownRate{Status: http.StatusConflict, Start: duration.Start, End: duration.End, Price: PriceFull, Available: rate.Available}
+		WriteResponse(full, &w, r)
+		return
+	}
+	if detailed {
+		rate.Breakdown = &quote
+	}
+	currentOccupancy.record(duration, quote)
+	err = WriteResponse(rate, &w, r)
 	if err != nil {
-		WriteResponse(APIStandardResponse{http.StatusBadRequest, err.Error()}, &w)
+		WriteError(http.StatusBadRequest, err, &w, r)
 		return
 	}
 }
 
 // RatePutHandleFunc overwrites all existing rates with rates specified in the Put body. The put request
-// must be in JSON format, and have the "Content-Type:application/json" header set.
+// must be in JSON or CSV format, and have either the "Content-Type:application/json" or the
+// "Content-Type:text/csv" header set.
 func RatePutHandleFunc(w http.ResponseWriter, r *http.Request) {
-	jsonConfig, err := JSONFromRequestBody(r)
+	config, err := ConfigFromRequestBody(r)
 	if err != nil {
-		WriteResponse(APIStandardResponse{http.StatusBadRequest, err.Error()}, &w)
+		WriteError(http.StatusBadRequest, err, &w, r)
 		return
-	} else if err = ReplaceRates(jsonConfig); err != nil {
-		WriteResponse(APIStandardResponse{http.StatusBadRequest, err.Error()}, &w)
+	} else if err = ReplaceRatesWithConfig(config); err != nil {
+		WriteError(http.StatusBadRequest, err, &w, r)
 		return
 	}
 
-	WriteResponse(APIStandardResponse{http.StatusOK, "replaced rates"}, &w)
+	WriteResponse(APIStandardResponse{Status: http.StatusOK, Description: "replaced rates"}, &w, r)
 }
 
-// RatePostHandleFunc updates existing rates, if possible, with rates specified in the Post body. The put request
-// must be in JSON format, and have the "Content-Type:application/json" header set. The update will fail
+// RatePostHandleFunc updates existing rates, if possible, with rates specified in the Post body. The post request
+// must be in JSON or CSV format, with the matching "Content-Type" header set. The update will fail
 // if the time range of any new rate overlaps with that of an existing rate.
 func RatePostHandleFunc(w http.ResponseWriter, r *http.Request) {
-	jsonConfig, err := JSONFromRequestBody(r)
+	config, err := ConfigFromRequestBody(r)
 	if err != nil {
-		WriteResponse(APIStandardResponse{http.StatusBadRequest, err.Error()}, &w)
+		WriteError(http.StatusBadRequest, err, &w, r)
+		return
+	} else if err = UpdateRatesWithConfig(config); err != nil {
+		WriteError(http.StatusBadRequest, err, &w, r)
+		return
+	}
+
+	WriteResponse(APIStandardResponse{Status: http.StatusOK, Description: "updated rates"}, &w, r)
+}
+
+// RateDeleteHandleFunc removes existing rates for the time range in the "times" parameter on each of the
+// days in the "days" parameter, using the same format as a rate configuration. The delete will fail, and
+// no rates are removed, if any of the days has no rate for exactly that time range.
+//
+// Example:
+//
+//	curl -X DELETE "http://localhost:8080/api/rate?days=mon,wed,sat&times=0100-0500"
+func RateDeleteHandleFunc(w http.ResponseWriter, r *http.Request) {
+	days := r.URL.Query().Get("days")
+	times := r.URL.Query().Get("times")
+	if days == "" {
+		err := newError(CodeMissingParameter, "days", "both 'days' and 'times' parameters are required to remove rates")
+		WriteError(http.StatusBadRequest, err, &w, r)
+		return
+	} else if times == "" {
+		err := newError(CodeMissingParameter, "times", "both 'days' and 'times' parameters are required to remove rates")
+		WriteError(http.StatusBadRequest, err, &w, r)
 		return
-	} else if err = UpdateRates(jsonConfig); err != nil {
-		WriteResponse(APIStandardResponse{http.StatusBadRequest, err.Error()}, &w)
+	} else if err := RemoveRates(days, times); err != nil {
+		WriteError(http.StatusBadRequest, err, &w, r)
 		return
 	}
 
-	WriteResponse(APIStandardResponse{http.StatusOK, "updated rates"}, &w)
+	WriteResponse(APIStandardResponse{Status: http.StatusOK, Description: "removed rates"}, &w, r)
 }
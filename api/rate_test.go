@@ -235,3 +235,30 @@ func TestWeeklyRates_DeepCopy(t *testing.T) {
 	assert.Error(t, err)
 	assert.Equal(t, uint(0), price)
 }
+
+func TestWeeklyRates_Remove(t *testing.T) {
+	rates := api.NewWeeklyRates()
+	err := rates.Update(jsonStandardConfig)
+	assert.NoError(t, err)
+
+	err = rates.Remove("mon,wed", "0100-0500")
+	assert.NoError(t, err)
+
+	price, err := rates.Lookup("2018-04-30T02:00:00Z", "2018-04-30T03:00:00Z")
+	assert.Error(t, err)
+	assert.Equal(t, uint(0), price)
+
+	// Saturday was not removed
+	price, err = rates.Lookup("2018-05-05T02:00:00Z", "2018-05-05T03:00:00Z")
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1000), price)
+}
+
+func TestWeeklyRates_RemoveWithDifferentTimes(t *testing.T) {
+	rates := api.NewWeeklyRates()
+	err := rates.Update(jsonStandardConfig)
+	assert.NoError(t, err)
+
+	err = rates.Remove("mon", "0100-0400")
+	assert.EqualError(t, err, "no rate exists for 0100-0400 on mon")
+}
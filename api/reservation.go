@@ -0,0 +1,494 @@
+package api
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Statuses of a Reservation.
+const (
+	ReservationBooked    = "booked"
+	ReservationCheckedIn = "checked_in"
+	ReservationCancelled = "cancelled"
+)
+
+// RefundRule is the Percent of the price of a reservation that is refunded when it is cancelled at
+// least Notice minutes before its start. The rule with the longest notice that a cancellation gives
+// applies, and nothing is refunded if no rule applies.
+type RefundRule struct {
+	Notice  uint64  `json:"notice"`
+	Percent float64 `json:"percent"`
+}
+
+// validateRefunds returns an error for the first refund rule with a percent that is negative or more
+// than 100, or with the same notice as another rule.
+func validateRefunds(rules []RefundRule) error {
+	seen := make(map[uint64]bool)
+	for _, rule := range rules {
+		if rule.Percent < 0 || rule.Percent > 100 {
+			return newError(CodeInvalidRefund, "refunds", "invalid percent %v for refund rule, must be at least 0 and at most 100", rule.Percent)
+		}
+		if seen[rule.Notice] {
+			return newError(CodeInvalidRefund, "refunds", "refund rule with notice of %d minutes is repeated", rule.Notice)
+		}
+		seen[rule.Notice] = true
+	}
+	return nil
+}
+
+// refund returns the amount refunded by the refund rules for a price, cancelled a number of minutes
+// before the start of the reservation, rounded half up to the minor unit.
+func refund(rules []RefundRule, price uint, notice uint64) uint {
+	var best *RefundRule
+	for i, rule := range rules {
+		if rule.Notice <= notice && (best == nil || rule.Notice > best.Notice) {
+			best = &rules[i]
+		}
+	}
+	if best == nil {
+		return 0
+	}
+	return uint(math.Round(float64(price) * best.Percent / 100))
+}
+
+// Reservation is a spot booked for a vehicle from Start to End. The Quote is the price of the stay
+// when it was booked, which is what the reservation costs even if the rates change. A reservation is
+// checked in when its vehicle arrives, with the Ticket of the session of the vehicle, from which time
+// the vehicle is counted by the occupancy instead. A cancelled reservation has the time it was
+// Cancelled and the amount of its Refund.
+type Reservation struct {
+	ID        string     `json:"id"`
+	Vehicle   string     `json:"vehicle"`
+	Status    string     `json:"status"`
+	Start     time.Time  `json:"start"`
+	End       time.Time  `json:"end"`
+	Quote     Quote      `json:"quote"`
+	Ticket    string     `json:"ticket,omitempty"`
+	Cancelled *time.Time `json:"cancelled,omitempty"`
+	Refund    *uint      `json:"refund,omitempty"`
+}
+
+// reservation is a reservation with the refund rules of the facility when it was booked, which is how
+// a reservation is saved.
+type reservation struct {
+	Reservation
+	Refunds []RefundRule `json:"refunds,omitempty"`
+}
+
+// reservationEntry is an entry of the journal of a store of reservations. The last entry of a
+// reservation is its current state, and Next is the number of the last reservation booked, which is
+// saved when the journal is compacted, so that the IDs of removed reservations are not used again.
+type reservationEntry struct {
+	Next        int          `json:"next,omitempty"`
+	Reservation *reservation `json:"reservation,omitempty"`
+}
+
+// Reservations is a store of reservations. Each change is appended to the journal at its path, if it
+// has one, and reservations are only kept in memory otherwise. Reservations that ended, or were
+// cancelled, longer ago than the retention of the store are removed whenever the journal is compacted,
+// unless the retention is 0. It is safe for concurrent use.
+type Reservations struct {
+	mu           sync.Mutex
+	journal      journal
+	retention    time.Duration
+	next         int
+	reservations map[string]*reservation
+}
+
+// currentReservations is the store of reservations used by the API.
+var currentReservations = NewReservations()
+
+// NewReservations returns an empty store of reservations, kept only in memory, that keeps every
+// reservation.
+func NewReservations() *Reservations {
+	return &Reservations{reservations: make(map[string]*reservation)}
+}
+
+// OpenReservations returns a store of reservations saved to a journal at a path, with the reservations
+// already in the journal, which keeps reservations for a retention after they end or are cancelled. The
+// journal is compacted as it is opened, and created if it does not exist. The store is only kept in
+// memory if the path is empty.
+func OpenReservations(path string, retention time.Duration) (*Reservations, error) {
+	rs := NewReservations()
+	rs.journal.path = path
+	rs.retention = retention
+
+	err := rs.journal.replay(func(data []byte) error {
+		var entry reservationEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return err
+		}
+		if entry.Next > rs.next {
+			rs.next = entry.Next
+		}
+		if r := entry.Reservation; r != nil {
+			if n, err := strconv.Atoi(strings.TrimPrefix(r.ID, "R")); err == nil && n > rs.next {
+				rs.next = n
+			}
+			rs.reservations[r.ID] = r
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read reservations from %s: %w", path, err)
+	}
+
+	if err = rs.compact(time.Now()); err != nil {
+		return nil, err
+	}
+	return rs, nil
+}
+
+// LoadReservations replaces the reservations of the API with those saved to a journal, which keeps
+// reservations for a retention, and saves every later change to the journal. See OpenReservations.
+func LoadReservations(path string, retention time.Duration) error {
+	rs, err := OpenReservations(path, retention)
+	if err != nil {
+		return err
+	}
+	currentReservations = rs
+	return nil
+}
+
+// save appends a change of a reservation to the journal of the store, and compacts the store once the
+// journal is full. The change is saved even if compacting fails, which is tried again after the next
+// change.
+func (rs *Reservations) save(r *reservation) error {
+	if err := rs.journal.append(reservationEntry{Reservation: r}); err != nil {
+		return fmt.Errorf("failed to save reservations: %w", err)
+	}
+	if rs.journal.full() {
+		rs.compact(time.Now())
+	}
+	return nil
+}
+
+// compact removes the reservations that ended, or were cancelled, longer ago than the retention of the
+// store, and rewrites the journal with the reservations that are left.
+func (rs *Reservations) compact(now time.Time) error {
+	if rs.retention > 0 {
+		before := now.Add(-rs.retention)
+		for id, r := range rs.reservations {
+			if r.End.Before(before) || (r.Cancelled != nil && r.Cancelled.Before(before)) {
+				delete(rs.reservations, id)
+			}
+		}
+	}
+
+	var ids []string
+	for id := range rs.reservations {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	entries := []interface{}{reservationEntry{Next: rs.next}}
+	for _, id := range ids {
+		entries = append(entries, reservationEntry{Reservation: rs.reservations[id]})
+	}
+	if err := rs.journal.rewrite(entries); err != nil {
+		return fmt.Errorf("failed to save reservations: %w", err)
+	}
+	return nil
+}
+
+// Book reserves a spot for the time duration, priced by the rates with the options of the quote, at the
+// occupancy when it is booked, and redeems the discount code applied to the price. It returns an error
+// if the duration starts before now, if no rate covers the duration, if the facility has a capacity
+// and the booked reservations, and the vehicles of the occupancy that are still expected to be parked,
+// already fill it at any time during the duration, or if the applied code can no longer be redeemed.
+func (rs *Reservations) Book(d Duration, rates *WeeklyRates, options QuoteOptions, now time.Time) (Reservation, error) {
+	if d.Start.Before(now) {
+		return Reservation{}, newError(CodeInvalidStart, "start", "the reservation starts at %s, before the current time", d.Start.Format(time.RFC3339))
+	}
+	quote, err := rates.QuoteWithOptions(d, options)
+	if err != nil {
+		var apiErr *Error
+		if errors.As(err, &apiErr) {
+			return Reservation{}, err
+		}
+		return Reservation{}, newError(CodeRateUnavailable, "start", "no rate is available for the reservation: %w", err)
+	}
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	facility := rates.Facility
+	if facility.Capacity > 0 && rs.peak(d)+occupiedDuring(d, now, options.Occupancy) >= facility.Capacity {
+		return Reservation{}, newError(CodeCapacityExceeded, "start", "all %d spots are taken during the stay", facility.Capacity)
+	}
+	if err := options.Discounts.redeem(quote, d); err != nil {
+		return Reservation{}, err
+	}
+
+	rs.next++
+	r := &reservation{
+		Reservation: Reservation{
+			ID:      fmt.Sprintf("R%d", rs.next),
+			Vehicle: quote.Vehicle,
+			Status:  ReservationBooked,
+			Start:   d.Start,
+			End:     d.End,
+			Quote:   quote,
+		},
+		Refunds: facility.Refunds,
+	}
+	rs.reservations[r.ID] = r
+	if err := rs.save(r); err != nil {
+		delete(rs.reservations, r.ID)
+		rs.next--
+		return Reservation{}, err
+	}
+	return r.Reservation, nil
+}
+
+// peak returns the largest number of booked reservations at any time during the duration. Reservations
+// that are checked in are not counted, as their vehicles are counted by the occupancy. The number of
+// reservations only rises at the start of the duration or of a reservation.
+func (rs *Reservations) peak(d Duration) uint {
+	var overlapping []*reservation
+	for _, r := range rs.reservations {
+		if r.Status == ReservationBooked && r.Start.Before(d.End) && r.End.After(d.Start) {
+			overlapping = append(overlapping, r)
+		}
+	}
+
+	starts := []time.Time{d.Start}
+	for _, r := range overlapping {
+		if r.Start.After(d.Start) {
+			starts = append(starts, r.Start)
+		}
+	}
+
+	var peak uint
+	for _, at := range starts {
+		var count uint
+		for _, r := range overlapping {
+			if !r.Start.After(at) && r.End.After(at) {
+				count++
+			}
+		}
+		if count > peak {
+			peak = count
+		}
+	}
+	return peak
+}
+
+// CheckIn records that the vehicle of the booked reservation with an ID arrived at a time, before the
+// end of the reservation, with the ticket of its session, and returns the reservation.
+func (rs *Reservations) CheckIn(id string, ticket string, at time.Time) (Reservation, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	r, ok := rs.reservations[id]
+	if !ok {
+		return Reservation{}, newError(CodeReservationNotFound, "reservation", "no reservation with id '%s'", id)
+	} else if r.Status != ReservationBooked {
+		return Reservation{}, newError(CodeReservationConflict, "reservation", "reservation '%s' is already %s", id, r.Status)
+	} else if !at.Before(r.End) {
+		return Reservation{}, newError(CodeReservationConflict, "reservation", "reservation '%s' ended at %s", id, r.End.Format(time.RFC3339))
+	}
+
+	previous := r.Reservation
+	r.Status = ReservationCheckedIn
+	r.Ticket = ticket
+	if err := rs.save(r); err != nil {
+		r.Reservation = previous
+		return Reservation{}, err
+	}
+	return r.Reservation, nil
+}
+
+// undoCheckIn returns a reservation that was checked in to booked, for a session that could not be
+// opened.
+func (rs *Reservations) undoCheckIn(id string) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if r, ok := rs.reservations[id]; ok && r.Status == ReservationCheckedIn {
+		r.Status = ReservationBooked
+		r.Ticket = ""
+		rs.save(r)
+	}
+}
+
+// Cancel cancels the booked reservation with an ID at a time before its start, and returns it with
+// the amount refunded by the refund rules of the facility when it was booked.
+func (rs *Reservations) Cancel(id string, at time.Time) (Reservation, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	r, ok := rs.reservations[id]
+	if !ok {
+		return Reservation{}, newError(CodeReservationNotFound, "id", "no reservation with id '%s'", id)
+	} else if r.Status != ReservationBooked {
+		return Reservation{}, newError(CodeReservationConflict, "id", "reservation '%s' is already %s", id, r.Status)
+	} else if !at.Before(r.Start) {
+		return Reservation{}, newError(CodeReservationConflict, "id", "reservation '%s' started at %s and can no longer be cancelled", id, r.Start.Format(time.RFC3339))
+	}
+
+	previous := r.Reservation
+	amount := refund(r.Refunds, r.Quote.Total, uint64(r.Start.Sub(at).Minutes()))
+	r.Status = ReservationCancelled
+	r.Cancelled = &at
+	r.Refund = &amount
+	if err := rs.save(r); err != nil {
+		r.Reservation = previous
+		return Reservation{}, err
+	}
+	return r.Reservation, nil
+}
+
+// List returns the reservations with a status, or every reservation if the status is empty, in order
+// of their start.
+func (rs *Reservations) List(status string) []Reservation {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	reservations := []Reservation{}
+	for _, r := range rs.reservations {
+		if status == "" || r.Status == status {
+			reservations = append(reservations, r.Reservation)
+		}
+	}
+	sort.Slice(reservations, func(i, j int) bool {
+		if !reservations[i].Start.Equal(reservations[j].Start) {
+			return reservations[i].Start.Before(reservations[j].Start)
+		}
+		return reservations[i].ID < reservations[j].ID
+	})
+	return reservations
+}
+
+// ReservationStatusFromHTTPRequest returns the status in the optional "status" parameter of a
+// request, or an error if it is not a status of a reservation.
+func ReservationStatusFromHTTPRequest(r *http.Request) (string, error) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", ReservationBooked, ReservationCheckedIn, ReservationCancelled:
+		return status, nil
+	}
+	return "", newError(CodeInvalidParameter, "status", "invalid status '%s', must be \"%s\", \"%s\" or \"%s\"", status, ReservationBooked, ReservationCheckedIn, ReservationCancelled)
+}
+
+// ReservationList is the response for requests for reservations.
+type ReservationList struct {
+	Status       uint          `json:"status"`
+	Reservations []Reservation `json:"reservations" xml:"Reservation"`
+}
+
+// JSON implementation for WebFormatter interface.
+func (l ReservationList) JSON() ([]byte, error) {
+	return json.Marshal(l)
+}
+
+// XML implementation for WebFormatter interface.
+func (l ReservationList) XML() ([]byte, error) {
+	return xml.Marshal(l)
+}
+
+// StatusCode implementation for WebFormatter interface.
+func (l ReservationList) StatusCode() uint {
+	return l.Status
+}
+
+// ReservationsHandleFunc is the top-level handler for requests to the /api/reservations endpoint,
+// which lists and books reservations.
+func ReservationsHandleFunc(w http.ResponseWriter, r *http.Request) {
+	r, ok := InitializeResponse(&w, r) // Required before WriteResponse
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		status, err := ReservationStatusFromHTTPRequest(r)
+		if err != nil {
+			WriteError(http.StatusBadRequest, err, &w, r)
+			return
+		}
+		WriteResponse(ReservationList{Status: http.StatusOK, Reservations: currentReservations.List(status)}, &w, r)
+	case http.MethodPost:
+		BookHandleFunc(w, r)
+	default:
+		err := methodNotSupported(r.Method)
+		WriteError(http.StatusBadRequest, err, &w, r)
+	}
+}
+
+// BookHandleFunc books a reservation from the "start" to the "end" parameter of a Post request, for
+// the optional "vehicle" parameter, priced by the current rates. Discount codes in the optional "code"
+// parameter are applied to the price, and the applied code is redeemed. A price that an occupancy band
+// changed is recorded in the audit of the occupancy.
+//
+// Example:
+//
+//	curl -X POST "http://localhost:8080/api/reservations?start=2015-07-01T07:00:00Z&end=2015-07-01T12:00:00Z"
+func BookHandleFunc(w http.ResponseWriter, r *http.Request) {
+	duration, err := DurationFromHTTPRequest(r)
+	if err != nil {
+		WriteError(http.StatusBadRequest, err, &w, r)
+		return
+	}
+
+	options := QuoteOptions{Vehicle: VehicleFromHTTPRequest(r), Discounts: currentDiscounts, Codes: CodesFromHTTPRequest(r), Occupancy: currentOccupancy}
+	reservation, err := currentReservations.Book(duration, currentWeeklyRates, options, time.Now())
+	if err != nil {
+		status := uint(http.StatusBadRequest)
+		switch code, _ := ErrorCode(err, 0); code {
+		case CodeRateUnavailable:
+			status = http.StatusNotFound
+		case CodeCapacityExceeded:
+			status = http.StatusConflict
+		}
+		WriteError(status, fmt.Errorf("failed to book reservation: %w", err), &w, r)
+		return
+	}
+	currentOccupancy.record(duration, reservation.Quote)
+	WriteResponse(ReservationList{Status: http.StatusOK, Reservations: []Reservation{reservation}}, &w, r)
+}
+
+// CancelHandleFunc cancels the reservation of the "id" parameter of a Post request to the
+// /api/reservations/cancel endpoint, and returns it with its refund.
+//
+// Example:
+//
+//	curl -X POST "http://localhost:8080/api/reservations/cancel?id=R1"
+func CancelHandleFunc(w http.ResponseWriter, r *http.Request) {
+	r, ok := InitializeResponse(&w, r) // Required before WriteResponse
+	if !ok {
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		WriteError(http.StatusBadRequest, methodNotSupported(r.Method), &w, r)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		err := newError(CodeMissingParameter, "id", "the 'id' parameter is required to cancel a reservation")
+		WriteError(http.StatusBadRequest, err, &w, r)
+		return
+	}
+
+	reservation, err := currentReservations.Cancel(id, time.Now().UTC().Truncate(time.Second))
+	if err != nil {
+		status := uint(http.StatusBadRequest)
+		if code, _ := ErrorCode(err, 0); code == CodeReservationNotFound {
+			status = http.StatusNotFound
+		}
+		WriteError(status, fmt.Errorf("failed to cancel reservation: %w", err), &w, r)
+		return
+	}
+	WriteResponse(ReservationList{Status: http.StatusOK, Reservations: []Reservation{reservation}}, &w, r)
+}
@@ -0,0 +1,329 @@
+package api_test
+
+import (
+	"encoding/json"
+	"github.com/jtide/gopark/api"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var jsonReservationConfig = []byte(`{
+	"capacity": 2,
+	"refunds": [{"notice": 1440, "percent": 100}, {"notice": 60, "percent": 50}],
+	"rates": [{"days": "wed", "times": "0600-2200", "price": 1500}]
+}`)
+
+func newReservationRates(t *testing.T) *api.WeeklyRates {
+	rates := api.NewWeeklyRates()
+	assert.NoError(t, rates.Update(jsonReservationConfig))
+	return &rates
+}
+
+func book(t *testing.T, reservations *api.Reservations, rates *api.WeeklyRates, start string, end string) (api.Reservation, error) {
+	duration, err := api.ParseDuration(start, end)
+	assert.NoError(t, err)
+	return reservations.Book(duration, rates, api.QuoteOptions{Occupancy: &api.Occupancy{}}, parseTime(t, "2015-06-01T00:00:00Z"))
+}
+
+func TestReservationsBookUpToCapacity(t *testing.T) {
+	rates := newReservationRates(t)
+	reservations := api.NewReservations()
+
+	reservation, err := book(t, reservations, rates, "2015-07-01T08:00:00Z", "2015-07-01T10:00:00Z")
+	assert.NoError(t, err)
+	assert.Equal(t, "R1", reservation.ID)
+	assert.Equal(t, api.ReservationBooked, reservation.Status)
+	assert.Equal(t, uint(1500), reservation.Quote.Total)
+
+	_, err = book(t, reservations, rates, "2015-07-01T09:00:00Z", "2015-07-01T11:00:00Z")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		start string
+		end   string
+		code  string
+	}{
+		// Both spots are reserved from 0900 to 1000
+		{"2015-07-01T07:00:00Z", "2015-07-01T12:00:00Z", api.CodeCapacityExceeded},
+		{"2015-07-01T09:30:00Z", "2015-07-01T09:45:00Z", api.CodeCapacityExceeded},
+		// One spot is free before 0900 and from 1000
+		{"2015-07-01T07:00:00Z", "2015-07-01T09:00:00Z", ""},
+		{"2015-07-01T10:00:00Z", "2015-07-01T12:00:00Z", ""},
+		// No rate covers the stay
+		{"2015-07-02T07:00:00Z", "2015-07-02T09:00:00Z", api.CodeRateUnavailable},
+	}
+
+	for _, test := range tests {
+		_, err := book(t, reservations, rates, test.start, test.end)
+		if test.code == "" {
+			assert.NoError(t, err, test.start)
+			continue
+		}
+		code, _ := api.ErrorCode(err, 400)
+		assert.Equal(t, test.code, code, test.start)
+	}
+	assert.Len(t, reservations.List(api.ReservationBooked), 4)
+}
+
+func TestReservationsCancelWithRefund(t *testing.T) {
+	rates := newReservationRates(t)
+	reservations := api.NewReservations()
+
+	tests := []struct {
+		cancel string
+		refund uint
+	}{
+		{"2015-06-30T07:00:00Z", 1500},
+		{"2015-07-01T06:00:00Z", 750},
+		{"2015-07-01T07:30:00Z", 0},
+	}
+
+	for _, test := range tests {
+		reservation, err := book(t, reservations, rates, "2015-07-01T08:00:00Z", "2015-07-01T09:00:00Z")
+		assert.NoError(t, err)
+		reservation, err = reservations.Cancel(reservation.ID, parseTime(t, test.cancel))
+		assert.NoError(t, err)
+		assert.Equal(t, api.ReservationCancelled, reservation.Status)
+		assert.Equal(t, test.refund, *reservation.Refund, test.cancel)
+
+		_, err = reservations.Cancel(reservation.ID, parseTime(t, test.cancel))
+		code, _ := api.ErrorCode(err, 400)
+		assert.Equal(t, api.CodeReservationConflict, code)
+	}
+
+	reservation, err := book(t, reservations, rates, "2015-07-01T08:00:00Z", "2015-07-01T09:00:00Z")
+	assert.NoError(t, err)
+	_, err = reservations.Cancel(reservation.ID, parseTime(t, "2015-07-01T08:00:00Z"))
+	code, _ := api.ErrorCode(err, 400)
+	assert.Equal(t, api.CodeReservationConflict, code)
+	_, err = reservations.Cancel("NONE", parseTime(t, "2015-07-01T08:00:00Z"))
+	code, _ = api.ErrorCode(err, 400)
+	assert.Equal(t, api.CodeReservationNotFound, code)
+
+	assert.Len(t, reservations.List(api.ReservationCancelled), 3)
+}
+
+func TestWeeklyRates_UpdateWithInvalidReservationSettings(t *testing.T) {
+	tests := []struct {
+		config string
+		code   string
+		field  string
+	}{
+		{`{"capacity": -1, "rates": []}`, api.CodeInvalidCapacity, "capacity"},
+		{`{"refunds": [{"notice": 60, "percent": 150}], "rates": []}`, api.CodeInvalidRefund, "refunds"},
+		{`{"refunds": [{"notice": 60, "percent": 50}, {"notice": 60, "percent": 25}], "rates": []}`, api.CodeInvalidRefund, "refunds"},
+		{`{"refunds": [{"notice": -60, "percent": 50}], "rates": []}`, api.CodeInvalidRefund, "refunds"},
+	}
+
+	for _, test := range tests {
+		rates := api.NewWeeklyRates()
+		err := rates.Update([]byte(test.config))
+		code, field := api.ErrorCode(err, 400)
+		assert.Equal(t, test.code, code, test.config)
+		assert.Equal(t, test.field, field, test.config)
+	}
+}
+
+func TestReservationsHandleFunc(t *testing.T) {
+	err := api.ReplaceRates(jsonReservationConfig)
+	assert.NoError(t, err)
+	defer api.ReplaceRates(api.JSONDefaultRateConfig)
+
+	request := func(method string, target string) (int, api.ReservationList) {
+		r := httptest.NewRequest(method, target, strings.NewReader(""))
+		w := httptest.NewRecorder()
+		api.NewServeMux().ServeHTTP(w, r)
+		var list api.ReservationList
+		json.Unmarshal(w.Body.Bytes(), &list)
+		return w.Code, list
+	}
+
+	// A date far in the future, so that the reservations can be cancelled with a full refund.
+	target := "/api/reservations?start=2036-07-02T08:00:00Z&end=2036-07-02T10:00:00Z"
+	status, list := request(http.MethodPost, target)
+	assert.Equal(t, http.StatusOK, status)
+	id := list.Reservations[0].ID
+	status, _ = request(http.MethodPost, target)
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = request(http.MethodPost, target)
+	assert.Equal(t, http.StatusConflict, status)
+
+	status, list = request(http.MethodPost, "/api/reservations/cancel?id="+id)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, uint(1500), *list.Reservations[0].Refund)
+	status, _ = request(http.MethodPost, target)
+	assert.Equal(t, http.StatusOK, status)
+
+	// Checking in with a booked reservation opens a session for it, but not with a cancelled one.
+	status, _ = request(http.MethodPost, "/api/sessions?reservation="+id+"&start=2036-07-02T08:00:00Z")
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, list = request(http.MethodGet, "/api/reservations?status=booked")
+	assert.Equal(t, http.StatusOK, status)
+	for _, reservation := range list.Reservations {
+		if reservation.Start.Equal(parseTime(t, "2036-07-02T08:00:00Z")) {
+			id = reservation.ID
+		}
+	}
+	var sessions api.SessionList
+	r := httptest.NewRequest(http.MethodPost, "/api/sessions?reservation="+id+"&start=2036-07-02T07:55:00Z", strings.NewReader(""))
+	w := httptest.NewRecorder()
+	api.NewServeMux().ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &sessions))
+	ticket := sessions.Sessions[0].Ticket
+	status, list = request(http.MethodGet, "/api/reservations?status=checked_in")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Len(t, list.Reservations, 1)
+	assert.Equal(t, id, list.Reservations[0].ID)
+	assert.Equal(t, ticket, list.Reservations[0].Ticket)
+	status, _ = request(http.MethodPost, "/api/sessions?reservation=NONE")
+	assert.Equal(t, http.StatusNotFound, status)
+	status, _ = request(http.MethodPost, "/api/sessions/checkout?ticket="+ticket+"&end=2036-07-02T10:00:00Z")
+	assert.Equal(t, http.StatusOK, status)
+
+	status, _ = request(http.MethodPost, "/api/reservations/cancel")
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, _ = request(http.MethodGet, "/api/reservations?status=pending")
+	assert.Equal(t, http.StatusBadRequest, status)
+}
+
+func TestReservationsBookCountsOccupancy(t *testing.T) {
+	rates := api.NewWeeklyRates()
+	assert.NoError(t, rates.Update([]byte(`{"capacity": 1, "rates": []}`)))
+	assert.NoError(t, rates.Update([]byte(`{"rates": [{"days": "wed", "times": "0600-2200", "price": 1500}]}`)))
+	reservations := api.NewReservations()
+	occupancy := &api.Occupancy{}
+	occupancy.Set(1)
+	now := parseTime(t, "2015-07-01T07:00:00Z")
+
+	// The vehicle parked now takes the only spot of a stay later the same day, but not of a stay on a
+	// later day.
+	duration, err := api.ParseDuration("2015-07-01T08:00:00Z", "2015-07-01T10:00:00Z")
+	assert.NoError(t, err)
+	_, err = reservations.Book(duration, &rates, api.QuoteOptions{Occupancy: occupancy}, now)
+	code, _ := api.ErrorCode(err, 400)
+	assert.Equal(t, api.CodeCapacityExceeded, code)
+	duration, err = api.ParseDuration("2015-07-08T08:00:00Z", "2015-07-08T10:00:00Z")
+	assert.NoError(t, err)
+	_, err = reservations.Book(duration, &rates, api.QuoteOptions{Occupancy: occupancy}, now)
+	assert.NoError(t, err)
+}
+
+func TestReservationsBookInThePast(t *testing.T) {
+	reservations := api.NewReservations()
+	duration, err := api.ParseDuration("2015-07-01T08:00:00Z", "2015-07-01T10:00:00Z")
+	assert.NoError(t, err)
+
+	_, err = reservations.Book(duration, newReservationRates(t), api.QuoteOptions{}, parseTime(t, "2015-07-01T09:00:00Z"))
+	code, field := api.ErrorCode(err, 400)
+	assert.Equal(t, api.CodeInvalidStart, code)
+	assert.Equal(t, "start", field)
+	assert.Empty(t, reservations.List(""))
+}
+
+func TestReservationsCheckIn(t *testing.T) {
+	rates := newReservationRates(t)
+	reservations := api.NewReservations()
+	occupancy := &api.Occupancy{}
+	reservation, err := book(t, reservations, rates, "2015-07-01T08:00:00Z", "2015-07-01T10:00:00Z")
+	assert.NoError(t, err)
+
+	reservation, err = reservations.CheckIn(reservation.ID, "TICKET", parseTime(t, "2015-07-01T07:55:00Z"))
+	assert.NoError(t, err)
+	assert.Equal(t, api.ReservationCheckedIn, reservation.Status)
+	assert.Equal(t, "TICKET", reservation.Ticket)
+	occupancy.Set(1)
+
+	// The checked in vehicle is counted by the occupancy only, which leaves the second spot free.
+	duration, err := api.ParseDuration("2015-07-01T08:00:00Z", "2015-07-01T10:00:00Z")
+	assert.NoError(t, err)
+	_, err = reservations.Book(duration, rates, api.QuoteOptions{Occupancy: occupancy}, parseTime(t, "2015-07-01T07:55:00Z"))
+	assert.NoError(t, err)
+
+	tests := []struct {
+		id   string
+		at   string
+		code string
+	}{
+		{"R1", "2015-07-01T08:00:00Z", api.CodeReservationConflict},
+		{"R2", "2015-07-01T10:00:00Z", api.CodeReservationConflict},
+		{"R3", "2015-07-01T08:00:00Z", api.CodeReservationNotFound},
+	}
+	for _, test := range tests {
+		_, err = reservations.CheckIn(test.id, "OTHER", parseTime(t, test.at))
+		code, _ := api.ErrorCode(err, 400)
+		assert.Equal(t, test.code, code, test.id)
+	}
+}
+
+func TestReservationsPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reservations.jsonl")
+	rates := newReservationRates(t)
+
+	reservations, err := api.OpenReservations(path, 0)
+	assert.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		_, err = book(t, reservations, rates, "2015-07-01T08:00:00Z", "2015-07-01T09:00:00Z")
+		assert.NoError(t, err)
+	}
+
+	// A restart keeps the reservations and the refund rules at booking, even after the rates change.
+	reservations, err = api.OpenReservations(path, 0)
+	assert.NoError(t, err)
+	assert.Len(t, reservations.List(api.ReservationBooked), 2)
+	_, err = book(t, reservations, rates, "2015-07-01T08:30:00Z", "2015-07-01T09:30:00Z")
+	code, _ := api.ErrorCode(err, 400)
+	assert.Equal(t, api.CodeCapacityExceeded, code)
+	reservation, err := reservations.Cancel("R1", parseTime(t, "2015-06-30T07:00:00Z"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1500), *reservation.Refund)
+
+	// Reservations that ended before the retention are removed, and their IDs are not used again.
+	reservations, err = api.OpenReservations(path, 24*time.Hour)
+	assert.NoError(t, err)
+	assert.Empty(t, reservations.List(""))
+	reservations, err = api.OpenReservations(path, 0)
+	assert.NoError(t, err)
+	reservation, err = book(t, reservations, rates, "2015-07-01T08:00:00Z", "2015-07-01T09:00:00Z")
+	assert.NoError(t, err)
+	assert.Equal(t, "R3", reservation.ID)
+}
+
+func TestReservationsBookWithOccupancy(t *testing.T) {
+	rates := api.NewWeeklyRates()
+	assert.NoError(t, rates.Update(jsonOccupancyBandConfig))
+	reservations := api.NewReservations()
+	occupancy := &api.Occupancy{}
+	occupancy.Set(6)
+	duration, err := api.ParseDuration("2015-07-01T08:00:00Z", "2015-07-01T10:00:00Z")
+	assert.NoError(t, err)
+
+	// The stay is priced at the occupancy when it is booked.
+	reservation, err := reservations.Book(duration, &rates, api.QuoteOptions{Occupancy: occupancy}, parseTime(t, "2015-06-01T09:00:00Z"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1650), reservation.Quote.Total)
+}
+
+func TestReservationsBookRedeemsCode(t *testing.T) {
+	rates := newReservationRates(t)
+	reservations := api.NewReservations()
+	discounts := newDiscounts(t)
+	duration, err := api.ParseDuration("2015-07-01T08:00:00Z", "2015-07-01T10:00:00Z")
+	assert.NoError(t, err)
+
+	// The validity of a code is checked against the start of the stay, not the time it is booked.
+	options := api.QuoteOptions{Discounts: discounts, Codes: []string{"EVENT"}, Occupancy: &api.Occupancy{}}
+	reservation, err := reservations.Book(duration, rates, options, parseTime(t, "2015-06-01T00:00:00Z"))
+	assert.NoError(t, err)
+	assert.True(t, reservation.Quote.Discounts[0].Applied)
+	for _, discount := range discounts.List() {
+		if discount.Code == "EVENT" {
+			assert.Equal(t, uint(1), discount.Uses)
+		}
+	}
+}
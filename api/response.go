@@ -1,23 +1,38 @@
 package api
 
 import (
+	"bytes"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
+	"fmt"
 	"net/http"
 	"strings"
 )
 
-// WebFormatter implementors can produce either XML or JSON representations themselves.
+// WebFormatter implementors can produce either XML or JSON representations themselves. Responses
+// can be written in other media types by implementing further interfaces, such as CSVFormatter,
+// TextFormatter and HTMLFormatter, or by registering an encoding with RegisterEncoding.
 type WebFormatter interface {
 	JSON() ([]byte, error)
 	XML() ([]byte, error)
 	StatusCode() uint
 }
 
-// APIStandardResponse provides a vehicle for generic success/error responses
+// CSVFormatter is implemented by WebFormatters that can also produce a CSV representation.
+type CSVFormatter interface {
+	CSV() ([]byte, error)
+}
+
+// APIStandardResponse provides a vehicle for generic success/error responses. Error responses
+// also include a stable Code, the request Field that caused the error, if any, and a Link to the
+// documentation of the code. See WriteError.
 type APIStandardResponse struct {
 	Status      uint   `json:"status"`
 	Description string `json:"desc"`
+	Code        string `json:"code,omitempty"`
+	Field       string `json:"field,omitempty"`
+	Link        string `json:"link,omitempty"`
 }
 
 // JSON implementation for WebFormatter interface.
@@ -35,53 +50,90 @@ func (e APIStandardResponse) StatusCode() uint {
 	return e.Status
 }
 
-func respondWithJSON(f WebFormatter, w *http.ResponseWriter) error {
-	response, err := f.JSON()
-	if err != nil {
-		return err
+// Text implementation for TextFormatter interface.
+func (e APIStandardResponse) Text() ([]byte, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%d %v: %v\n", e.Status, http.StatusText(int(e.Status)), e.Description)
+	if e.Code != "" {
+		fmt.Fprintf(&b, "Code:  %v\n", e.Code)
 	}
-	(*w).Header().Add("Content-Type", "application/json; charset-utf-8")
-	(*w).Write(response)
-	return nil
+	if e.Field != "" {
+		fmt.Fprintf(&b, "Field: %v\n", e.Field)
+	}
+	if e.Link != "" {
+		fmt.Fprintf(&b, "See:   %v\n", e.Link)
+	}
+	return b.Bytes(), nil
+}
+
+// HTML implementation for HTMLFormatter interface.
+func (e APIStandardResponse) HTML() ([]byte, error) {
+	return page{
+		Title:   fmt.Sprintf("%d %v", e.Status, http.StatusText(int(e.Status))),
+		Message: e.Description,
+		Code:    e.Code,
+		Link:    e.Link,
+	}.render()
 }
 
-func respondWithXML(f WebFormatter, w *http.ResponseWriter) error {
-	response, err := f.XML()
+// WriteResponse is responsible for writing the response payload in the media type negotiated by
+// InitializeResponse, such as JSON, XML or CSV. If not otherwise specified, JSON is used by default. If the
+// response has no representation in that media type, such as CSV for a WebFormatter that is not also a
+// CSVFormatter, the next preference of the client is used instead, and JSON if there is none. The problem
+// types are only used for a Problem, and JSON or XML respectively for all others.
+func WriteResponse(f WebFormatter, w *http.ResponseWriter, r *http.Request) error {
+	mediaType, response, err := encodeResponse(f, r)
 	if err != nil {
+		(*w).WriteHeader(http.StatusInternalServerError)
 		return err
 	}
-	(*w).Header().Add("Content-Type", "application/xml; charset-utf-8")
+
+	(*w).Header().Set("Content-Type", mediaType+"; charset-utf-8")
+	(*w).WriteHeader(int(f.StatusCode()))
 	(*w).Write(response)
 	return nil
 }
 
-// WriteResponse is responsible for writing the response payload in either XML or JSON format, based on
-// the response Content-Type HTTP header. If not otherwise specified, JSON is used by default.
-func WriteResponse(f WebFormatter, w *http.ResponseWriter) error {
-	(*w).WriteHeader(int(f.StatusCode()))
+// encodeResponse returns the first media type, and the representation in it, that the response has
+// out of the negotiated media type and the preferences of the client. The media type of the structured
+// syntax suffix of each is tried after it, so that "application/problem+xml" falls back to "application/xml".
+func encodeResponse(f WebFormatter, r *http.Request) (string, []byte, error) {
+	candidates := append([]string{ResponseMediaType(r)}, preferences(r.Header.Get("Accept"), MediaTypes())...)
+	candidates = append(candidates, MediaTypeJSON)
 
-	encoding := (*w).Header().Get("Content-Type")
-	switch {
-	case strings.Contains(encoding, "json"):
-		return respondWithJSON(f, w)
-	case strings.Contains(encoding, "xml"):
-		return respondWithXML(f, w)
-	default:
-		return respondWithJSON(f, w)
+	for _, candidate := range candidates {
+		for _, mediaType := range []string{candidate, suffixMediaType(candidate)} {
+			if mediaType == "" {
+				continue
+			}
+			response, err := Encode(mediaType, f)
+			if errors.Is(err, ErrNoEncoding) {
+				continue
+			}
+			return mediaType, response, err
+		}
 	}
+	return "", nil, ErrNoEncoding
 }
 
-// InitializeResponse sets the format of the response based on the "Accept" headers of the HTTP request.
-// InitializeResponse must be called before WriteResponse in order to ensure proper format of the response.
-// The format will be either JSON or XML.  If the client accepts either, then JSON is preferred.
-func InitializeResponse(w *http.ResponseWriter, r *http.Request) {
-	encoding := r.Header.Get("Accept")
-	switch {
-	case strings.Contains(encoding, "json"):
-		(*w).Header().Add("Content-Type", "application/json; charset-utf-8")
-	case strings.Contains(encoding, "xml"):
-		(*w).Header().Add("Content-Type", "application/xml; charset-utf-8")
-	default:
-		(*w).Header().Add("Content-Type", "application/json; charset-utf-8")
+// InitializeResponse negotiates the format of the response from the "Accept" header of the HTTP request,
+// and returns a copy of the request with the chosen media type in its context. InitializeResponse must be
+// called before WriteResponse, and the request it returns passed to WriteResponse, in order to ensure proper
+// format of the response. The format will be any registered encoding, such as JSON, XML, CSV, YAML, plain
+// text or HTML, honouring quality values and wildcards.
+// If the client accepts more than one equally, then JSON is preferred. Clients that accept
+// "application/problem+json" or "application/problem+xml" get errors in that format, and all other responses
+// in JSON or XML respectively. If the client accepts none of these, a 406 Not Acceptable error is written
+// in JSON, and false is returned.
+func InitializeResponse(w *http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	(*w).Header().Add("Vary", "Accept")
+
+	accept := r.Header.Get("Accept")
+	mediaType, ok := Negotiate(accept, MediaTypes())
+	if !ok {
+		err := newError(CodeNotAcceptable, "", "none of the media types in \"Accept:%v\" are supported, %v are available", accept, strings.Join(MediaTypes(), ", "))
+		WriteError(http.StatusNotAcceptable, err, w, r)
+		return r, false
 	}
+	return withResponseMediaType(r, mediaType), true
 }
@@ -0,0 +1,297 @@
+package api
+
+import (
+	"net/http"
+)
+
+// endpoint is a path of the API, its handler, and a description of each method the handler
+// supports. The descriptions are used to generate the OpenAPI document, so that the document
+// cannot list an endpoint that is not served.
+type endpoint struct {
+	Path       string
+	Handler    http.HandlerFunc
+	Operations []operation
+}
+
+// operation describes a single method of an endpoint. The request body and responses are given
+// as values of the Go types that are decoded or encoded, and their schemas are generated from
+// those types.
+type operation struct {
+	Method      string
+	Summary     string
+	Parameters  []parameter
+	RequestBody interface{}
+	RequestText []string
+	Responses   map[int]interface{}
+}
+
+// parameter is a query parameter of an operation.
+type parameter struct {
+	Name        string
+	Description string
+	Required    bool
+	Schema      map[string]interface{}
+}
+
+var (
+	timeParameterSchema   = map[string]interface{}{"type": "string", "format": "date-time"}
+	stringParameterSchema = map[string]interface{}{"type": "string"}
+	boolParameterSchema   = map[string]interface{}{"type": "boolean"}
+	minimumParameter      = parameter{"minimum", "Minimum percentage of the week that must be covered by rates.", false,
+		map[string]interface{}{"type": "number", "minimum": 0, "maximum": 100}}
+)
+
+// endpoints lists every endpoint of the API.
+func endpoints() []endpoint {
+	return []endpoint{
+		{"/api/rate", RateHandleFunc, []operation{
+			{
+				Method:  http.MethodGet,
+				Summary: "Price a stay from start to end.",
+				Parameters: []parameter{
+					{"start", "Start of the stay in RFC3339 format.", true, timeParameterSchema},
+					{"end", "End of the stay in RFC3339 format.", true, timeParameterSchema},
+					{"detail", "Include an itemized breakdown of the price.", false, boolParameterSchema},
+					{"vehicle", "Class of vehicle to price, such as \"motorcycle\". The default class of the rates if not set.", false, stringParameterSchema},
+					{"code", "Discount codes to apply, separated by commas.", false, stringParameterSchema},
+				},
+				Responses: map[int]interface{}{200: Rate{}, 404: UnknownRate{}, 409: UnknownRate{}, 400: APIStandardResponse{}},
+			},
+			{
+				Method:      http.MethodPut,
+				Summary:     "Replace all rates.",
+				RequestBody: ConfigRates{},
+				RequestText: []string{"text/csv"},
+				Responses:   map[int]interface{}{200: APIStandardResponse{}, 400: APIStandardResponse{}},
+			},
+			{
+				Method:      http.MethodPost,
+				Summary:     "Add rates that do not conflict with existing rates.",
+				RequestBody: ConfigRates{},
+				RequestText: []string{"text/csv"},
+				Responses:   map[int]interface{}{200: APIStandardResponse{}, 400: APIStandardResponse{}},
+			},
+			{
+				Method:  http.MethodDelete,
+				Summary: "Remove the rates for a time range on a list of days.",
+				Parameters: []parameter{
+					{"days", "Days of the rates, such as \"mon,tues\".", true, stringParameterSchema},
+					{"times", "Time range of the rates, such as \"0900-2100\".", true, stringParameterSchema},
+				},
+				Responses: map[int]interface{}{200: APIStandardResponse{}, 400: APIStandardResponse{}},
+			},
+		}},
+		{"/api/rate/batch", BatchHandleFunc, []operation{
+			{
+				Method:      http.MethodPost,
+				Summary:     "Price many stays against the same rates.",
+				RequestBody: []Interval{},
+				RequestText: []string{"application/x-ndjson", "text/csv"},
+				Responses:   map[int]interface{}{200: BatchQuote{}, 400: APIStandardResponse{}},
+			},
+		}},
+		{"/api/rates", RatesHandleFunc, []operation{
+			{
+				Method:    http.MethodGet,
+				Summary:   "Export the current rates.",
+				Responses: map[int]interface{}{200: Schedule{}, 400: APIStandardResponse{}},
+			},
+		}},
+		{"/api/rates/coverage", CoverageHandleFunc, []operation{
+			{
+				Method:     http.MethodGet,
+				Summary:    "Report the windows of the week without a rate.",
+				Parameters: []parameter{minimumParameter},
+				Responses:  map[int]interface{}{200: Coverage{}, 422: Coverage{}, 400: APIStandardResponse{}},
+			},
+		}},
+		{"/api/rates/validate", ValidateHandleFunc, []operation{
+			{
+				Method:      http.MethodPost,
+				Summary:     "Check rates without applying them.",
+				Parameters:  []parameter{minimumParameter},
+				RequestBody: ConfigRates{},
+				RequestText: []string{"text/csv"},
+				Responses:   map[int]interface{}{200: APIStandardResponse{}, 422: APIStandardResponse{}, 400: APIStandardResponse{}},
+			},
+		}},
+		{"/api/discounts", DiscountsHandleFunc, []operation{
+			{
+				Method:    http.MethodGet,
+				Summary:   "List the discount codes and their uses.",
+				Responses: map[int]interface{}{200: DiscountList{}, 400: APIStandardResponse{}},
+			},
+			{
+				Method:      http.MethodPut,
+				Summary:     "Replace all discount codes.",
+				RequestBody: ConfigDiscounts{},
+				Responses:   map[int]interface{}{200: APIStandardResponse{}, 400: APIStandardResponse{}},
+			},
+			{
+				Method:      http.MethodPost,
+				Summary:     "Add discount codes.",
+				RequestBody: ConfigDiscounts{},
+				Responses:   map[int]interface{}{200: APIStandardResponse{}, 400: APIStandardResponse{}},
+			},
+		}},
+		{"/api/discounts/redeem", RedeemHandleFunc, []operation{
+			{
+				Method:  http.MethodPost,
+				Summary: "Record a use of a discount code.",
+				Parameters: []parameter{
+					{"code", "The discount code to redeem.", true, stringParameterSchema},
+				},
+				Responses: map[int]interface{}{200: DiscountList{}, 400: APIStandardResponse{}},
+			},
+		}},
+		{"/api/sessions", SessionsHandleFunc, []operation{
+			{
+				Method:  http.MethodGet,
+				Summary: "List the parking sessions, or look up the session of a ticket.",
+				Parameters: []parameter{
+					{"status", "Status of the sessions to list: \"open\", \"closed\" or \"unpriced\". Every session if not set.", false, stringParameterSchema},
+					{"ticket", "Ticket of the session to look up.", false, stringParameterSchema},
+				},
+				Responses: map[int]interface{}{200: SessionList{}, 404: APIStandardResponse{}, 400: APIStandardResponse{}},
+			},
+			{
+				Method:  http.MethodPost,
+				Summary: "Check a vehicle in, opening a session priced by the current rates.",
+				Parameters: []parameter{
+					{"ticket", "Ticket of the session. A new ticket if not set.", false, stringParameterSchema},
+					{"vehicle", "Class of vehicle. The default class of the rates if not set.", false, stringParameterSchema},
+					{"start", "Time of entry in RFC3339 format. The current time if not set.", false, timeParameterSchema},
+					{"reservation", "ID of the reservation of the vehicle, which is checked in with the session.", false, stringParameterSchema},
+				},
+				Responses: map[int]interface{}{200: SessionList{}, 404: APIStandardResponse{}, 400: APIStandardResponse{}},
+			},
+		}},
+		{"/api/sessions/checkout", CheckOutHandleFunc, []operation{
+			{
+				Method:  http.MethodPost,
+				Summary: "Check a vehicle out, closing its session with the final charge.",
+				Parameters: []parameter{
+					{"ticket", "Ticket of the session.", true, stringParameterSchema},
+					{"end", "Time of exit in RFC3339 format. The current time if not set.", false, timeParameterSchema},
+				},
+				Responses: map[int]interface{}{200: SessionList{}, 404: APIStandardResponse{}, 400: APIStandardResponse{}},
+			},
+		}},
+		{"/api/reservations", ReservationsHandleFunc, []operation{
+			{
+				Method:  http.MethodGet,
+				Summary: "List the reservations.",
+				Parameters: []parameter{
+					{"status", "Status of the reservations to list: \"booked\", \"checked_in\" or \"cancelled\". Every reservation if not set.", false, stringParameterSchema},
+				},
+				Responses: map[int]interface{}{200: ReservationList{}, 400: APIStandardResponse{}},
+			},
+			{
+				Method:  http.MethodPost,
+				Summary: "Book a reservation from start to end, if the facility has a spot free.",
+				Parameters: []parameter{
+					{"start", "Start of the stay in RFC3339 format.", true, timeParameterSchema},
+					{"end", "End of the stay in RFC3339 format.", true, timeParameterSchema},
+					{"vehicle", "Class of vehicle. The default class of the rates if not set.", false, stringParameterSchema},
+				},
+				Responses: map[int]interface{}{200: ReservationList{}, 404: APIStandardResponse{}, 409: APIStandardResponse{}, 400: APIStandardResponse{}},
+			},
+		}},
+		{"/api/reservations/cancel", CancelHandleFunc, []operation{
+			{
+				Method:  http.MethodPost,
+				Summary: "Cancel a reservation, refunding it by the refund rules of the facility.",
+				Parameters: []parameter{
+					{"id", "ID of the reservation.", true, stringParameterSchema},
+				},
+				Responses: map[int]interface{}{200: ReservationList{}, 404: APIStandardResponse{}, 400: APIStandardResponse{}},
+			},
+		}},
+		{"/api/occupancy", OccupancyHandleFunc, []operation{
+			{
+				Method:    http.MethodGet,
+				Summary:   "Get the number of vehicles in the facility and the spots free.",
+				Responses: map[int]interface{}{200: OccupancyStatus{}, 400: APIStandardResponse{}},
+			},
+			{
+				Method:  http.MethodPost,
+				Summary: "Record a vehicle entering or leaving the facility.",
+				Parameters: []parameter{
+					{"event", "The event to record: \"entry\" or \"exit\".", true, stringParameterSchema},
+				},
+				Responses: map[int]interface{}{200: OccupancyStatus{}, 400: APIStandardResponse{}},
+			},
+		}},
+		{"/api/occupancy/audit", OccupancyAuditHandleFunc, []operation{
+			{
+				Method:    http.MethodGet,
+				Summary:   "List the quotes that occupancy bands changed, most recent first.",
+				Responses: map[int]interface{}{200: OccupancyAuditList{}, 400: APIStandardResponse{}},
+			},
+		}},
+		{"/api/webhooks", WebhooksHandleFunc, []operation{
+			{
+				Method:    http.MethodGet,
+				Summary:   "List the webhooks that are sent rate changes.",
+				Responses: map[int]interface{}{200: WebhookList{}, 400: APIStandardResponse{}},
+			},
+			{
+				Method:      http.MethodPost,
+				Summary:     "Register a webhook to send a signed payload to whenever the rates change.",
+				RequestBody: Webhook{},
+				Responses:   map[int]interface{}{200: WebhookList{}, 400: APIStandardResponse{}},
+			},
+			{
+				Method:  http.MethodDelete,
+				Summary: "Remove a webhook.",
+				Parameters: []parameter{
+					{"id", "ID of the webhook.", true, stringParameterSchema},
+				},
+				Responses: map[int]interface{}{200: APIStandardResponse{}, 404: APIStandardResponse{}, 400: APIStandardResponse{}},
+			},
+		}},
+		{"/api/webhooks/deliveries", DeliveriesHandleFunc, []operation{
+			{
+				Method:  http.MethodGet,
+				Summary: "List the deliveries of rate changes to webhooks, most recent first.",
+				Parameters: []parameter{
+					{"webhook", "ID of the webhook. Deliveries to every webhook if not set.", false, stringParameterSchema},
+				},
+				Responses: map[int]interface{}{200: DeliveryList{}, 400: APIStandardResponse{}},
+			},
+		}},
+		{"/api/graphql", GraphQLHandleFunc, []operation{
+			{
+				Method:  http.MethodGet,
+				Summary: "Run a GraphQL query for the rates, quotes and facility.",
+				Parameters: []parameter{
+					{"query", "The GraphQL query.", true, stringParameterSchema},
+					{"variables", "The values of the variables of the query, in JSON format.", false, stringParameterSchema},
+					{"operationName", "The operation to run, if the query has more than one.", false, stringParameterSchema},
+				},
+				Responses: map[int]interface{}{200: GraphQLResult{}, 400: APIStandardResponse{}},
+			},
+			{
+				Method:      http.MethodPost,
+				Summary:     "Run a GraphQL query, or a mutation of the rates.",
+				RequestBody: GraphQLRequest{},
+				Responses:   map[int]interface{}{200: GraphQLResult{}, 400: APIStandardResponse{}},
+			},
+		}},
+		{OpenAPIPath, OpenAPIHandleFunc, []operation{
+			{
+				Method:  http.MethodGet,
+				Summary: "Describe the API as an OpenAPI 3 document.",
+			},
+		}},
+	}
+}
+
+// NewServeMux returns a ServeMux with the handlers for every endpoint of the API registered.
+func NewServeMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	for _, e := range endpoints() {
+		mux.HandleFunc(e.Path, e.Handler)
+	}
+	return mux
+}
@@ -0,0 +1,202 @@
+package api
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Schedule is the response for an export of the current rate configuration. The rates
+// use the same format as ConfigRates, so that an export can be used to replace rates later.
+type Schedule struct {
+	Status         uint          `json:"status"`
+	Currency       string        `json:"currency"`
+	DefaultVehicle string        `json:"default_vehicle,omitempty" xml:",omitempty"`
+	Charges        []Charge      `json:"charges,omitempty" xml:"Charge"`
+	Specials       []SpecialRate `json:"specials,omitempty" xml:"Special"`
+	Grace          *Grace        `json:"grace,omitempty"`
+	Capacity       uint          `json:"capacity,omitempty" xml:",omitempty"`
+	Refunds        []RefundRule  `json:"refunds,omitempty" xml:"Refund"`
+	Rates          []ConfigRate  `json:"rates"`
+}
+
+// JSON implementation for WebFormatter interface.
+func (s Schedule) JSON() ([]byte, error) {
+	return json.Marshal(s)
+}
+
+// XML implementation for WebFormatter interface.
+func (s Schedule) XML() ([]byte, error) {
+	return xml.Marshal(s)
+}
+
+// CSV implementation for CSVFormatter interface. A schedule with charges, vehicle classes, special
+// rates, grace periods, reservation settings or occupancy bands has no CSV representation.
+func (s Schedule) CSV() ([]byte, error) {
+	return s.Config().CSV()
+}
+
+// Config returns the schedule as a configuration.
+func (s Schedule) Config() ConfigRates {
+	return ConfigRates{
+		Currency:       s.Currency,
+		DefaultVehicle: s.DefaultVehicle,
+		Charges:        s.Charges,
+		Specials:       s.Specials,
+		Grace:          s.Grace,
+		Capacity:       s.Capacity,
+		Refunds:        s.Refunds,
+		Rates:          s.Rates,
+	}
+}
+
+// StatusCode implementation for WebFormatter interface.
+func (s Schedule) StatusCode() uint {
+	return s.Status
+}
+
+// Config returns the weekly rates as a configuration. Rates with the same time range, prices, ladder,
+// charges, grace and occupancy bands are combined into a single ConfigRate for all of their days, ordered from Monday to Sunday.
+// The default vehicle class is only included if the configuration declared one.
+func (weekRates *WeeklyRates) Config() ConfigRates {
+	type window struct {
+		start    uint64
+		end      uint64
+		price    Money
+		vehicles string
+		ladder   string
+		charges  string
+		grace    string
+		bands    string
+	}
+
+	var order []window
+	days := make(map[window][]string)
+	rules := make(map[window]HourlyRate)
+
+	for _, weekday := range Weekdays {
+		dayRates := weekRates.Days[weekday]
+		for _, key := range dayRates.Keys() {
+			rate := dayRates[key]
+			w := window{rate.StartMinute, rate.EndMinute, rate.Price, fmt.Sprint(rate.Vehicles), fmt.Sprint(rate.Ladder), fmt.Sprint(rate.Charges), fmt.Sprint(rate.Grace), fmt.Sprint(rate.Occupancy)}
+			if _, ok := days[w]; !ok {
+				order = append(order, w)
+				rules[w] = rate
+			}
+			days[w] = append(days[w], StringFromWeekday(weekday))
+		}
+	}
+
+	facility := weekRates.Facility
+	config := ConfigRates{
+		Currency:       weekRates.Currency(),
+		DefaultVehicle: facility.DefaultVehicle,
+		Charges:        facility.Charges,
+		Specials:       facility.Specials,
+		Grace:          facility.Grace,
+		Capacity:       facility.Capacity,
+		Refunds:        facility.Refunds,
+		Rates:          []ConfigRate{},
+	}
+	for _, w := range order {
+		config.Rates = append(config.Rates, ConfigRate{
+			Days:      strings.Join(days[w], ","),
+			Times:     TimeRangeToConfigString(w.start, w.end),
+			Price:     w.price.Amount,
+			Vehicles:  rules[w].Vehicles,
+			Ladder:    rules[w].Ladder,
+			Charges:   rules[w].Charges,
+			Grace:     rules[w].Grace,
+			Occupancy: rules[w].Occupancy,
+		})
+	}
+	return config
+}
+
+// RatesHandleFunc is the top-level handler for requests to the /api/rates endpoint, which
+// exports the current rate configuration.
+func RatesHandleFunc(w http.ResponseWriter, r *http.Request) {
+	r, ok := InitializeResponse(&w, r) // Required before WriteResponse
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		RatesGetHandleFunc(w, r)
+	default:
+		err := methodNotSupported(r.Method)
+		WriteError(http.StatusBadRequest, err, &w, r)
+	}
+}
+
+// RatesGetHandleFunc returns the current rate configuration in JSON, XML or CSV format.
+//
+// Example:
+//
+//	curl -H "Accept: text/csv" "http://localhost:8080/api/rates"
+func RatesGetHandleFunc(w http.ResponseWriter, r *http.Request) {
+	config := currentWeeklyRates.Config()
+	WriteResponse(Schedule{
+		Status:         http.StatusOK,
+		Currency:       config.Currency,
+		DefaultVehicle: config.DefaultVehicle,
+		Charges:        config.Charges,
+		Specials:       config.Specials,
+		Grace:          config.Grace,
+		Capacity:       config.Capacity,
+		Refunds:        config.Refunds,
+		Rates:          config.Rates,
+	}, &w, r)
+}
+
+// ValidateHandleFunc is the top-level handler for requests to the /api/rates/validate endpoint,
+// which checks a rate configuration without applying it.
+func ValidateHandleFunc(w http.ResponseWriter, r *http.Request) {
+	r, ok := InitializeResponse(&w, r) // Required before WriteResponse
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		ValidatePostHandleFunc(w, r)
+	default:
+		err := methodNotSupported(r.Method)
+		WriteError(http.StatusBadRequest, err, &w, r)
+	}
+}
+
+// ValidatePostHandleFunc checks that the rate configuration in the Post body could replace the
+// current rates, in the same formats accepted by RatePutHandleFunc. If the optional "minimum"
+// parameter is given, a 422 status is returned when the rates cover less of the week.
+//
+// Example:
+//
+//	curl -X POST -H "Content-Type: application/json" -d @examples/sample-rates.json "http://localhost:8080/api/rates/validate?minimum=50"
+func ValidatePostHandleFunc(w http.ResponseWriter, r *http.Request) {
+	minimum, err := MinimumFromHTTPRequest(r)
+	if err != nil {
+		WriteError(http.StatusBadRequest, err, &w, r)
+		return
+	}
+
+	config, err := ConfigFromRequestBody(r)
+	if err != nil {
+		WriteError(http.StatusBadRequest, err, &w, r)
+		return
+	}
+
+	rates := NewWeeklyRates()
+	if err = rates.UpdateWithConfig(config); err != nil {
+		WriteError(http.StatusBadRequest, err, &w, r)
+		return
+	} else if err = rates.Coverage().Validate(minimum); err != nil {
+		WriteError(http.StatusUnprocessableEntity, err, &w, r)
+		return
+	}
+
+	WriteResponse(APIStandardResponse{Status: http.StatusOK, Description: "valid rates"}, &w, r)
+}
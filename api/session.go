@@ -0,0 +1,544 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Statuses of a Session.
+const (
+	SessionOpen     = "open"
+	SessionClosed   = "closed"
+	SessionUnpriced = "unpriced"
+)
+
+// Session is a stay of a vehicle in the facility, from check-in at Start to check-out at End. The
+// ticket identifies the session. A session is open until check-out, when it is closed with the Quote
+// of its final charge, priced by the rates that were in effect at check-in. A session that no rate
+// covers, such as one that ends on another day, is unpriced instead, and has the Reason it could not
+// be priced rather than a quote. Occupied is the number of vehicles that were in the facility at
+// check-in, which selects the occupancy band of the rates.
+type Session struct {
+	Ticket   string     `json:"ticket"`
+	Vehicle  string     `json:"vehicle"`
+	Status   string     `json:"status"`
+	Start    time.Time  `json:"start"`
+	End      *time.Time `json:"end,omitempty"`
+	Occupied uint       `json:"occupied,omitempty"`
+	Quote    *Quote     `json:"quote,omitempty"`
+	Reason   string     `json:"reason,omitempty"`
+}
+
+// sessionRecord is a session with the ID of the rates at its check-in, which is how a session is
+// saved, so that it is priced by the same rates after a restart.
+type sessionRecord struct {
+	Session
+	Rates string `json:"rates"`
+	rates *WeeklyRates
+}
+
+// sessionRates are the rates that sessions were checked in with. Each distinct configuration of the
+// rates is saved once, with an ID from its hash, and sessions refer to it by that ID.
+type sessionRates struct {
+	ID     string      `json:"id"`
+	Config ConfigRates `json:"config"`
+	rates  *WeeklyRates
+}
+
+// sessionEntry is an entry of the journal of a store of sessions, which is either rates or a session.
+// The last entry of a session is its current state.
+type sessionEntry struct {
+	Rates   *sessionRates  `json:"rates,omitempty"`
+	Session *sessionRecord `json:"session,omitempty"`
+}
+
+// Sessions is a store of parking sessions. Each change is appended to the journal at its path, if it
+// has one, and sessions are only kept in memory otherwise. Sessions that were closed longer ago than
+// the retention of the store are removed whenever the journal is compacted, unless the retention is
+// 0. It is safe for concurrent use.
+type Sessions struct {
+	mu        sync.Mutex
+	journal   journal
+	retention time.Duration
+	sessions  map[string]*sessionRecord
+	rates     map[string]*sessionRates
+}
+
+// currentSessions is the store of parking sessions used by the API.
+var currentSessions = NewSessions()
+
+// NewSessions returns an empty store of sessions, kept only in memory, that keeps closed sessions.
+func NewSessions() *Sessions {
+	return &Sessions{sessions: make(map[string]*sessionRecord), rates: make(map[string]*sessionRates)}
+}
+
+// OpenSessions returns a store of sessions saved to a journal at a path, with the sessions already in
+// the journal, which keeps closed sessions for a retention. The journal is compacted as it is opened, and
+// created if it does not exist. The store is only kept in memory if the path is empty.
+func OpenSessions(path string, retention time.Duration) (*Sessions, error) {
+	ss := NewSessions()
+	ss.journal.path = path
+	ss.retention = retention
+
+	err := ss.journal.replay(func(data []byte) error {
+		var entry sessionEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return err
+		}
+		if saved := entry.Rates; saved != nil {
+			rates := NewWeeklyRates()
+			if err := rates.UpdateWithConfig(saved.Config); err != nil {
+				return fmt.Errorf("failed to read rates %s: %w", saved.ID, err)
+			}
+			saved.rates = &rates
+			ss.rates[saved.ID] = saved
+		}
+		if record := entry.Session; record != nil {
+			saved, ok := ss.rates[record.Rates]
+			if !ok {
+				return fmt.Errorf("failed to read session %s: no rates %s", record.Ticket, record.Rates)
+			}
+			record.rates = saved.rates
+			ss.sessions[record.Ticket] = record
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sessions from %s: %w", path, err)
+	}
+
+	if err = ss.compact(time.Now()); err != nil {
+		return nil, err
+	}
+	return ss, nil
+}
+
+// LoadSessions replaces the sessions of the API with those saved to a journal, which keeps closed
+// sessions for a retention, and saves every later change to the journal. The occupancy of the facility
+// is the number of open sessions. See OpenSessions.
+func LoadSessions(path string, retention time.Duration) error {
+	ss, err := OpenSessions(path, retention)
+	if err != nil {
+		return err
+	}
+	currentSessions = ss
+	currentOccupancy.Set(uint(len(ss.List(SessionOpen))))
+	return nil
+}
+
+// save appends the entries of a change to the journal of the store, and compacts the store once the
+// journal is full. The change is saved even if compacting fails, which is tried again after the next
+// change.
+func (ss *Sessions) save(entries ...interface{}) error {
+	if err := ss.journal.append(entries...); err != nil {
+		return fmt.Errorf("failed to save sessions: %w", err)
+	}
+	if ss.journal.full() {
+		ss.compact(time.Now())
+	}
+	return nil
+}
+
+// compact removes the sessions that were closed longer ago than the retention of the store, and the
+// rates that no session refers to, and rewrites the journal with the rates and sessions that are left.
+func (ss *Sessions) compact(now time.Time) error {
+	if ss.retention > 0 {
+		before := now.Add(-ss.retention)
+		for ticket, record := range ss.sessions {
+			if record.Status != SessionOpen && record.End != nil && record.End.Before(before) {
+				delete(ss.sessions, ticket)
+			}
+		}
+	}
+
+	used := make(map[string]bool)
+	for _, record := range ss.sessions {
+		used[record.Rates] = true
+	}
+	var ids []string
+	for id := range ss.rates {
+		if used[id] {
+			ids = append(ids, id)
+		} else {
+			delete(ss.rates, id)
+		}
+	}
+	sort.Strings(ids)
+
+	var tickets []string
+	for ticket := range ss.sessions {
+		tickets = append(tickets, ticket)
+	}
+	sort.Strings(tickets)
+
+	entries := make([]interface{}, 0, len(ids)+len(tickets))
+	for _, id := range ids {
+		entries = append(entries, sessionEntry{Rates: ss.rates[id]})
+	}
+	for _, ticket := range tickets {
+		entries = append(entries, sessionEntry{Session: ss.sessions[ticket]})
+	}
+	if err := ss.journal.rewrite(entries); err != nil {
+		return fmt.Errorf("failed to save sessions: %w", err)
+	}
+	return nil
+}
+
+// ratesFor returns the saved rates with the configuration of the rates, and true if they are new to
+// the store. New rates are a copy, so that later changes to the rates do not change them.
+func (ss *Sessions) ratesFor(rates *WeeklyRates) (*sessionRates, bool, error) {
+	config := rates.Config()
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to save rates of session: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	id := hex.EncodeToString(sum[:8])
+	if saved, ok := ss.rates[id]; ok {
+		return saved, false, nil
+	}
+
+	snapshot := rates.DeepCopy()
+	return &sessionRates{ID: id, Config: config, rates: &snapshot}, true, nil
+}
+
+// newTicket returns a random ticket for a session.
+func newTicket() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to create ticket: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// CheckIn opens a session for a vehicle that enters at a time, to be priced by the rates at the
+// occupancy, if any, when it enters. A ticket is created for the session if it is empty, and the
+// vehicle is the default class of the rates if it is empty. It returns an error if a session already
+// has the ticket.
+func (ss *Sessions) CheckIn(ticket string, vehicle string, at time.Time, rates *WeeklyRates, occupancy *Occupancy) (Session, error) {
+	vehicle, err := rates.vehicleFor(vehicle)
+	if err != nil {
+		return Session{}, err
+	}
+	if ticket == "" {
+		if ticket, err = newTicket(); err != nil {
+			return Session{}, err
+		}
+	} else if strings.ContainsAny(ticket, ", \t\n") {
+		return Session{}, newError(CodeInvalidParameter, "ticket", "invalid ticket '%s', must not contain spaces or commas", ticket)
+	}
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if _, ok := ss.sessions[ticket]; ok {
+		return Session{}, newError(CodeSessionConflict, "ticket", "a session already exists for ticket '%s'", ticket)
+	}
+
+	// The session keeps a copy of the rates, so that changes to them do not change its price.
+	saved, isNew, err := ss.ratesFor(rates)
+	if err != nil {
+		return Session{}, err
+	}
+	var occupied uint
+	if occupancy != nil {
+		occupied = occupancy.Count()
+	}
+	record := &sessionRecord{
+		Session: Session{Ticket: ticket, Vehicle: vehicle, Status: SessionOpen, Start: at, Occupied: occupied},
+		Rates:   saved.ID,
+		rates:   saved.rates,
+	}
+	entries := []interface{}{sessionEntry{Session: record}}
+	if isNew {
+		entries = []interface{}{sessionEntry{Rates: saved}, entries[0]}
+		ss.rates[saved.ID] = saved
+	}
+	ss.sessions[ticket] = record
+	if err = ss.save(entries...); err != nil {
+		delete(ss.sessions, ticket)
+		if isNew {
+			delete(ss.rates, saved.ID)
+		}
+		return Session{}, err
+	}
+	return record.Session, nil
+}
+
+// CheckOut closes the open session of a ticket for a vehicle that leaves at a time, and returns it
+// with its final charge, priced by the rates and occupancy at check-in, and with the largest of the
+// discounts for the codes applied and redeemed. A session that cannot be priced, such as a stay
+// over midnight that no special rate covers, is returned unpriced, with the reason. It returns an
+// error if the applied code can no longer be redeemed.
+func (ss *Sessions) CheckOut(ticket string, at time.Time, discounts *Discounts, codes []string) (Session, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	record, ok := ss.sessions[ticket]
+	if !ok {
+		return Session{}, newError(CodeSessionNotFound, "ticket", "no session for ticket '%s'", ticket)
+	} else if record.Status != SessionOpen {
+		return Session{}, newError(CodeSessionConflict, "ticket", "the session for ticket '%s' is already %s", ticket, record.Status)
+	} else if at.Before(record.Start) {
+		return Session{}, newError(CodeEndBeforeStart, "end", "check-out at %s is before check-in at %s", at.Format(time.RFC3339), record.Start.Format(time.RFC3339))
+	}
+
+	previous := record.Session
+	record.End = &at
+	record.Status = SessionUnpriced
+	duration := Duration{Start: record.Start, End: at, Value: at.Sub(record.Start)}
+	occupancy := &Occupancy{}
+	occupancy.Set(record.Occupied)
+	options := QuoteOptions{Vehicle: record.Vehicle, Discounts: discounts, Codes: codes, Occupancy: occupancy}
+	if quote, err := record.rates.QuoteWithOptions(duration, options); err == nil {
+		if err = discounts.redeem(quote, duration); err != nil {
+			record.Session = previous
+			return Session{}, err
+		}
+		record.Status = SessionClosed
+		record.Quote = &quote
+	} else if record.Start.Year() != at.Year() || record.Start.YearDay() != at.YearDay() {
+		record.Reason = fmt.Sprintf("the stay ends on %s, a later day than it starts, and rates only price stays within a day", at.Format("2006-01-02"))
+	} else {
+		record.Reason = err.Error()
+	}
+
+	if err := ss.save(sessionEntry{Session: record}); err != nil {
+		record.Session = previous
+		return Session{}, err
+	}
+	return record.Session, nil
+}
+
+// List returns the sessions with a status, or every session if the status is empty, in order of
+// check-in.
+func (ss *Sessions) List(status string) []Session {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	sessions := []Session{}
+	for _, record := range ss.sessions {
+		if status == "" || record.Status == status {
+			sessions = append(sessions, record.Session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if !sessions[i].Start.Equal(sessions[j].Start) {
+			return sessions[i].Start.Before(sessions[j].Start)
+		}
+		return sessions[i].Ticket < sessions[j].Ticket
+	})
+	return sessions
+}
+
+// Get returns the session of a ticket.
+func (ss *Sessions) Get(ticket string) (Session, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	record, ok := ss.sessions[ticket]
+	if !ok {
+		return Session{}, newError(CodeSessionNotFound, "ticket", "no session for ticket '%s'", ticket)
+	}
+	return record.Session, nil
+}
+
+// SessionStatusFromHTTPRequest returns the status in the optional "status" parameter of a request, or
+// an error if it is not a status of a session.
+func SessionStatusFromHTTPRequest(r *http.Request) (string, error) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", SessionOpen, SessionClosed, SessionUnpriced:
+		return status, nil
+	}
+	return "", newError(CodeInvalidParameter, "status", "invalid status '%s', must be \"%s\", \"%s\" or \"%s\"", status, SessionOpen, SessionClosed, SessionUnpriced)
+}
+
+// timeFromHTTPRequest returns the time in an optional parameter of a request in RFC3339 format, or
+// the current time if it is not set.
+func timeFromHTTPRequest(r *http.Request, name string, code string) (time.Time, error) {
+	param := r.URL.Query().Get(name)
+	if param == "" {
+		return time.Now().UTC().Truncate(time.Second), nil
+	}
+	at, err := time.Parse(time.RFC3339, param)
+	if err != nil {
+		return at, newError(code, name, "could not parse '%s' parameter [%s]: %w", name, param, err)
+	}
+	return at, nil
+}
+
+// SessionList is the response for requests for parking sessions.
+type SessionList struct {
+	Status   uint      `json:"status"`
+	Sessions []Session `json:"sessions" xml:"Session"`
+}
+
+// JSON implementation for WebFormatter interface.
+func (l SessionList) JSON() ([]byte, error) {
+	return json.Marshal(l)
+}
+
+// XML implementation for WebFormatter interface.
+func (l SessionList) XML() ([]byte, error) {
+	return xml.Marshal(l)
+}
+
+// StatusCode implementation for WebFormatter interface.
+func (l SessionList) StatusCode() uint {
+	return l.Status
+}
+
+// SessionsHandleFunc is the top-level handler for requests to the /api/sessions endpoint, which
+// lists sessions and checks vehicles in.
+func SessionsHandleFunc(w http.ResponseWriter, r *http.Request) {
+	r, ok := InitializeResponse(&w, r) // Required before WriteResponse
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		SessionsGetHandleFunc(w, r)
+	case http.MethodPost:
+		CheckInHandleFunc(w, r)
+	default:
+		err := methodNotSupported(r.Method)
+		WriteError(http.StatusBadRequest, err, &w, r)
+	}
+}
+
+// SessionsGetHandleFunc returns the session of the "ticket" parameter, or the sessions with the
+// optional "status" parameter.
+//
+// Example:
+//
+//	curl "http://localhost:8080/api/sessions?status=open"
+func SessionsGetHandleFunc(w http.ResponseWriter, r *http.Request) {
+	if ticket := r.URL.Query().Get("ticket"); ticket != "" {
+		session, err := currentSessions.Get(ticket)
+		if err != nil {
+			WriteError(http.StatusNotFound, err, &w, r)
+			return
+		}
+		WriteResponse(SessionList{Status: http.StatusOK, Sessions: []Session{session}}, &w, r)
+		return
+	}
+
+	status, err := SessionStatusFromHTTPRequest(r)
+	if err != nil {
+		WriteError(http.StatusBadRequest, err, &w, r)
+		return
+	}
+	WriteResponse(SessionList{Status: http.StatusOK, Sessions: currentSessions.List(status)}, &w, r)
+}
+
+// CheckInHandleFunc opens a session for the optional "ticket", "vehicle" and "start" parameters of
+// a Post request, priced by the current rates, and records the entry in the occupancy of the
+// facility. The start is the current time if it is not set. The optional "reservation" parameter is
+// the ID of the reservation of the vehicle, which is checked in with the session, and whose vehicle
+// class is used if the "vehicle" parameter is not set.
+//
+// Example:
+//
+//	curl -X POST "http://localhost:8080/api/sessions?ticket=A100&vehicle=car"
+func CheckInHandleFunc(w http.ResponseWriter, r *http.Request) {
+	start, err := timeFromHTTPRequest(r, "start", CodeInvalidStart)
+	if err != nil {
+		WriteError(http.StatusBadRequest, err, &w, r)
+		return
+	}
+
+	// A reservation is checked in first, with the ticket of the session, so that the vehicle is never
+	// counted by both the reservation and the occupancy.
+	ticket, vehicle := r.URL.Query().Get("ticket"), VehicleFromHTTPRequest(r)
+	id := r.URL.Query().Get("reservation")
+	if id != "" {
+		if ticket == "" {
+			if ticket, err = newTicket(); err != nil {
+				WriteError(http.StatusInternalServerError, err, &w, r)
+				return
+			}
+		}
+		reservation, err := currentReservations.CheckIn(id, ticket, start)
+		if err != nil {
+			status := uint(http.StatusBadRequest)
+			if code, _ := ErrorCode(err, 0); code == CodeReservationNotFound {
+				status = http.StatusNotFound
+			}
+			WriteError(status, fmt.Errorf("failed to check in: %w", err), &w, r)
+			return
+		}
+		if vehicle == "" {
+			vehicle = reservation.Vehicle
+		}
+	}
+
+	session, err := currentSessions.CheckIn(ticket, vehicle, start, currentWeeklyRates, currentOccupancy)
+	if err != nil {
+		if id != "" {
+			currentReservations.undoCheckIn(id)
+		}
+		WriteError(http.StatusBadRequest, fmt.Errorf("failed to check in: %w", err), &w, r)
+		return
+	}
+	currentOccupancy.Enter()
+	WriteResponse(SessionList{Status: http.StatusOK, Sessions: []Session{session}}, &w, r)
+}
+
+// CheckOutHandleFunc closes the session of the "ticket" parameter of a Post request to the
+// /api/sessions/checkout endpoint, at the optional "end" parameter or the current time, records the
+// exit in the occupancy of the facility, and returns the session with its final charge. Discount
+// codes in the optional "code" parameter are applied to the charge, and the applied code is redeemed.
+// A charge that an occupancy band changed is recorded in the audit of the occupancy.
+//
+// Example:
+//
+//	curl -X POST "http://localhost:8080/api/sessions/checkout?ticket=A100"
+func CheckOutHandleFunc(w http.ResponseWriter, r *http.Request) {
+	r, ok := InitializeResponse(&w, r) // Required before WriteResponse
+	if !ok {
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		WriteError(http.StatusBadRequest, methodNotSupported(r.Method), &w, r)
+		return
+	}
+
+	ticket := r.URL.Query().Get("ticket")
+	if ticket == "" {
+		err := newError(CodeMissingParameter, "ticket", "the 'ticket' parameter is required to check out")
+		WriteError(http.StatusBadRequest, err, &w, r)
+		return
+	}
+	end, err := timeFromHTTPRequest(r, "end", CodeInvalidEnd)
+	if err != nil {
+		WriteError(http.StatusBadRequest, err, &w, r)
+		return
+	}
+
+	session, err := currentSessions.CheckOut(ticket, end, currentDiscounts, CodesFromHTTPRequest(r))
+	if err != nil {
+		status := uint(http.StatusBadRequest)
+		if code, _ := ErrorCode(err, 0); code == CodeSessionNotFound {
+			status = http.StatusNotFound
+		}
+		WriteError(status, fmt.Errorf("failed to check out: %w", err), &w, r)
+		return
+	}
+	currentOccupancy.Exit()
+	if session.Quote != nil {
+		currentOccupancy.record(Duration{Start: session.Start, End: *session.End}, *session.Quote)
+	}
+	WriteResponse(SessionList{Status: http.StatusOK, Sessions: []Session{session}}, &w, r)
+}
@@ -0,0 +1,296 @@
+package api_test
+
+import (
+	"encoding/json"
+	"github.com/jtide/gopark/api"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func parseTime(t *testing.T, value string) time.Time {
+	at, err := time.Parse(time.RFC3339, value)
+	assert.NoError(t, err)
+	return at
+}
+
+func TestSessionsCheckInAndOut(t *testing.T) {
+	rates := api.NewWeeklyRates()
+	assert.NoError(t, rates.Update(api.JSONDefaultRateConfig))
+	sessions := api.NewSessions()
+
+	session, err := sessions.CheckIn("A100", "", parseTime(t, "2015-07-01T07:00:00Z"), &rates, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, api.Session{Ticket: "A100", Vehicle: "car", Status: api.SessionOpen, Start: parseTime(t, "2015-07-01T07:00:00Z")}, session)
+
+	// The session is priced by the rates at check-in, even after they change.
+	assert.NoError(t, rates.Remove("wed", "0600-1800"))
+	assert.NoError(t, rates.Update([]byte(`{"rates": [{"days": "wed", "times": "0600-1800", "price": 500}]}`)))
+
+	session, err = sessions.CheckOut("A100", parseTime(t, "2015-07-01T12:00:00Z"), nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, api.SessionClosed, session.Status)
+	assert.Equal(t, parseTime(t, "2015-07-01T12:00:00Z"), *session.End)
+	assert.Equal(t, uint(1750), session.Quote.Total)
+
+	_, err = sessions.CheckOut("A100", parseTime(t, "2015-07-01T13:00:00Z"), nil, nil)
+	code, _ := api.ErrorCode(err, 400)
+	assert.Equal(t, api.CodeSessionConflict, code)
+}
+
+func TestSessionsCheckInErrors(t *testing.T) {
+	rates := api.NewWeeklyRates()
+	assert.NoError(t, rates.Update(api.JSONDefaultRateConfig))
+	sessions := api.NewSessions()
+	at := parseTime(t, "2015-07-01T07:00:00Z")
+
+	_, err := sessions.CheckIn("A100", "", at, &rates, nil)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		ticket  string
+		vehicle string
+		code    string
+	}{
+		{"A100", "", api.CodeSessionConflict},
+		{"A 101", "", api.CodeInvalidParameter},
+		{"A102", "truck", api.CodeInvalidVehicle},
+	}
+
+	for _, test := range tests {
+		_, err := sessions.CheckIn(test.ticket, test.vehicle, at, &rates, nil)
+		code, _ := api.ErrorCode(err, 400)
+		assert.Equal(t, test.code, code, test.ticket)
+	}
+
+	_, err = sessions.CheckOut("A100", parseTime(t, "2015-07-01T06:00:00Z"), nil, nil)
+	code, _ := api.ErrorCode(err, 400)
+	assert.Equal(t, api.CodeEndBeforeStart, code)
+	_, err = sessions.CheckOut("NONE", at, nil, nil)
+	code, _ = api.ErrorCode(err, 400)
+	assert.Equal(t, api.CodeSessionNotFound, code)
+}
+
+func TestSessionsListByStatus(t *testing.T) {
+	rates := api.NewWeeklyRates()
+	assert.NoError(t, rates.Update(api.JSONDefaultRateConfig))
+	sessions := api.NewSessions()
+
+	for _, ticket := range []string{"C", "B", "A"} {
+		_, err := sessions.CheckIn(ticket, "", parseTime(t, "2015-07-01T07:00:00Z"), &rates, nil)
+		assert.NoError(t, err)
+	}
+	_, err := sessions.CheckOut("B", parseTime(t, "2015-07-01T08:00:00Z"), nil, nil)
+	assert.NoError(t, err)
+	// No rate covers a stay that ends on another day.
+	session, err := sessions.CheckOut("C", parseTime(t, "2015-07-02T08:00:00Z"), nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, api.SessionUnpriced, session.Status)
+	assert.Nil(t, session.Quote)
+
+	tickets := func(status string) []string {
+		result := []string{}
+		for _, session := range sessions.List(status) {
+			result = append(result, session.Ticket)
+		}
+		return result
+	}
+	assert.Equal(t, []string{"A", "B", "C"}, tickets(""))
+	assert.Equal(t, []string{"A"}, tickets(api.SessionOpen))
+	assert.Equal(t, []string{"B"}, tickets(api.SessionClosed))
+	assert.Equal(t, []string{"C"}, tickets(api.SessionUnpriced))
+}
+
+func TestSessionsPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.json")
+	rates := api.NewWeeklyRates()
+	assert.NoError(t, rates.Update([]byte(`{"currency": "EUR", "rates": [{"days": "wed", "times": "0600-1800", "price": 1200, "vehicles": [{"class": "ev", "price": 900}]}]}`)))
+
+	sessions, err := api.OpenSessions(path, 0)
+	assert.NoError(t, err)
+	_, err = sessions.CheckIn("A100", "ev", parseTime(t, "2015-07-01T07:00:00Z"), &rates, nil)
+	assert.NoError(t, err)
+
+	// A restart prices the session by the rates at check-in.
+	sessions, err = api.OpenSessions(path, 0)
+	assert.NoError(t, err)
+	assert.Len(t, sessions.List(api.SessionOpen), 1)
+	session, err := sessions.CheckOut("A100", parseTime(t, "2015-07-01T09:00:00Z"), nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "EUR", session.Quote.Currency)
+	assert.Equal(t, uint(900), session.Quote.Total)
+
+	sessions, err = api.OpenSessions(path, 0)
+	assert.NoError(t, err)
+	session, err = sessions.Get("A100")
+	assert.NoError(t, err)
+	assert.Equal(t, api.SessionClosed, session.Status)
+	assert.Equal(t, uint(900), session.Quote.Total)
+}
+
+func TestSessionsPersistRatesOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.jsonl")
+	rates := api.NewWeeklyRates()
+	assert.NoError(t, rates.Update(api.JSONDefaultRateConfig))
+
+	sessions, err := api.OpenSessions(path, 0)
+	assert.NoError(t, err)
+	for _, ticket := range []string{"A", "B", "C"} {
+		_, err = sessions.CheckIn(ticket, "", parseTime(t, "2015-07-01T07:00:00Z"), &rates, nil)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, rates.Update([]byte(`{"rates": [{"days": "thurs", "times": "0000-0100", "price": 500}]}`)))
+	_, err = sessions.CheckIn("D", "", parseTime(t, "2015-07-01T07:00:00Z"), &rates, nil)
+	assert.NoError(t, err)
+
+	// Each check-in and check-out is one line, and each distinct configuration of the rates is saved once.
+	_, err = sessions.CheckOut("A", parseTime(t, "2015-07-01T08:00:00Z"), nil, nil)
+	assert.NoError(t, err)
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Len(t, lines, 7)
+	configs := 0
+	for _, line := range lines {
+		if strings.HasPrefix(line, `{"rates":`) {
+			configs++
+		}
+	}
+	assert.Equal(t, 2, configs)
+
+	// A change that was cut short is ignored.
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	assert.NoError(t, err)
+	_, err = file.WriteString(`{"session":{"ticket":"E",`)
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+
+	sessions, err = api.OpenSessions(path, 0)
+	assert.NoError(t, err)
+	assert.Len(t, sessions.List(""), 4)
+	session, err := sessions.CheckOut("D", parseTime(t, "2015-07-01T08:00:00Z"), nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1750), session.Quote.Total)
+}
+
+func TestSessionsRetention(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.jsonl")
+	rates := api.NewWeeklyRates()
+	assert.NoError(t, rates.Update(api.JSONDefaultRateConfig))
+
+	sessions, err := api.OpenSessions(path, 24*time.Hour)
+	assert.NoError(t, err)
+	for _, ticket := range []string{"A", "B"} {
+		_, err = sessions.CheckIn(ticket, "", parseTime(t, "2015-07-01T07:00:00Z"), &rates, nil)
+		assert.NoError(t, err)
+	}
+	_, err = sessions.CheckOut("A", parseTime(t, "2015-07-01T08:00:00Z"), nil, nil)
+	assert.NoError(t, err)
+
+	// Sessions closed before the retention are removed when the sessions are opened, but open ones are kept.
+	sessions, err = api.OpenSessions(path, 24*time.Hour)
+	assert.NoError(t, err)
+	assert.Empty(t, sessions.List(api.SessionClosed))
+	assert.Len(t, sessions.List(api.SessionOpen), 1)
+}
+
+func TestSessionsCheckOutOnAnotherDay(t *testing.T) {
+	rates := api.NewWeeklyRates()
+	assert.NoError(t, rates.Update(api.JSONDefaultRateConfig))
+	sessions := api.NewSessions()
+
+	_, err := sessions.CheckIn("A100", "", parseTime(t, "2015-07-01T07:00:00Z"), &rates, nil)
+	assert.NoError(t, err)
+	session, err := sessions.CheckOut("A100", parseTime(t, "2015-07-02T08:00:00Z"), nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, api.SessionUnpriced, session.Status)
+	assert.Nil(t, session.Quote)
+	assert.Equal(t, "the stay ends on 2015-07-02, a later day than it starts, and rates only price stays within a day", session.Reason)
+}
+
+func TestSessionsHandleFunc(t *testing.T) {
+	err := api.ReplaceRates(api.JSONDefaultRateConfig)
+	assert.NoError(t, err)
+
+	request := func(method string, target string) (int, api.SessionList) {
+		r := httptest.NewRequest(method, target, strings.NewReader(""))
+		w := httptest.NewRecorder()
+		api.NewServeMux().ServeHTTP(w, r)
+		var list api.SessionList
+		json.Unmarshal(w.Body.Bytes(), &list)
+		return w.Code, list
+	}
+
+	status, list := request(http.MethodPost, "/api/sessions?start=2015-07-01T07:00:00Z")
+	assert.Equal(t, http.StatusOK, status)
+	ticket := list.Sessions[0].Ticket
+	assert.Len(t, ticket, 16)
+
+	status, list = request(http.MethodGet, "/api/sessions?ticket="+ticket)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, api.SessionOpen, list.Sessions[0].Status)
+
+	status, list = request(http.MethodPost, "/api/sessions/checkout?ticket="+ticket+"&end=2015-07-01T12:00:00Z")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, uint(1750), list.Sessions[0].Quote.Total)
+
+	status, _ = request(http.MethodGet, "/api/sessions?ticket=NONE")
+	assert.Equal(t, http.StatusNotFound, status)
+	status, _ = request(http.MethodPost, "/api/sessions/checkout")
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, _ = request(http.MethodPost, "/api/sessions?start=yesterday")
+	assert.Equal(t, http.StatusBadRequest, status)
+}
+
+func TestSessionsPricedAtOccupancyOfCheckIn(t *testing.T) {
+	rates := api.NewWeeklyRates()
+	assert.NoError(t, rates.Update(jsonOccupancyBandConfig))
+	path := filepath.Join(t.TempDir(), "sessions.jsonl")
+	sessions, err := api.OpenSessions(path, 0)
+	assert.NoError(t, err)
+	occupancy := &api.Occupancy{}
+	occupancy.Set(9)
+
+	session, err := sessions.CheckIn("A100", "", parseTime(t, "2015-07-01T07:00:00Z"), &rates, occupancy)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(9), session.Occupied)
+
+	// The lot empties before check-out, and after a restart, but the session keeps its band.
+	occupancy.Set(0)
+	sessions, err = api.OpenSessions(path, 0)
+	assert.NoError(t, err)
+	session, err = sessions.CheckOut("A100", parseTime(t, "2015-07-01T12:00:00Z"), nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1875), session.Quote.Total)
+	assert.Equal(t, 1.25, session.Quote.Multiplier)
+}
+
+func TestSessionsCheckOutRedeemsCode(t *testing.T) {
+	rates := api.NewWeeklyRates()
+	assert.NoError(t, rates.Update(api.JSONDefaultRateConfig))
+	sessions := api.NewSessions()
+	discounts := newDiscounts(t)
+
+	for _, ticket := range []string{"A", "B"} {
+		_, err := sessions.CheckIn(ticket, "", parseTime(t, "2015-07-01T07:00:00Z"), &rates, nil)
+		assert.NoError(t, err)
+	}
+
+	// The code is redeemed by the first check-out, and has reached its limit for the second.
+	session, err := sessions.CheckOut("A", parseTime(t, "2015-07-01T12:00:00Z"), discounts, []string{"once"})
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1650), session.Quote.Total)
+	assert.True(t, session.Quote.Discounts[0].Applied)
+	assert.Equal(t, uint(1), discounts.List()[2].Uses)
+
+	session, err = sessions.CheckOut("B", parseTime(t, "2015-07-01T12:00:00Z"), discounts, []string{"once"})
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1750), session.Quote.Total)
+	assert.Equal(t, []api.DiscountResult{{Code: "ONCE", Reason: "usage limit of 1 reached"}}, session.Quote.Discounts)
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"strings"
+	"time"
+)
+
+// Types of SpecialRate.
+const (
+	SpecialEarlyBird = "early_bird"
+	SpecialEvent     = "event"
+)
+
+// SpecialRate is a flat Price for stays that meet its conditions, rather than for a time range of a
+// day. An early_bird rate is for stays that enter before EnterBefore and leave from ExitAfter on the
+// same day, on any of its Days, or on every day if Days is empty. EnterAfter and ExitBefore further
+// limit the times of entry and exit, when they are set. Times are in the configuration format, such
+// as "0900". An event rate is for any stay that overlaps the window from Start to End.
+//
+// A quote is priced by the cheapest of the rate for the stay and the special rates that apply to it.
+type SpecialRate struct {
+	Name        string     `json:"name"`
+	Type        string     `json:"type"`
+	Price       uint       `json:"price"`
+	Days        string     `json:"days,omitempty"`
+	EnterAfter  string     `json:"enter_after,omitempty"`
+	EnterBefore string     `json:"enter_before,omitempty"`
+	ExitAfter   string     `json:"exit_after,omitempty"`
+	ExitBefore  string     `json:"exit_before,omitempty"`
+	Start       *time.Time `json:"start,omitempty"`
+	End         *time.Time `json:"end,omitempty"`
+}
+
+// validateSpecials returns the special rates with their days in lower case, or an error for the first
+// special rate that does not have the conditions its type needs.
+func validateSpecials(specials []SpecialRate) ([]SpecialRate, error) {
+	var valid []SpecialRate
+	for _, special := range specials {
+		if special.Name == "" {
+			return nil, newError(CodeInvalidSpecial, "specials", "special rate must have a name")
+		}
+
+		switch special.Type {
+		case SpecialEarlyBird:
+			if special.EnterBefore == "" || special.ExitAfter == "" {
+				return nil, newError(CodeInvalidSpecial, "specials", "early bird '%s' must have enter_before and exit_after times", special.Name)
+			}
+			if special.Days != "" {
+				var days []string
+				for _, day := range strings.Split(special.Days, ",") {
+					day = strings.ToLower(strings.TrimSpace(day))
+					if _, err := WeekdayFromString(day); err != nil {
+						return nil, newError(CodeInvalidSpecial, "specials", "invalid days for early bird '%s': %w", special.Name, err)
+					}
+					days = append(days, day)
+				}
+				special.Days = strings.Join(days, ",")
+			}
+			for _, times := range []string{special.EnterAfter, special.EnterBefore, special.ExitAfter, special.ExitBefore} {
+				if times == "" {
+					continue
+				}
+				if _, err := MinutesSinceMidnightFromString(times); err != nil {
+					return nil, newError(CodeInvalidSpecial, "specials", "invalid time for early bird '%s': %w", special.Name, err)
+				}
+			}
+		case SpecialEvent:
+			if special.Start == nil || special.End == nil || !special.Start.Before(*special.End) {
+				return nil, newError(CodeInvalidSpecial, "specials", "event '%s' must have a start before its end", special.Name)
+			}
+		default:
+			return nil, newError(CodeInvalidSpecial, "specials", "invalid type '%s' for special rate '%s', must be \"%s\" or \"%s\"", special.Type, special.Name, SpecialEarlyBird, SpecialEvent)
+		}
+		valid = append(valid, special)
+	}
+	return valid, nil
+}
+
+// AppliesTo returns true if a stay meets the conditions of the special rate.
+func (s SpecialRate) AppliesTo(d Duration) bool {
+	switch s.Type {
+	case SpecialEarlyBird:
+		if d.Start.YearDay() != d.End.YearDay() || !s.onDay(d.Start.Weekday()) {
+			return false
+		}
+		enter := MinutesSinceMidnightFromTime(d.Start)
+		exit := MinutesSinceMidnightFromTime(d.End)
+		return atOrAfter(enter, s.EnterAfter) && before(enter, s.EnterBefore) &&
+			atOrAfter(exit, s.ExitAfter) && before(exit, s.ExitBefore)
+	case SpecialEvent:
+		return d.Start.Before(*s.End) && d.End.After(*s.Start)
+	}
+	return false
+}
+
+// onDay returns true if the special rate applies on a day of the week.
+func (s SpecialRate) onDay(weekday time.Weekday) bool {
+	if s.Days == "" {
+		return true
+	}
+	for _, day := range strings.Split(s.Days, ",") {
+		if d, err := WeekdayFromString(day); err == nil && d == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+// atOrAfter returns true if the minute is at or after the time, or the time is empty.
+func atOrAfter(minute uint64, times string) bool {
+	limit, err := MinutesSinceMidnightFromString(times)
+	return err != nil || minute >= limit
+}
+
+// before returns true if the minute is before the time, or the time is empty.
+func before(minute uint64, times string) bool {
+	limit, err := MinutesSinceMidnightFromString(times)
+	return err != nil || minute < limit
+}
+
+// item returns the line item of a quote for a stay priced by the special rate.
+func (s SpecialRate) item(d Duration) LineItem {
+	return LineItem{
+		Day:       StringFromWeekday(d.Start.Weekday()),
+		Times:     TimeRangeToConfigString(MinutesSinceMidnightFromTime(d.Start), MinutesSinceMidnightFromTime(d.End)),
+		Special:   s.Name,
+		Minutes:   d.minutes(),
+		UnitPrice: s.Price,
+		Subtotal:  s.Price,
+	}
+}
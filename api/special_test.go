@@ -0,0 +1,141 @@
+package api_test
+
+import (
+	"github.com/jtide/gopark/api"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+var jsonSpecialsConfig = []byte(`{
+	"specials": [
+		{"name": "Early bird", "type": "early_bird", "price": 1200, "days": "Mon,tues,wed,thurs,fri", "enter_before": "0900", "exit_after": "1500", "exit_before": "1900"},
+		{"name": "Fireworks", "type": "event", "price": 1000, "start": "2015-07-04T18:00:00Z", "end": "2015-07-04T23:00:00Z"},
+		{"name": "Concert", "type": "event", "price": 3000, "start": "2015-07-04T10:00:00Z", "end": "2015-07-04T12:00:00Z"}
+	],
+	"rates": [
+		{"days": "mon,tues,thurs", "times": "0900-2100", "price": 1500},
+		{"days": "fri,sat,sun", "times": "0900-2100", "price": 2000},
+		{"days": "wed", "times": "0600-1800", "price": 1750}
+	]
+}`)
+
+func TestQuoteWithSpecials(t *testing.T) {
+	rates := api.NewWeeklyRates()
+	err := rates.Update(jsonSpecialsConfig)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		start   string
+		end     string
+		special string
+		price   uint
+	}{
+		// Early bird on Wednesday, and on Thursday, before the rate of the day starts
+		{"2015-07-01T07:00:00Z", "2015-07-01T16:00:00Z", "Early bird", 1200},
+		{"2015-07-02T08:00:00Z", "2015-07-02T15:00:00Z", "Early bird", 1200},
+		// Leaving too early, too late, or entering too late for the early bird
+		{"2015-07-01T07:00:00Z", "2015-07-01T12:00:00Z", "", 1750},
+		{"2015-07-02T08:30:00Z", "2015-07-02T19:00:00Z", "", 0},
+		{"2015-07-02T09:00:00Z", "2015-07-02T16:00:00Z", "", 1500},
+		// Not an early bird on a Saturday, but overlapping the concert
+		{"2015-07-04T08:00:00Z", "2015-07-04T16:00:00Z", "Concert", 3000},
+		// Overlapping the fireworks, even past midnight
+		{"2015-07-04T17:00:00Z", "2015-07-04T20:00:00Z", "Fireworks", 1000},
+		{"2015-07-04T22:00:00Z", "2015-07-05T01:00:00Z", "Fireworks", 1000},
+		{"2015-07-04T23:00:00Z", "2015-07-05T01:00:00Z", "", 0},
+		// The rate of the day is cheaper than the concert
+		{"2015-07-04T11:00:00Z", "2015-07-04T13:00:00Z", "", 2000},
+	}
+
+	for _, test := range tests {
+		duration, err := api.ParseDuration(test.start, test.end)
+		assert.NoError(t, err)
+		quote, err := rates.QuoteByDuration(duration)
+		if test.price == 0 {
+			assert.Error(t, err, test.start)
+			continue
+		}
+		assert.NoError(t, err, test.start)
+		assert.Equal(t, test.special, quote.Items[0].Special, test.start)
+		assert.Equal(t, test.price, quote.Total, test.start)
+		if test.special != "" {
+			assert.Nil(t, quote.Items[0].Rate)
+		}
+	}
+}
+
+func TestWeeklyRates_UpdateKeepsSpecials(t *testing.T) {
+	rates := api.NewWeeklyRates()
+	err := rates.Update(jsonSpecialsConfig)
+	assert.NoError(t, err)
+
+	err = rates.Update([]byte(`{"rates": [{"days": "sat", "times": "0000-0100", "price": 500}]}`))
+	assert.NoError(t, err)
+	config := rates.Config()
+	assert.Len(t, config.Specials, 3)
+	assert.Equal(t, "mon,tues,wed,thurs,fri", config.Specials[0].Days)
+
+	// Special rates cannot be exported as CSV
+	_, err = config.CSV()
+	assert.ErrorIs(t, err, api.ErrNoEncoding)
+
+	err = rates.Update([]byte(`{"specials": [], "rates": []}`))
+	assert.NoError(t, err)
+	assert.Empty(t, rates.Specials())
+}
+
+func TestWeeklyRates_UpdateWithInvalidSpecials(t *testing.T) {
+	configs := []string{
+		`{"specials": [{"type": "event", "price": 100, "start": "2015-07-04T18:00:00Z", "end": "2015-07-04T23:00:00Z"}], "rates": []}`,
+		`{"specials": [{"name": "Happy hour", "type": "happy_hour", "price": 100}], "rates": []}`,
+		`{"specials": [{"name": "Early bird", "type": "early_bird", "price": 100, "enter_before": "0900"}], "rates": []}`,
+		`{"specials": [{"name": "Early bird", "type": "early_bird", "price": 100, "enter_before": "9am", "exit_after": "1500"}], "rates": []}`,
+		`{"specials": [{"name": "Early bird", "type": "early_bird", "price": 100, "days": "someday", "enter_before": "0900", "exit_after": "1500"}], "rates": []}`,
+		`{"specials": [{"name": "Fireworks", "type": "event", "price": 100, "start": "2015-07-04T23:00:00Z", "end": "2015-07-04T18:00:00Z"}], "rates": []}`,
+		`{"specials": [{"name": "Fireworks", "type": "event", "price": 100}], "rates": []}`,
+		`{"specials": [{"name": "Fireworks", "type": "event", "price": -100}], "rates": []}`,
+	}
+
+	for _, config := range configs {
+		rates := api.NewWeeklyRates()
+		err := rates.Update([]byte(config))
+		code, field := api.ErrorCode(err, 400)
+		assert.Equal(t, api.CodeInvalidSpecial, code, config)
+		assert.Equal(t, "specials", field, config)
+	}
+}
+
+func TestWeeklyRates_FacilityWithoutRates(t *testing.T) {
+	rates := api.NewWeeklyRates()
+	err := rates.Update([]byte(`{
+		"capacity": 10,
+		"grace": {"minutes": 10},
+		"charges": [{"name": "City parking tax", "type": "tax", "percent": 10}],
+		"specials": [{"name": "Fireworks", "type": "event", "price": 1000, "start": "2015-07-04T18:00:00Z", "end": "2015-07-04T23:00:00Z"}],
+		"rates": []
+	}`))
+	assert.NoError(t, err)
+	assert.True(t, rates.IsEmpty())
+
+	// The facility of a configuration without rates is kept, and its special rates are quoted
+	assertFacility := func(message string) {
+		config := rates.Config()
+		assert.Equal(t, uint(10), config.Capacity, message)
+		assert.Equal(t, &api.Grace{Minutes: 10}, config.Grace, message)
+		assert.Len(t, config.Charges, 1, message)
+		assert.Len(t, config.Specials, 1, message)
+
+		duration, err := api.ParseDuration("2015-07-04T17:00:00Z", "2015-07-04T20:00:00Z")
+		assert.NoError(t, err, message)
+		quote, err := rates.QuoteByDuration(duration)
+		assert.NoError(t, err, message)
+		assert.Equal(t, uint(1100), quote.Total, message)
+	}
+	assertFacility("without rates")
+
+	// Removing the last rate keeps the facility
+	err = rates.Update([]byte(`{"rates": [{"days": "sat", "times": "0000-0100", "price": 500}]}`))
+	assert.NoError(t, err)
+	assert.NoError(t, rates.Remove("sat", "0000-0100"))
+	assertFacility("after removing the last rate")
+}
@@ -30,12 +30,43 @@ func WeekdayFromString(day string) (time.Weekday, error) {
 	case "sun":
 		weekday = time.Sunday
 	default:
-		return 0, fmt.Errorf("'%s' is not a recognized weekday", day)
+		return 0, newError(CodeInvalidDays, "days", "'%s' is not a recognized weekday", day)
 	}
 
 	return weekday, nil
 }
 
+// Weekdays lists every day of the week in the order used for rate configurations, starting with Monday.
+var Weekdays = []time.Weekday{
+	time.Monday,
+	time.Tuesday,
+	time.Wednesday,
+	time.Thursday,
+	time.Friday,
+	time.Saturday,
+	time.Sunday,
+}
+
+// StringFromWeekday returns the abbreviated day for a time.Weekday, the inverse of WeekdayFromString.
+func StringFromWeekday(weekday time.Weekday) string {
+	switch weekday {
+	case time.Monday:
+		return "mon"
+	case time.Tuesday:
+		return "tues"
+	case time.Wednesday:
+		return "wed"
+	case time.Thursday:
+		return "thurs"
+	case time.Friday:
+		return "fri"
+	case time.Saturday:
+		return "sat"
+	default:
+		return "sun"
+	}
+}
+
 func MinutesSinceMidnightFromTime(t time.Time) uint64 {
 	return uint64(t.Minute() + 60*t.Hour())
 }
@@ -68,27 +99,53 @@ func MinutesSinceMidnightFromString(s string) (uint64, error) {
 func TimeRangeFromConfigString(s string) (uint64, uint64, error) {
 	times := strings.Split(s, "-")
 	if len(times) != 2 {
-		return 0, 0, fmt.Errorf("invalid time range format: %s", s)
+		return 0, 0, newError(CodeInvalidTimes, "times", "invalid time range format: %s", s)
 	}
 
 	start, err := MinutesSinceMidnightFromString(times[0])
 	if err != nil {
-		return 0, 0, fmt.Errorf("invalid start time: %v", err.Error())
+		return 0, 0, newError(CodeInvalidTimes, "times", "invalid start time: %w", err)
 	}
 
 	end, err := MinutesSinceMidnightFromString(times[1])
 	if err != nil {
-		return 0, 0, fmt.Errorf("invalid end time: %s", err.Error())
+		return 0, 0, newError(CodeInvalidTimes, "times", "invalid end time: %w", err)
 	}
 
 	return start, end, nil
 }
 
+// TimeRangeToConfigString formats a time range in minutes-since-midnight as a configuration string,
+// such as "0900-2100". It is the inverse of TimeRangeFromConfigString.
+func TimeRangeToConfigString(start uint64, end uint64) string {
+	return fmt.Sprintf("%02d%02d-%02d%02d", start/60, start%60, end/60, end%60)
+}
+
+// ConfigFromRequestBody parses the rate configuration in the body of a request. The body may be in
+// JSON format, with the "Content-Type:application/json" header set, or in CSV format, with the
+// "Content-Type:text/csv" header set.
+func ConfigFromRequestBody(r *http.Request) (ConfigRates, error) {
+	contentType := r.Header.Get("Content-Type")
+	switch {
+	case strings.Contains(contentType, "json"):
+		jsonConfig, err := JSONFromRequestBody(r)
+		if err != nil {
+			return ConfigRates{}, err
+		}
+		return ConfigRatesFromJSON(jsonConfig)
+	case strings.Contains(contentType, "csv"):
+		defer r.Body.Close()
+		return ConfigRatesFromCSV(r.Body)
+	default:
+		return ConfigRates{}, newError(CodeUnsupportedContentType, "", "invalid content type \"%v\" in request, \"Content-Type:application/json\" or \"Content-Type:text/csv\" is required", contentType)
+	}
+}
+
 func JSONFromRequestBody(r *http.Request) ([]byte, error) {
 	// Require JSON Content-Type
 	contentType := r.Header.Get("Content-Type")
 	if !strings.Contains(contentType, "json") {
-		return nil, fmt.Errorf("invalid content type \"%v\" in request, \"Content-Type:application/json\" is required", contentType)
+		return nil, newError(CodeUnsupportedContentType, "", "invalid content type \"%v\" in request, \"Content-Type:application/json\" is required", contentType)
 	}
 
 	// Convert JSON body of request into []byte for unmarshalling
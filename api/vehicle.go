@@ -0,0 +1,104 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// DefaultVehicleClass is the vehicle class of quotes when neither the quote nor the rate configuration
+// gives one.
+const DefaultVehicleClass = "car"
+
+// VehiclePrice is the price of a rate for a class of vehicle, such as "motorcycle", "oversized" or
+// "ev". The Price is in the minor unit of the currency of the configuration.
+type VehiclePrice struct {
+	Class string `json:"class"`
+	Price uint   `json:"price"`
+}
+
+// VehicleClassFromString returns a vehicle class in lower case, or an error if it is empty or has
+// spaces or commas.
+func VehicleClassFromString(class string) (string, error) {
+	vehicle := strings.ToLower(strings.TrimSpace(class))
+	if vehicle == "" || strings.ContainsAny(vehicle, ", \t\n") {
+		return "", newError(CodeInvalidVehicle, "vehicle", "invalid vehicle class '%s', must not be empty or contain spaces or commas", class)
+	}
+	return vehicle, nil
+}
+
+// validateVehiclePrices returns the prices with their classes in lower case, or an error if a class
+// is invalid or repeated.
+func validateVehiclePrices(prices []VehiclePrice) ([]VehiclePrice, error) {
+	var vehicles []VehiclePrice
+	seen := make(map[string]bool)
+	for _, price := range prices {
+		class, err := VehicleClassFromString(price.Class)
+		if err != nil {
+			return nil, err
+		}
+		if seen[class] {
+			return nil, newError(CodeInvalidVehicle, "vehicle", "vehicle class '%s' is repeated", class)
+		}
+		seen[class] = true
+		vehicles = append(vehicles, VehiclePrice{Class: class, Price: price.Price})
+	}
+	return vehicles, nil
+}
+
+// PriceFor returns the price of the rate for a class of vehicle, which is the Price unless the rate
+// has a price for the class.
+func (r HourlyRate) PriceFor(vehicle string) Money {
+	for _, price := range r.Vehicles {
+		if price.Class == vehicle {
+			return Money{Amount: price.Price, Currency: r.Price.Currency}
+		}
+	}
+	return r.Price
+}
+
+// VehicleClasses returns the vehicle classes that can be quoted, which are the default class and
+// every class with a price, in alphabetical order.
+func (rates *WeeklyRates) VehicleClasses() []string {
+	seen := map[string]bool{rates.DefaultVehicle(): true}
+	for _, dayRates := range rates.Days {
+		for _, rate := range dayRates {
+			for _, price := range rate.Vehicles {
+				seen[price.Class] = true
+			}
+		}
+	}
+
+	var classes []string
+	for class := range seen {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	return classes
+}
+
+// vehicleFor returns the vehicle class to quote, which is the default class of the rates if the
+// vehicle is empty, or an error if the rates have no price for the class.
+func (rates *WeeklyRates) vehicleFor(vehicle string) (string, error) {
+	if vehicle == "" {
+		return rates.DefaultVehicle(), nil
+	}
+
+	vehicle, err := VehicleClassFromString(vehicle)
+	if err != nil {
+		return "", err
+	}
+	classes := rates.VehicleClasses()
+	for _, class := range classes {
+		if class == vehicle {
+			return vehicle, nil
+		}
+	}
+	return "", newError(CodeInvalidVehicle, "vehicle", "unknown vehicle class '%s', must be one of %s", vehicle, strings.Join(classes, ", "))
+}
+
+// VehicleFromHTTPRequest returns the vehicle class in the optional "vehicle" parameter of a request,
+// or an empty string for the default class.
+func VehicleFromHTTPRequest(r *http.Request) string {
+	return r.URL.Query().Get("vehicle")
+}
@@ -0,0 +1,120 @@
+package api_test
+
+import (
+	"github.com/jtide/gopark/api"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var jsonVehicleConfig = []byte(`{
+	"default_vehicle": "car",
+	"rates": [
+		{"days": "wed", "times": "0600-1800", "price": 1750,
+		 "vehicles": [{"class": "Motorcycle", "price": 800}, {"class": "oversized", "price": 2500}]},
+		{"days": "thurs", "times": "0600-1800", "price": 1500, "vehicles": [{"class": "ev", "price": 1200}]}
+	]
+}`)
+
+func TestQuoteWithOptionsVehicle(t *testing.T) {
+	rates := api.NewWeeklyRates()
+	err := rates.Update(jsonVehicleConfig)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"car", "ev", "motorcycle", "oversized"}, rates.VehicleClasses())
+
+	tests := []struct {
+		start    string
+		end      string
+		vehicle  string
+		expected string
+		price    uint
+	}{
+		{"2015-07-01T07:00:00Z", "2015-07-01T12:00:00Z", "", "car", 1750},
+		{"2015-07-01T07:00:00Z", "2015-07-01T12:00:00Z", "MOTORCYCLE", "motorcycle", 800},
+		{"2015-07-01T07:00:00Z", "2015-07-01T12:00:00Z", "oversized", "oversized", 2500},
+		{"2015-07-01T07:00:00Z", "2015-07-01T12:00:00Z", "ev", "ev", 1750},
+		{"2015-07-02T07:00:00Z", "2015-07-02T12:00:00Z", "ev", "ev", 1200},
+		{"2015-07-02T07:00:00Z", "2015-07-02T12:00:00Z", "motorcycle", "motorcycle", 1500},
+	}
+
+	for _, test := range tests {
+		duration, err := api.ParseDuration(test.start, test.end)
+		assert.NoError(t, err)
+		quote, err := rates.QuoteWithOptions(duration, api.QuoteOptions{Vehicle: test.vehicle})
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, quote.Vehicle)
+		assert.Equal(t, test.price, quote.Items[0].UnitPrice)
+		assert.Equal(t, test.price, quote.Total)
+	}
+
+	duration, err := api.ParseDuration("2015-07-01T07:00:00Z", "2015-07-01T12:00:00Z")
+	assert.NoError(t, err)
+	_, err = rates.QuoteWithOptions(duration, api.QuoteOptions{Vehicle: "truck"})
+	code, field := api.ErrorCode(err, 400)
+	assert.Equal(t, api.CodeInvalidVehicle, code)
+	assert.Equal(t, "vehicle", field)
+}
+
+func TestWeeklyRates_UpdateWithDefaultVehicle(t *testing.T) {
+	rates := api.NewWeeklyRates()
+	assert.Equal(t, api.DefaultVehicleClass, rates.DefaultVehicle())
+
+	err := rates.Update([]byte(`{"default_vehicle": "Motorcycle", "rates": [{"days": "wed", "times": "0600-1800", "price": 1750, "vehicles": [{"class": "motorcycle", "price": 800}]}]}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "motorcycle", rates.DefaultVehicle())
+
+	// New rates keep the default of the existing rates
+	err = rates.Update([]byte(`{"rates": [{"days": "thurs", "times": "0600-1800", "price": 1500}]}`))
+	assert.NoError(t, err)
+	duration, err := api.ParseDuration("2015-07-01T07:00:00Z", "2015-07-01T12:00:00Z")
+	assert.NoError(t, err)
+	quote, err := rates.QuoteByDuration(duration)
+	assert.NoError(t, err)
+	assert.Equal(t, "motorcycle", quote.Vehicle)
+	assert.Equal(t, uint(800), quote.Total)
+
+	config := rates.Config()
+	assert.Equal(t, "motorcycle", config.DefaultVehicle)
+	assert.Equal(t, []api.VehiclePrice{{Class: "motorcycle", Price: 800}}, config.Rates[0].Vehicles)
+	assert.Empty(t, config.Rates[1].Vehicles)
+
+	// Vehicle classes cannot be exported as CSV
+	_, err = config.CSV()
+	assert.ErrorIs(t, err, api.ErrNoEncoding)
+}
+
+func TestWeeklyRates_UpdateWithInvalidVehicles(t *testing.T) {
+	configs := []string{
+		`{"default_vehicle": "big truck", "rates": []}`,
+		`{"rates": [{"days": "wed", "times": "0600-1800", "price": 1750, "vehicles": [{"class": "", "price": 800}]}]}`,
+		`{"rates": [{"days": "wed", "times": "0600-1800", "price": 1750, "vehicles": [{"class": "ev", "price": 800}, {"class": "EV", "price": 900}]}]}`,
+		`{"rates": [{"days": "wed", "times": "0600-1800", "price": 1750, "vehicles": [{"class": 7, "price": 800}]}]}`,
+	}
+
+	for _, config := range configs {
+		rates := api.NewWeeklyRates()
+		err := rates.Update([]byte(config))
+		code, field := api.ErrorCode(err, 400)
+		assert.Equal(t, api.CodeInvalidVehicle, code, config)
+		assert.Equal(t, "vehicle", field, config)
+	}
+}
+
+func TestRateHandleFuncVehicle(t *testing.T) {
+	err := api.ReplaceRates(jsonVehicleConfig)
+	assert.NoError(t, err)
+	defer api.ReplaceRates(api.JSONDefaultRateConfig)
+
+	r := httptest.NewRequest(http.MethodGet, "/api/rate?start=2015-07-01T07:00:00Z&end=2015-07-01T12:00:00Z&vehicle=motorcycle", nil)
+	w := httptest.NewRecorder()
+	api.RateHandleFunc(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"price":800,"currency":"USD","formatted_price":"$8.00","vehicle":"motorcycle"`)
+
+	r = httptest.NewRequest(http.MethodGet, "/api/rate?start=2015-07-01T07:00:00Z&end=2015-07-01T12:00:00Z&vehicle=truck", nil)
+	w = httptest.NewRecorder()
+	api.RateHandleFunc(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"invalid_vehicle"`)
+}
@@ -0,0 +1,416 @@
+package api
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Events of a RateChange.
+const (
+	EventRatesReplaced = "rates.replaced"
+	EventRatesUpdated  = "rates.updated"
+	EventRatesRemoved  = "rates.removed"
+)
+
+// Statuses of a Delivery.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// Headers of a webhook request. The signature is "sha256=" and the hex HMAC-SHA256 of the body,
+// keyed by the secret of the webhook.
+const (
+	HeaderWebhookEvent     = "X-Gopark-Event"
+	HeaderWebhookDelivery  = "X-Gopark-Delivery"
+	HeaderWebhookSignature = "X-Gopark-Signature"
+)
+
+// MaxDeliveries is the number of deliveries kept in the delivery log. The oldest deliveries are
+// dropped first.
+const MaxDeliveries = 1000
+
+// RateChange is the payload sent to webhooks when the rates change. The Rates are the configuration
+// of the rates after the change, in the same format as an export.
+type RateChange struct {
+	Event string      `json:"event"`
+	Time  time.Time   `json:"time"`
+	Rates ConfigRates `json:"rates"`
+}
+
+// Webhook is a URL that is sent a RateChange whenever the rates change. The Secret signs each
+// request, and is only included in the response that registers the webhook.
+type Webhook struct {
+	ID     string `json:"id"`
+	URL    string `json:"url"`
+	Secret string `json:"secret,omitempty"`
+}
+
+// Delivery is the record of sending a RateChange to a webhook. A delivery is pending until the
+// webhook responds with a 2xx status, when it is delivered, or until every attempt has failed. The
+// Response is the status of the last response, if there was one, and the Error is why the last
+// attempt failed.
+type Delivery struct {
+	ID       string    `json:"id"`
+	Webhook  string    `json:"webhook"`
+	URL      string    `json:"url"`
+	Event    string    `json:"event"`
+	Status   string    `json:"status"`
+	Attempts uint      `json:"attempts"`
+	Response int       `json:"response,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// Webhooks is a store of webhooks and the log of their deliveries. Each delivery is sent in the
+// background, and is attempted up to Attempts times, waiting Backoff before the first retry and
+// twice as long before each retry after that. It is safe for concurrent use, but the Client,
+// Attempts and Backoff must not be changed once a delivery has been sent.
+type Webhooks struct {
+	Client   *http.Client
+	Attempts uint
+	Backoff  time.Duration
+
+	mu         sync.Mutex
+	next       int
+	sent       int
+	webhooks   map[string]Webhook
+	deliveries []*Delivery
+	pending    sync.WaitGroup
+}
+
+// currentWebhooks is the store of webhooks used by the API.
+var currentWebhooks = NewWebhooks()
+
+// NewWebhooks returns an empty store of webhooks, which attempts each delivery 5 times, starting
+// with a backoff of a second.
+func NewWebhooks() *Webhooks {
+	return &Webhooks{
+		Client:   &http.Client{Timeout: 10 * time.Second},
+		Attempts: 5,
+		Backoff:  time.Second,
+		webhooks: make(map[string]Webhook),
+	}
+}
+
+// Sign returns the signature of a webhook request body for a secret, as sent in the
+// X-Gopark-Signature header, so that a receiver can check that a request came from the API.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// newSecret returns a random secret for a webhook.
+func newSecret() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to create secret: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Register adds a webhook for an absolute http or https URL, and returns it with its secret. A
+// secret is created for the webhook if it is empty.
+func (ws *Webhooks) Register(rawURL string, secret string) (Webhook, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Webhook{}, newError(CodeInvalidWebhook, "url", "invalid webhook URL '%s', must be an absolute http or https URL", rawURL)
+	}
+	if secret == "" {
+		if secret, err = newSecret(); err != nil {
+			return Webhook{}, err
+		}
+	}
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	ws.next++
+	webhook := Webhook{ID: fmt.Sprintf("W%d", ws.next), URL: u.String(), Secret: secret}
+	ws.webhooks[webhook.ID] = webhook
+	return webhook, nil
+}
+
+// Remove removes the webhook with an ID. Deliveries already in progress are still attempted.
+func (ws *Webhooks) Remove(id string) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if _, ok := ws.webhooks[id]; !ok {
+		return newError(CodeWebhookNotFound, "id", "no webhook with id '%s'", id)
+	}
+	delete(ws.webhooks, id)
+	return nil
+}
+
+// List returns every webhook without its secret, in the order they were registered.
+func (ws *Webhooks) List() []Webhook {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	webhooks := []Webhook{}
+	for _, webhook := range ws.webhooks {
+		webhook.Secret = ""
+		webhooks = append(webhooks, webhook)
+	}
+	sort.Slice(webhooks, func(i, j int) bool {
+		if len(webhooks[i].ID) != len(webhooks[j].ID) {
+			return len(webhooks[i].ID) < len(webhooks[j].ID)
+		}
+		return webhooks[i].ID < webhooks[j].ID
+	})
+	return webhooks
+}
+
+// Deliveries returns the log of deliveries to the webhook with an ID, or to every webhook if the ID
+// is empty, with the most recent delivery first.
+func (ws *Webhooks) Deliveries(webhook string) []Delivery {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	deliveries := []Delivery{}
+	for i := len(ws.deliveries) - 1; i >= 0; i-- {
+		if webhook == "" || ws.deliveries[i].Webhook == webhook {
+			deliveries = append(deliveries, *ws.deliveries[i])
+		}
+	}
+	return deliveries
+}
+
+// Notify sends a RateChange for an event and the rates after the change to every webhook, in the
+// background. A payload that cannot be encoded is logged as a failed delivery.
+func (ws *Webhooks) Notify(event string, rates *WeeklyRates) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if len(ws.webhooks) == 0 {
+		return
+	}
+	body, err := json.Marshal(RateChange{Event: event, Time: time.Now().UTC().Truncate(time.Second), Rates: rates.Config()})
+	for _, webhook := range ws.webhooks {
+		ws.sent++
+		delivery := &Delivery{
+			ID:      fmt.Sprintf("D%d", ws.sent),
+			Webhook: webhook.ID,
+			URL:     webhook.URL,
+			Event:   event,
+			Status:  DeliveryPending,
+			Time:    time.Now().UTC().Truncate(time.Second),
+		}
+		ws.deliveries = append(ws.deliveries, delivery)
+		if len(ws.deliveries) > MaxDeliveries {
+			ws.deliveries = ws.deliveries[len(ws.deliveries)-MaxDeliveries:]
+		}
+
+		if err != nil {
+			delivery.Status = DeliveryFailed
+			delivery.Error = fmt.Sprintf("failed to encode payload: %v", err)
+			continue
+		}
+		ws.pending.Add(1)
+		go ws.deliver(delivery, webhook.Secret, body)
+	}
+}
+
+// Wait blocks until every delivery in progress is delivered or has failed.
+func (ws *Webhooks) Wait() {
+	ws.pending.Wait()
+}
+
+// deliver attempts to send the body to the URL of a delivery, with a backoff between attempts, and
+// records the outcome of each attempt in the delivery.
+func (ws *Webhooks) deliver(delivery *Delivery, secret string, body []byte) {
+	defer ws.pending.Done()
+
+	backoff := ws.Backoff
+	for attempt := uint(1); attempt <= ws.Attempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+
+		response, err := ws.send(delivery, secret, body)
+
+		ws.mu.Lock()
+		delivery.Attempts = attempt
+		delivery.Response = response
+		delivery.Error = ""
+		if err != nil {
+			delivery.Error = err.Error()
+		} else if response < 200 || response > 299 {
+			delivery.Error = fmt.Sprintf("webhook responded with status %d", response)
+		} else {
+			delivery.Status = DeliveryDelivered
+		}
+		if delivery.Status == DeliveryPending && attempt == ws.Attempts {
+			delivery.Status = DeliveryFailed
+		}
+		done := delivery.Status != DeliveryPending
+		ws.mu.Unlock()
+
+		if done {
+			return
+		}
+	}
+}
+
+// send makes a single signed request for a delivery, and returns the status of the response.
+func (ws *Webhooks) send(delivery *Delivery, secret string, body []byte) (int, error) {
+	request, err := http.NewRequest(http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(HeaderWebhookEvent, delivery.Event)
+	request.Header.Set(HeaderWebhookDelivery, delivery.ID)
+	request.Header.Set(HeaderWebhookSignature, Sign(secret, body))
+
+	response, err := ws.Client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	response.Body.Close()
+	return response.StatusCode, nil
+}
+
+// WebhookList is the response for requests for webhooks.
+type WebhookList struct {
+	Status   uint      `json:"status"`
+	Webhooks []Webhook `json:"webhooks" xml:"Webhook"`
+}
+
+// JSON implementation for WebFormatter interface.
+func (l WebhookList) JSON() ([]byte, error) {
+	return json.Marshal(l)
+}
+
+// XML implementation for WebFormatter interface.
+func (l WebhookList) XML() ([]byte, error) {
+	return xml.Marshal(l)
+}
+
+// StatusCode implementation for WebFormatter interface.
+func (l WebhookList) StatusCode() uint {
+	return l.Status
+}
+
+// DeliveryList is the response for requests for the delivery log.
+type DeliveryList struct {
+	Status     uint       `json:"status"`
+	Deliveries []Delivery `json:"deliveries" xml:"Delivery"`
+}
+
+// JSON implementation for WebFormatter interface.
+func (l DeliveryList) JSON() ([]byte, error) {
+	return json.Marshal(l)
+}
+
+// XML implementation for WebFormatter interface.
+func (l DeliveryList) XML() ([]byte, error) {
+	return xml.Marshal(l)
+}
+
+// StatusCode implementation for WebFormatter interface.
+func (l DeliveryList) StatusCode() uint {
+	return l.Status
+}
+
+// WebhooksHandleFunc is the top-level handler for requests to the /api/webhooks endpoint, which
+// lists, registers and removes webhooks.
+func WebhooksHandleFunc(w http.ResponseWriter, r *http.Request) {
+	r, ok := InitializeResponse(&w, r) // Required before WriteResponse
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		WriteResponse(WebhookList{Status: http.StatusOK, Webhooks: currentWebhooks.List()}, &w, r)
+	case http.MethodPost:
+		RegisterWebhookHandleFunc(w, r)
+	case http.MethodDelete:
+		RemoveWebhookHandleFunc(w, r)
+	default:
+		err := methodNotSupported(r.Method)
+		WriteError(http.StatusBadRequest, err, &w, r)
+	}
+}
+
+// RegisterWebhookHandleFunc registers the webhook in the body of a Post request, and returns it
+// with its secret. The body must be in JSON format.
+//
+// Example:
+//
+//	curl -X POST -H "Content-Type: application/json" -d '{"url":"https://example.com/gopark"}' "http://localhost:8080/api/webhooks"
+func RegisterWebhookHandleFunc(w http.ResponseWriter, r *http.Request) {
+	body, err := JSONFromRequestBody(r)
+	if err != nil {
+		WriteError(http.StatusBadRequest, err, &w, r)
+		return
+	}
+	var config Webhook
+	if err = json.Unmarshal(body, &config); err != nil {
+		err = newError(CodeInvalidBody, "", "could not parse JSON to register webhook : %w", err)
+		WriteError(http.StatusBadRequest, err, &w, r)
+		return
+	}
+
+	webhook, err := currentWebhooks.Register(config.URL, config.Secret)
+	if err != nil {
+		WriteError(http.StatusBadRequest, fmt.Errorf("failed to register webhook: %w", err), &w, r)
+		return
+	}
+	WriteResponse(WebhookList{Status: http.StatusOK, Webhooks: []Webhook{webhook}}, &w, r)
+}
+
+// RemoveWebhookHandleFunc removes the webhook of the "id" parameter of a Delete request.
+//
+// Example:
+//
+//	curl -X DELETE "http://localhost:8080/api/webhooks?id=W1"
+func RemoveWebhookHandleFunc(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		err := newError(CodeMissingParameter, "id", "the 'id' parameter is required to remove a webhook")
+		WriteError(http.StatusBadRequest, err, &w, r)
+		return
+	}
+
+	if err := currentWebhooks.Remove(id); err != nil {
+		WriteError(http.StatusNotFound, fmt.Errorf("failed to remove webhook: %w", err), &w, r)
+		return
+	}
+	WriteResponse(APIStandardResponse{Status: http.StatusOK, Description: "removed webhook"}, &w, r)
+}
+
+// DeliveriesHandleFunc returns the delivery log for a Get request to the /api/webhooks/deliveries
+// endpoint, for the webhook of the optional "webhook" parameter.
+//
+// Example:
+//
+//	curl "http://localhost:8080/api/webhooks/deliveries?webhook=W1"
+func DeliveriesHandleFunc(w http.ResponseWriter, r *http.Request) {
+	r, ok := InitializeResponse(&w, r) // Required before WriteResponse
+	if !ok {
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		WriteError(http.StatusBadRequest, methodNotSupported(r.Method), &w, r)
+		return
+	}
+	WriteResponse(DeliveryList{Status: http.StatusOK, Deliveries: currentWebhooks.Deliveries(r.URL.Query().Get("webhook"))}, &w, r)
+}
@@ -0,0 +1,176 @@
+package api_test
+
+import (
+	"encoding/json"
+	"github.com/jtide/gopark/api"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// receiver is a webhook receiver that fails the first failures requests, and records the others.
+type receiver struct {
+	mu       sync.Mutex
+	failures int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if rc.failures > 0 {
+		rc.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	body, _ := ioutil.ReadAll(r.Body)
+	rc.requests = append(rc.requests, r)
+	rc.bodies = append(rc.bodies, body)
+}
+
+func newTestWebhooks() *api.Webhooks {
+	webhooks := api.NewWebhooks()
+	webhooks.Attempts = 3
+	webhooks.Backoff = time.Millisecond
+	return webhooks
+}
+
+func TestWebhooksNotifySignedPayload(t *testing.T) {
+	rc := &receiver{}
+	server := httptest.NewServer(rc)
+	defer server.Close()
+
+	webhooks := newTestWebhooks()
+	webhook, err := webhooks.Register(server.URL, "s3cret")
+	assert.NoError(t, err)
+	assert.Equal(t, "W1", webhook.ID)
+
+	rates := api.NewWeeklyRates()
+	assert.NoError(t, rates.Update([]byte(`{"rates": [{"days": "wed", "times": "0600-1800", "price": 1750}]}`)))
+	webhooks.Notify(api.EventRatesReplaced, &rates)
+	webhooks.Wait()
+
+	assert.Len(t, rc.requests, 1)
+	assert.Equal(t, api.EventRatesReplaced, rc.requests[0].Header.Get(api.HeaderWebhookEvent))
+	assert.Equal(t, "D1", rc.requests[0].Header.Get(api.HeaderWebhookDelivery))
+	assert.Equal(t, api.Sign("s3cret", rc.bodies[0]), rc.requests[0].Header.Get(api.HeaderWebhookSignature))
+	assert.NotEqual(t, api.Sign("other", rc.bodies[0]), rc.requests[0].Header.Get(api.HeaderWebhookSignature))
+
+	var change api.RateChange
+	assert.NoError(t, json.Unmarshal(rc.bodies[0], &change))
+	assert.Equal(t, api.EventRatesReplaced, change.Event)
+	assert.Equal(t, []api.ConfigRate{{Days: "wed", Times: "0600-1800", Price: 1750}}, change.Rates.Rates)
+
+	deliveries := webhooks.Deliveries("")
+	assert.Len(t, deliveries, 1)
+	assert.Equal(t, api.DeliveryDelivered, deliveries[0].Status)
+	assert.Equal(t, uint(1), deliveries[0].Attempts)
+	assert.Equal(t, http.StatusOK, deliveries[0].Response)
+}
+
+func TestWebhooksRetryWithBackoff(t *testing.T) {
+	tests := []struct {
+		failures int
+		status   string
+		attempts uint
+		received int
+	}{
+		{2, api.DeliveryDelivered, 3, 1},
+		{3, api.DeliveryFailed, 3, 0},
+	}
+
+	rates := api.NewWeeklyRates()
+	for _, test := range tests {
+		rc := &receiver{failures: test.failures}
+		server := httptest.NewServer(rc)
+		webhooks := newTestWebhooks()
+		_, err := webhooks.Register(server.URL, "")
+		assert.NoError(t, err)
+
+		webhooks.Notify(api.EventRatesUpdated, &rates)
+		webhooks.Wait()
+		server.Close()
+
+		delivery := webhooks.Deliveries("W1")[0]
+		assert.Equal(t, test.status, delivery.Status, test.failures)
+		assert.Equal(t, test.attempts, delivery.Attempts, test.failures)
+		assert.Len(t, rc.requests, test.received)
+		if test.status == api.DeliveryFailed {
+			assert.Equal(t, http.StatusServiceUnavailable, delivery.Response)
+			assert.Contains(t, delivery.Error, "503")
+		}
+	}
+}
+
+func TestWebhooksRegisterAndRemove(t *testing.T) {
+	webhooks := newTestWebhooks()
+
+	for _, url := range []string{"", "example.com/hook", "ftp://example.com/hook", "http://"} {
+		_, err := webhooks.Register(url, "")
+		code, field := api.ErrorCode(err, 400)
+		assert.Equal(t, api.CodeInvalidWebhook, code, url)
+		assert.Equal(t, "url", field, url)
+	}
+
+	webhook, err := webhooks.Register("https://example.com/hook", "")
+	assert.NoError(t, err)
+	assert.Len(t, webhook.Secret, 32)
+	assert.Equal(t, []api.Webhook{{ID: webhook.ID, URL: "https://example.com/hook"}}, webhooks.List())
+
+	assert.NoError(t, webhooks.Remove(webhook.ID))
+	code, _ := api.ErrorCode(webhooks.Remove(webhook.ID), 400)
+	assert.Equal(t, api.CodeWebhookNotFound, code)
+	assert.Empty(t, webhooks.List())
+}
+
+func TestWebhooksHandleFunc(t *testing.T) {
+	rc := &receiver{}
+	server := httptest.NewServer(rc)
+	defer server.Close()
+
+	request := func(method string, target string, body string) (int, []byte) {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		api.NewServeMux().ServeHTTP(w, r)
+		return w.Code, w.Body.Bytes()
+	}
+
+	status, body := request(http.MethodPost, "/api/webhooks", `{"url": "`+server.URL+`", "secret": "s3cret"}`)
+	assert.Equal(t, http.StatusOK, status)
+	var list api.WebhookList
+	assert.NoError(t, json.Unmarshal(body, &list))
+	id := list.Webhooks[0].ID
+	assert.Equal(t, "s3cret", list.Webhooks[0].Secret)
+
+	// Every change to the rates is sent to the webhook.
+	assert.NoError(t, api.ReplaceRates(api.JSONDefaultRateConfig))
+	assert.NoError(t, api.UpdateRates([]byte(`{"rates": [{"days": "sun", "times": "2200-2300", "price": 900}]}`)))
+	assert.NoError(t, api.RemoveRates("sun", "2200-2300"))
+
+	status, _ = request(http.MethodDelete, "/api/webhooks?id="+id, "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.NoError(t, api.ReplaceRates(api.JSONDefaultRateConfig))
+
+	status, body = request(http.MethodGet, "/api/webhooks/deliveries?webhook="+id, "")
+	assert.Equal(t, http.StatusOK, status)
+	var deliveries api.DeliveryList
+	assert.NoError(t, json.Unmarshal(body, &deliveries))
+	events := []string{}
+	for _, delivery := range deliveries.Deliveries {
+		events = append(events, delivery.Event)
+	}
+	assert.Equal(t, []string{api.EventRatesRemoved, api.EventRatesUpdated, api.EventRatesReplaced}, events)
+
+	status, _ = request(http.MethodDelete, "/api/webhooks?id="+id, "")
+	assert.Equal(t, http.StatusNotFound, status)
+	status, _ = request(http.MethodPost, "/api/webhooks", `{"url": 5}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+}
@@ -0,0 +1,233 @@
+// Package client is a typed Go client for the gopark rate API.
+//
+// Quotes are returned as api.Rate values, and a stay without an available rate is reported
+// as an *UnavailableError, so that it can be told apart from a request the server rejected,
+// which is reported as a *RequestError:
+//
+//	c := client.New("http://localhost:8080")
+//	rate, err := c.Quote(ctx, start, end)
+//	var unavailable *client.UnavailableError
+//	if errors.As(err, &unavailable) {
+//		// No rate for the stay
+//	}
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/jtide/gopark/api"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// UnavailableError is returned when no rate is available for a stay.
+type UnavailableError struct {
+	Rate api.UnknownRate
+}
+
+func (e *UnavailableError) Error() string {
+	return fmt.Sprintf("rate unavailable from %v to %v", e.Rate.Start.Format(time.RFC3339), e.Rate.End.Format(time.RFC3339))
+}
+
+// RequestError is returned when the server rejects a request, for example because of invalid
+// parameters or a rate configuration that conflicts with existing rates. The Code is one of the
+// api.Code constants, and the Field names the parameter or rate field at fault, if any.
+type RequestError struct {
+	Status      int
+	Code        string
+	Field       string
+	Description string
+}
+
+func (e *RequestError) Error() string {
+	return fmt.Sprintf("gopark: %d %s: %s", e.Status, http.StatusText(e.Status), e.Description)
+}
+
+// Client calls the gopark API at BaseURL, such as "http://localhost:8080".
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+// New returns a Client for the gopark API at baseURL, using http.DefaultClient.
+func New(baseURL string) *Client {
+	return &Client{BaseURL: strings.TrimSuffix(baseURL, "/"), HTTPClient: http.DefaultClient}
+}
+
+// Quote returns the price of a stay from start to end. It returns an *UnavailableError if no
+// rate is available for the stay.
+func (c *Client) Quote(ctx context.Context, start time.Time, end time.Time) (api.Rate, error) {
+	return c.quote(ctx, start, end, false)
+}
+
+// QuoteDetail returns the price of a stay from start to end, with an itemized breakdown.
+func (c *Client) QuoteDetail(ctx context.Context, start time.Time, end time.Time) (api.Rate, error) {
+	return c.quote(ctx, start, end, true)
+}
+
+func (c *Client) quote(ctx context.Context, start time.Time, end time.Time, detail bool) (api.Rate, error) {
+	query := url.Values{}
+	query.Set("start", start.Format(time.RFC3339))
+	query.Set("end", end.Format(time.RFC3339))
+	if detail {
+		query.Set("detail", "true")
+	}
+
+	rate := api.Rate{}
+	resp, err := c.do(ctx, http.MethodGet, "/api/rate?"+query.Encode(), "", nil)
+	if err != nil {
+		return rate, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		unknownRate := api.UnknownRate{}
+		if err = json.NewDecoder(resp.Body).Decode(&unknownRate); err != nil {
+			return rate, err
+		}
+		return rate, &UnavailableError{Rate: unknownRate}
+	}
+	err = decode(resp, &rate)
+	return rate, err
+}
+
+// QuoteBatch returns a result for each interval, quoted against the same rates. Intervals that
+// cannot be priced are reported in their result, rather than as an error.
+func (c *Client) QuoteBatch(ctx context.Context, intervals []api.Interval) (api.BatchQuote, error) {
+	batch := api.BatchQuote{}
+	body, err := json.Marshal(intervals)
+	if err != nil {
+		return batch, err
+	}
+
+	resp, err := c.do(ctx, http.MethodPost, "/api/rate/batch", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return batch, err
+	}
+	defer resp.Body.Close()
+
+	err = decode(resp, &batch)
+	return batch, err
+}
+
+// Rates returns the current rate configuration.
+func (c *Client) Rates(ctx context.Context) (api.ConfigRates, error) {
+	schedule := api.Schedule{}
+	resp, err := c.do(ctx, http.MethodGet, "/api/rates", "", nil)
+	if err != nil {
+		return api.ConfigRates{}, err
+	}
+	defer resp.Body.Close()
+
+	err = decode(resp, &schedule)
+	return api.ConfigRates{Rates: schedule.Rates}, err
+}
+
+// ReplaceRates clears the existing rates and replaces them with the configuration.
+func (c *Client) ReplaceRates(ctx context.Context, config api.ConfigRates) error {
+	return c.send(ctx, http.MethodPut, "/api/rate", config)
+}
+
+// UpdateRates adds the rates of the configuration to the existing rates. It returns a
+// *RequestError if any new rate conflicts with an existing rate.
+func (c *Client) UpdateRates(ctx context.Context, config api.ConfigRates) error {
+	return c.send(ctx, http.MethodPost, "/api/rate", config)
+}
+
+// RemoveRates removes the existing rates for a time range, such as "0900-2100", on each of
+// a list of days, such as "mon,tues".
+func (c *Client) RemoveRates(ctx context.Context, days string, times string) error {
+	query := url.Values{}
+	query.Set("days", days)
+	query.Set("times", times)
+
+	resp, err := c.do(ctx, http.MethodDelete, "/api/rate?"+query.Encode(), "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return decode(resp, &api.APIStandardResponse{})
+}
+
+// Validate checks that the configuration could replace the current rates, without applying
+// it. If minimum is greater than 0, the rates must also cover at least that percentage of the
+// week. It returns a *RequestError describing the first problem found.
+func (c *Client) Validate(ctx context.Context, config api.ConfigRates, minimum float64) error {
+	path := "/api/rates/validate"
+	if minimum > 0 {
+		path += "?minimum=" + url.QueryEscape(fmt.Sprint(minimum))
+	}
+	return c.send(ctx, http.MethodPost, path, config)
+}
+
+// Coverage returns the share of the week covered by the current rates, and every gap.
+func (c *Client) Coverage(ctx context.Context) (api.Coverage, error) {
+	coverage := api.Coverage{}
+	resp, err := c.do(ctx, http.MethodGet, "/api/rates/coverage", "", nil)
+	if err != nil {
+		return coverage, err
+	}
+	defer resp.Body.Close()
+
+	err = decode(resp, &coverage)
+	return coverage, err
+}
+
+// send writes a rate configuration to the API and checks the standard response.
+func (c *Client) send(ctx context.Context, method string, path string, config api.ConfigRates) error {
+	body, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do(ctx, method, path, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return decode(resp, &api.APIStandardResponse{})
+}
+
+func (c *Client) do(ctx context.Context, method string, path string, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.BaseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return httpClient.Do(req)
+}
+
+// decode reads a successful response into v, or returns a *RequestError for any other status.
+func decode(resp *http.Response, v interface{}) error {
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		standard := api.APIStandardResponse{}
+		if err = json.Unmarshal(data, &standard); err != nil || standard.Description == "" {
+			standard.Description = strings.TrimSpace(string(data))
+		}
+		return &RequestError{Status: resp.StatusCode, Code: standard.Code, Field: standard.Field, Description: standard.Description}
+	}
+
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,151 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"github.com/jtide/gopark/api"
+	"github.com/jtide/gopark/client"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestClient(t *testing.T) *client.Client {
+	err := api.ReplaceRates(api.JSONDefaultRateConfig)
+	assert.NoError(t, err)
+
+	server := httptest.NewServer(api.NewServeMux())
+	t.Cleanup(server.Close)
+	return client.New(server.URL)
+}
+
+func parseTime(t *testing.T, s string) time.Time {
+	value, err := time.Parse(time.RFC3339, s)
+	assert.NoError(t, err)
+	return value
+}
+
+func TestClient_Quote(t *testing.T) {
+	c := newTestClient(t)
+
+	rate, err := c.Quote(context.Background(), parseTime(t, "2015-07-01T07:00:00Z"), parseTime(t, "2015-07-01T12:00:00Z"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1750), rate.Price)
+	assert.Nil(t, rate.Breakdown)
+}
+
+func TestClient_QuoteDetail(t *testing.T) {
+	c := newTestClient(t)
+
+	rate, err := c.QuoteDetail(context.Background(), parseTime(t, "2015-07-01T07:00:00Z"), parseTime(t, "2015-07-01T12:00:00Z"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1750), rate.Breakdown.Total)
+	assert.Equal(t, "0600-1800", rate.Breakdown.Items[0].Times)
+}
+
+func TestClient_QuoteUnavailable(t *testing.T) {
+	c := newTestClient(t)
+
+	_, err := c.Quote(context.Background(), parseTime(t, "2015-07-02T07:00:00Z"), parseTime(t, "2015-07-02T12:00:00Z"))
+
+	var unavailable *client.UnavailableError
+	assert.True(t, errors.As(err, &unavailable))
+	assert.Equal(t, "unavailable", unavailable.Rate.Price)
+
+	var requestErr *client.RequestError
+	assert.False(t, errors.As(err, &requestErr))
+}
+
+func TestClient_QuoteBadRequest(t *testing.T) {
+	c := newTestClient(t)
+
+	_, err := c.Quote(context.Background(), parseTime(t, "2015-07-01T12:00:00Z"), parseTime(t, "2015-07-01T07:00:00Z"))
+
+	var requestErr *client.RequestError
+	assert.True(t, errors.As(err, &requestErr))
+	assert.Equal(t, http.StatusBadRequest, requestErr.Status)
+	assert.Equal(t, api.CodeEndBeforeStart, requestErr.Code)
+	assert.Equal(t, "end", requestErr.Field)
+	assert.Equal(t, "end time occurs before start time", requestErr.Description)
+}
+
+func TestClient_QuoteBatch(t *testing.T) {
+	c := newTestClient(t)
+
+	batch, err := c.QuoteBatch(context.Background(), []api.Interval{
+		{Start: "2015-07-01T07:00:00Z", End: "2015-07-01T12:00:00Z"},
+		{Start: "2015-07-02T07:00:00Z", End: "2015-07-02T12:00:00Z"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1750), *batch.Results[0].Price)
+	assert.Equal(t, uint(http.StatusNotFound), batch.Results[1].Status)
+}
+
+func TestClient_ReplaceAndExportRates(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+
+	config := api.ConfigRates{Rates: []api.ConfigRate{{Days: "mon,tues", Times: "0600-1800", Price: 1200}}}
+	err := c.ReplaceRates(ctx, config)
+	assert.NoError(t, err)
+
+	exported, err := c.Rates(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, config, exported)
+}
+
+func TestClient_UpdateAndRemoveRates(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+
+	// Thursday has no rate before 0900
+	update := api.ConfigRates{Rates: []api.ConfigRate{{Days: "thurs", Times: "0600-0800", Price: 500}}}
+	err := c.UpdateRates(ctx, update)
+	assert.NoError(t, err)
+
+	rate, err := c.Quote(ctx, parseTime(t, "2015-07-02T06:30:00Z"), parseTime(t, "2015-07-02T07:30:00Z"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint(500), rate.Price)
+
+	// The same update now conflicts with the new rate
+	err = c.UpdateRates(ctx, update)
+	var requestErr *client.RequestError
+	assert.True(t, errors.As(err, &requestErr))
+
+	err = c.RemoveRates(ctx, "thurs", "0600-0800")
+	assert.NoError(t, err)
+
+	_, err = c.Quote(ctx, parseTime(t, "2015-07-02T06:30:00Z"), parseTime(t, "2015-07-02T07:30:00Z"))
+	var unavailable *client.UnavailableError
+	assert.True(t, errors.As(err, &unavailable))
+
+	err = c.RemoveRates(ctx, "thurs", "0600-0800")
+	assert.True(t, errors.As(err, &requestErr))
+}
+
+func TestClient_Validate(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+
+	valid := api.ConfigRates{Rates: []api.ConfigRate{{Days: "mon", Times: "0000-2400", Price: 1000}}}
+	assert.NoError(t, c.Validate(ctx, valid, 0))
+
+	err := c.Validate(ctx, valid, 50)
+	var requestErr *client.RequestError
+	assert.True(t, errors.As(err, &requestErr))
+	assert.Equal(t, http.StatusUnprocessableEntity, requestErr.Status)
+
+	invalid := api.ConfigRates{Rates: []api.ConfigRate{{Days: "someday", Times: "0000-2400", Price: 1000}}}
+	err = c.Validate(ctx, invalid, 0)
+	assert.True(t, errors.As(err, &requestErr))
+	assert.Equal(t, http.StatusBadRequest, requestErr.Status)
+	assert.Equal(t, api.CodeInvalidDays, requestErr.Code)
+	assert.Equal(t, "days", requestErr.Field)
+
+	// Validation never changes the current rates
+	coverage, err := c.Coverage(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 64.29, coverage.Percent)
+}
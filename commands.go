@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/jtide/gopark/api"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// quote prices a stay against a rate configuration without running the server, and
+// prints the same response the rate endpoint would return. It returns a non-zero exit
+// code if the stay cannot be priced.
+//
+// Example:
+//
+//	gopark quote --config examples/sample-rates.json --start 2015-07-01T07:00:00Z --end 2015-07-01T12:00:00Z
+func quote(args []string) int {
+	flags := flag.NewFlagSet("quote", flag.ExitOnError)
+	configFile := configFlag(flags)
+	start := flags.String("start", "", "Start of the stay in RFC3339 format.")
+	end := flags.String("end", "", "End of the stay in RFC3339 format.")
+	detail := flags.Bool("detail", false, "Include an itemized breakdown of the price.")
+	vehicle := flags.String("vehicle", "", "Class of vehicle to price. The default class of the rates is used if not set.")
+	format := formatFlag(flags)
+	flags.Parse(args)
+
+	rates, err := weeklyRates(*configFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	duration, err := api.ParseDuration(*start, *end)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	quote, err := rates.QuoteWithOptions(duration, api.QuoteOptions{Vehicle: *vehicle})
+	var apiErr *api.Error
+	if errors.As(err, &apiErr) {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	} else if err != nil {
+		unknownRate := api.UnknownRate{Status: http.StatusNotFound, Start: duration.Start, End: duration.End, Price: "unavailable"}
+		printResponse(unknownRate, *format)
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	rate := api.NewRate(duration, quote)
+	if *detail {
+		rate.Breakdown = &quote
+	}
+	if err = printResponse(rate, *format); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// validate checks a rate configuration for errors, such as unknown days, invalid times or
+// overlapping rates, and returns a non-zero exit code if any are found. If a minimum
+// coverage is given, the rates must also cover at least that percentage of the week.
+//
+// Example:
+//
+//	gopark validate --config examples/sample-rates.json --minimum 50
+func validate(args []string) int {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	configFile := configFlag(flags)
+	minimum := minimumFlag(flags)
+	flags.Parse(args)
+
+	config, err := rateConfig(*configFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	rates := api.NewWeeklyRates()
+	if err = rates.UpdateWithConfig(config); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if err = rates.Coverage().Validate(*minimum); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	fmt.Printf("%s: %d rates are valid\n", configName(*configFile), len(config.Rates))
+	return 0
+}
+
+// export prints a rate configuration in normalized form, with rates that share a time range
+// and price combined, and the days ordered from Monday to Sunday.
+//
+// Example:
+//
+//	gopark export --config examples/sample-rates.json --format csv
+func export(args []string) int {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	configFile := configFlag(flags)
+	format := flags.String("format", "json", "Output format, either \"json\" or \"csv\".")
+	flags.Parse(args)
+
+	rates, err := weeklyRates(*configFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	config := rates.Config()
+
+	var output []byte
+	switch *format {
+	case "json":
+		output, err = json.MarshalIndent(config, "", "  ")
+		output = append(output, '\n')
+	case "csv":
+		output, err = config.CSV()
+	default:
+		err = fmt.Errorf("unknown format %q, expected \"json\" or \"csv\"", *format)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	os.Stdout.Write(output)
+	return 0
+}
+
+// coverage prints the gaps in a rate configuration, and returns a non-zero exit
+// code if the configuration is invalid or covers less than the minimum percentage.
+//
+// Example:
+//
+//	gopark coverage --config examples/sample-rates.json --minimum 75
+func coverage(args []string) int {
+	flags := flag.NewFlagSet("coverage", flag.ExitOnError)
+	configFile := configFlag(flags)
+	minimum := minimumFlag(flags)
+	flags.Parse(args)
+
+	rates, err := weeklyRates(*configFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	report := rates.Coverage()
+	fmt.Print(report)
+	if err := report.Validate(*minimum); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func configFlag(flags *flag.FlagSet) *string {
+	return flags.String("config", "", "Path to JSON or CSV rate configuration file. The default rates are used if not set.")
+}
+
+func minimumFlag(flags *flag.FlagSet) *float64 {
+	return flags.Float64("minimum", 0, "Minimum percentage of the week that must be covered by rates.")
+}
+
+func formatFlag(flags *flag.FlagSet) *string {
+	return flags.String("format", "json", "Output format, one of \"json\", \"xml\", \"yaml\", \"text\" or \"html\".")
+}
+
+func configName(configFile string) string {
+	if configFile == "" {
+		return "default rates"
+	}
+	return configFile
+}
+
+// rateConfig reads and parses a rate configuration file. Files with a ".csv" extension are
+// parsed as CSV, and all others as JSON. The default rates are used if no file is given.
+func rateConfig(configFile string) (api.ConfigRates, error) {
+	if configFile == "" {
+		return api.ConfigRatesFromJSON(api.JSONDefaultRateConfig)
+	}
+
+	fmt.Fprintln(os.Stderr, "Using rates configuration file:", configFile)
+	data, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return api.ConfigRates{}, err
+	}
+
+	if strings.EqualFold(filepath.Ext(configFile), ".csv") {
+		return api.ConfigRatesFromCSV(bytes.NewReader(data))
+	}
+	return api.ConfigRatesFromJSON(data)
+}
+
+// weeklyRates reads a rate configuration file into a new WeeklyRates table, independent of
+// the rates used by the server.
+func weeklyRates(configFile string) (api.WeeklyRates, error) {
+	config, err := rateConfig(configFile)
+	if err != nil {
+		return api.WeeklyRates{}, err
+	}
+
+	rates := api.NewWeeklyRates()
+	if err = rates.UpdateWithConfig(config); err != nil {
+		return api.WeeklyRates{}, err
+	}
+	return rates, nil
+}
+
+// formats maps the names accepted by the --format flag to the media types of their encodings.
+var formats = map[string]string{
+	"json": api.MediaTypeJSON,
+	"xml":  api.MediaTypeXML,
+	"yaml": api.MediaTypeYAML,
+	"text": api.MediaTypeText,
+	"html": api.MediaTypeHTML,
+}
+
+// printResponse writes a response to stdout in the same format the server would use.
+func printResponse(f api.WebFormatter, format string) error {
+	mediaType, ok := formats[format]
+	if !ok {
+		return fmt.Errorf("unknown format %q, expected \"json\", \"xml\", \"yaml\", \"text\" or \"html\"", format)
+	}
+
+	output, err := api.Encode(mediaType, f)
+	if err != nil {
+		return fmt.Errorf("could not write response as %v: %w", format, err)
+	}
+
+	fmt.Println(strings.TrimSuffix(string(output), "\n"))
+	return nil
+}
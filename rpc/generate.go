@@ -0,0 +1,5 @@
+// Package rpc is the gRPC API of gopark, generated from gopark.proto. The service is implemented by
+// api.RatesServer.
+package rpc
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative gopark.proto
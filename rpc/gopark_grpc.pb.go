@@ -0,0 +1,347 @@
+// The gRPC API of gopark. It is served alongside the REST API, and is backed by the same rates, so a
+// change made through either API is seen by both. Times are in RFC3339 format, such as
+// "2015-07-01T07:00:00Z", and prices are in the minor unit of the currency, as in the REST API.
+//
+// Errors have the status code closest to the status of the REST API, and an ErrorInfo detail with the
+// error code of doc/errors.md as its reason, and the field that caused the error in its metadata.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: gopark.proto
+
+package rpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Rates_Quote_FullMethodName        = "/gopark.v1.Rates/Quote"
+	Rates_BatchQuote_FullMethodName   = "/gopark.v1.Rates/BatchQuote"
+	Rates_GetRates_FullMethodName     = "/gopark.v1.Rates/GetRates"
+	Rates_ReplaceRates_FullMethodName = "/gopark.v1.Rates/ReplaceRates"
+	Rates_UpdateRates_FullMethodName  = "/gopark.v1.Rates/UpdateRates"
+	Rates_WatchRates_FullMethodName   = "/gopark.v1.Rates/WatchRates"
+)
+
+// RatesClient is the client API for Rates service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type RatesClient interface {
+	// Quote prices a stay from start to end. It fails with NOT_FOUND if no rate covers the stay, and
+	// with RESOURCE_EXHAUSTED if the facility has no spot free during the stay.
+	Quote(ctx context.Context, in *QuoteRequest, opts ...grpc.CallOption) (*QuoteResponse, error)
+	// BatchQuote prices many stays against the same rates. A failure to price one stay is reported in
+	// its result, and does not affect the others.
+	BatchQuote(ctx context.Context, in *BatchQuoteRequest, opts ...grpc.CallOption) (*BatchQuoteResponse, error)
+	// GetRates exports the current rates.
+	GetRates(ctx context.Context, in *GetRatesRequest, opts ...grpc.CallOption) (*RateConfig, error)
+	// ReplaceRates replaces all rates.
+	ReplaceRates(ctx context.Context, in *RateConfig, opts ...grpc.CallOption) (*UpdateRatesResponse, error)
+	// UpdateRates adds rates that do not conflict with existing rates.
+	UpdateRates(ctx context.Context, in *RateConfig, opts ...grpc.CallOption) (*UpdateRatesResponse, error)
+	// WatchRates streams the current rates, and then the rates after every change to them, until the
+	// client cancels the call.
+	WatchRates(ctx context.Context, in *WatchRatesRequest, opts ...grpc.CallOption) (Rates_WatchRatesClient, error)
+}
+
+type ratesClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewRatesClient(cc grpc.ClientConnInterface) RatesClient {
+	return &ratesClient{cc}
+}
+
+func (c *ratesClient) Quote(ctx context.Context, in *QuoteRequest, opts ...grpc.CallOption) (*QuoteResponse, error) {
+	out := new(QuoteResponse)
+	err := c.cc.Invoke(ctx, Rates_Quote_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ratesClient) BatchQuote(ctx context.Context, in *BatchQuoteRequest, opts ...grpc.CallOption) (*BatchQuoteResponse, error) {
+	out := new(BatchQuoteResponse)
+	err := c.cc.Invoke(ctx, Rates_BatchQuote_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ratesClient) GetRates(ctx context.Context, in *GetRatesRequest, opts ...grpc.CallOption) (*RateConfig, error) {
+	out := new(RateConfig)
+	err := c.cc.Invoke(ctx, Rates_GetRates_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ratesClient) ReplaceRates(ctx context.Context, in *RateConfig, opts ...grpc.CallOption) (*UpdateRatesResponse, error) {
+	out := new(UpdateRatesResponse)
+	err := c.cc.Invoke(ctx, Rates_ReplaceRates_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ratesClient) UpdateRates(ctx context.Context, in *RateConfig, opts ...grpc.CallOption) (*UpdateRatesResponse, error) {
+	out := new(UpdateRatesResponse)
+	err := c.cc.Invoke(ctx, Rates_UpdateRates_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ratesClient) WatchRates(ctx context.Context, in *WatchRatesRequest, opts ...grpc.CallOption) (Rates_WatchRatesClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Rates_ServiceDesc.Streams[0], Rates_WatchRates_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &ratesWatchRatesClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Rates_WatchRatesClient interface {
+	Recv() (*RateChange, error)
+	grpc.ClientStream
+}
+
+type ratesWatchRatesClient struct {
+	grpc.ClientStream
+}
+
+func (x *ratesWatchRatesClient) Recv() (*RateChange, error) {
+	m := new(RateChange)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// RatesServer is the server API for Rates service.
+// All implementations must embed UnimplementedRatesServer
+// for forward compatibility
+type RatesServer interface {
+	// Quote prices a stay from start to end. It fails with NOT_FOUND if no rate covers the stay, and
+	// with RESOURCE_EXHAUSTED if the facility has no spot free during the stay.
+	Quote(context.Context, *QuoteRequest) (*QuoteResponse, error)
+	// BatchQuote prices many stays against the same rates. A failure to price one stay is reported in
+	// its result, and does not affect the others.
+	BatchQuote(context.Context, *BatchQuoteRequest) (*BatchQuoteResponse, error)
+	// GetRates exports the current rates.
+	GetRates(context.Context, *GetRatesRequest) (*RateConfig, error)
+	// ReplaceRates replaces all rates.
+	ReplaceRates(context.Context, *RateConfig) (*UpdateRatesResponse, error)
+	// UpdateRates adds rates that do not conflict with existing rates.
+	UpdateRates(context.Context, *RateConfig) (*UpdateRatesResponse, error)
+	// WatchRates streams the current rates, and then the rates after every change to them, until the
+	// client cancels the call.
+	WatchRates(*WatchRatesRequest, Rates_WatchRatesServer) error
+	mustEmbedUnimplementedRatesServer()
+}
+
+// UnimplementedRatesServer must be embedded to have forward compatible implementations.
+type UnimplementedRatesServer struct {
+}
+
+func (UnimplementedRatesServer) Quote(context.Context, *QuoteRequest) (*QuoteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Quote not implemented")
+}
+func (UnimplementedRatesServer) BatchQuote(context.Context, *BatchQuoteRequest) (*BatchQuoteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchQuote not implemented")
+}
+func (UnimplementedRatesServer) GetRates(context.Context, *GetRatesRequest) (*RateConfig, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetRates not implemented")
+}
+func (UnimplementedRatesServer) ReplaceRates(context.Context, *RateConfig) (*UpdateRatesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReplaceRates not implemented")
+}
+func (UnimplementedRatesServer) UpdateRates(context.Context, *RateConfig) (*UpdateRatesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateRates not implemented")
+}
+func (UnimplementedRatesServer) WatchRates(*WatchRatesRequest, Rates_WatchRatesServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchRates not implemented")
+}
+func (UnimplementedRatesServer) mustEmbedUnimplementedRatesServer() {}
+
+// UnsafeRatesServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to RatesServer will
+// result in compilation errors.
+type UnsafeRatesServer interface {
+	mustEmbedUnimplementedRatesServer()
+}
+
+func RegisterRatesServer(s grpc.ServiceRegistrar, srv RatesServer) {
+	s.RegisterService(&Rates_ServiceDesc, srv)
+}
+
+func _Rates_Quote_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QuoteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RatesServer).Quote(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Rates_Quote_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RatesServer).Quote(ctx, req.(*QuoteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Rates_BatchQuote_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchQuoteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RatesServer).BatchQuote(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Rates_BatchQuote_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RatesServer).BatchQuote(ctx, req.(*BatchQuoteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Rates_GetRates_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRatesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RatesServer).GetRates(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Rates_GetRates_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RatesServer).GetRates(ctx, req.(*GetRatesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Rates_ReplaceRates_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RateConfig)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RatesServer).ReplaceRates(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Rates_ReplaceRates_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RatesServer).ReplaceRates(ctx, req.(*RateConfig))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Rates_UpdateRates_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RateConfig)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RatesServer).UpdateRates(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Rates_UpdateRates_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RatesServer).UpdateRates(ctx, req.(*RateConfig))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Rates_WatchRates_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRatesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(RatesServer).WatchRates(m, &ratesWatchRatesServer{stream})
+}
+
+type Rates_WatchRatesServer interface {
+	Send(*RateChange) error
+	grpc.ServerStream
+}
+
+type ratesWatchRatesServer struct {
+	grpc.ServerStream
+}
+
+func (x *ratesWatchRatesServer) Send(m *RateChange) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Rates_ServiceDesc is the grpc.ServiceDesc for Rates service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Rates_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "gopark.v1.Rates",
+	HandlerType: (*RatesServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Quote",
+			Handler:    _Rates_Quote_Handler,
+		},
+		{
+			MethodName: "BatchQuote",
+			Handler:    _Rates_BatchQuote_Handler,
+		},
+		{
+			MethodName: "GetRates",
+			Handler:    _Rates_GetRates_Handler,
+		},
+		{
+			MethodName: "ReplaceRates",
+			Handler:    _Rates_ReplaceRates_Handler,
+		},
+		{
+			MethodName: "UpdateRates",
+			Handler:    _Rates_UpdateRates_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchRates",
+			Handler:       _Rates_WatchRates_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "gopark.proto",
+}
@@ -4,20 +4,95 @@ import (
 	"flag"
 	"fmt"
 	"github.com/jtide/gopark/api"
-	"io/ioutil"
+	"google.golang.org/grpc"
+	"net"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 )
 
 func main() {
-	err := api.ReplaceRates(jsonRateConfig())
+	// Without a command, run the server, so that "gopark --config file.json"
+	// continues to work as it did before commands were introduced.
+	command, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+
+	switch command {
+	case "serve":
+		serve(args)
+	case "quote":
+		os.Exit(quote(args))
+	case "validate":
+		os.Exit(validate(args))
+	case "export":
+		os.Exit(export(args))
+	case "coverage":
+		os.Exit(coverage(args))
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", command)
+		usage()
+		os.Exit(2)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `Usage: gopark [command] [flags]
+
+Commands:
+  serve     Run the rate API server (default)
+  quote     Price a stay against a rate configuration
+  validate  Check a rate configuration for errors
+  export    Print a rate configuration in normalized form
+  coverage  List the windows of the week without a rate
+
+Run "gopark <command> -h" for the flags of a command.`)
+}
+
+func serve(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	configFile := configFlag(flags)
+	sessionsFile := flags.String("sessions", "gopark-sessions.jsonl", "Path to the file that parking sessions are saved to. Sessions are only kept in memory if empty.")
+	reservationsFile := flags.String("reservations", "gopark-reservations.jsonl", "Path to the file that reservations are saved to. Reservations are only kept in memory if empty.")
+	retention := flags.Duration("retention", 30*24*time.Hour, "How long sessions are kept after check-out, and reservations after they end or are cancelled. Kept forever if 0.")
+	quoteRate := flags.Float64("quote-rate", 20, "Quotes, and other requests that change nothing, allowed per second for each client. Unlimited if 0.")
+	quoteBurst := flags.Int("quote-burst", 40, "Quotes, and other requests that change nothing, allowed at once for each client.")
+	mutationRate := flags.Float64("mutation-rate", 2, "Requests that change rates, discounts, sessions, reservations or webhooks allowed per second for each client. Unlimited if 0.")
+	mutationBurst := flags.Int("mutation-burst", 10, "Requests that change rates, discounts, sessions, reservations or webhooks allowed at once for each client.")
+	flags.Parse(args)
+
+	config, err := rateConfig(*configFile)
+	if err == nil {
+		err = api.ReplaceRatesWithConfig(config)
+	}
+	if err == nil {
+		err = api.LoadSessions(*sessionsFile, *retention)
+	}
+	if err == nil {
+		err = api.LoadReservations(*reservationsFile, *retention)
+	}
 	if err != nil {
-		// Failure to apply the initial rate configuration is
-		// one of the very few cases where a panic is warranted.
+		// Failure to apply the initial rate configuration, or to read
+		// the saved sessions or reservations, is one of the very few
+		// cases where a panic is warranted.
 		panic(err)
 	}
-	http.HandleFunc("/api/rate", api.RateHandleFunc)
-	http.ListenAndServe(port(), nil)
+	limiter := api.NewLimiter(api.Limit{Rate: *quoteRate, Burst: *quoteBurst}, api.Limit{Rate: *mutationRate, Burst: *mutationBurst}, apiKeys()...)
+	go serveGRPC(limiter)
+	http.ListenAndServe(port(), limiter.Handler(api.NewServeMux()))
+}
+
+// serveGRPC serves the gRPC API on its own port, alongside the REST API, with the budgets of the
+// limiter of the REST API. The REST API keeps running if the port cannot be listened on.
+func serveGRPC(limiter *api.Limiter) {
+	listener, err := net.Listen("tcp", grpcPort())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to serve gRPC API: %v\n", err)
+		return
+	}
+	api.NewGRPCServer(grpc.UnaryInterceptor(limiter.UnaryInterceptor()), grpc.StreamInterceptor(limiter.StreamInterceptor())).Serve(listener)
 }
 
 func port() string {
@@ -28,20 +103,22 @@ func port() string {
 	return ":" + port
 }
 
-func jsonRateConfig() []byte {
-	configFile := flag.String("config", "", "Absolute path to JSON rate configuration file.")
-	flag.Parse()
-
-	if *configFile == "" {
-		return api.JSONDefaultRateConfig
+func grpcPort() string {
+	port := os.Getenv("GOPARK_GRPC_PORT")
+	if len(port) == 0 {
+		port = "9090"
 	}
+	return ":" + port
+}
 
-	fmt.Println("Using rates configuration file:", *configFile)
-	configJSON, err := ioutil.ReadFile(*configFile)
-	if err != nil {
-		// Panic if configuration file cannot be read
-		panic(err)
+// apiKeys returns the API keys of clients in GOPARK_API_KEYS, separated by commas. Each client with
+// a key has its own budget of requests, and all others share the budget of their IP address.
+func apiKeys() []string {
+	var keys []string
+	for _, key := range strings.Split(os.Getenv("GOPARK_API_KEYS"), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
 	}
-
-	return configJSON
+	return keys
 }